@@ -21,6 +21,59 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// 缓存变化的类型
+type InvalidationKind int32
+
+const (
+	InvalidationKind_INVALIDATION_SET    InvalidationKind = 0 // 写入或重新加载
+	InvalidationKind_INVALIDATION_DELETE InvalidationKind = 1 // 删除
+	InvalidationKind_INVALIDATION_EVICT  InvalidationKind = 2 // 因容量或过期被淘汰
+	InvalidationKind_INVALIDATION_RESET  InvalidationKind = 3 // 无法从请求的序号续传，订阅方需丢弃该节点的所有缓存
+)
+
+// Enum value maps for InvalidationKind.
+var (
+	InvalidationKind_name = map[int32]string{
+		0: "INVALIDATION_SET",
+		1: "INVALIDATION_DELETE",
+		2: "INVALIDATION_EVICT",
+		3: "INVALIDATION_RESET",
+	}
+	InvalidationKind_value = map[string]int32{
+		"INVALIDATION_SET":    0,
+		"INVALIDATION_DELETE": 1,
+		"INVALIDATION_EVICT":  2,
+		"INVALIDATION_RESET":  3,
+	}
+)
+
+func (x InvalidationKind) Enum() *InvalidationKind {
+	p := new(InvalidationKind)
+	*p = x
+	return p
+}
+
+func (x InvalidationKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (InvalidationKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_groupcache_proto_enumTypes[0].Descriptor()
+}
+
+func (InvalidationKind) Type() protoreflect.EnumType {
+	return &file_groupcache_proto_enumTypes[0]
+}
+
+func (x InvalidationKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use InvalidationKind.Descriptor instead.
+func (InvalidationKind) EnumDescriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{0}
+}
+
 type GetRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
@@ -76,6 +129,7 @@ func (x *GetRequest) GetKey() string {
 type GetResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Value         []byte                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	ExpireAt      int64                  `protobuf:"varint,2,opt,name=expire_at,json=expireAt,proto3" json:"expire_at,omitempty"` // 过期时间的unix毫秒时间戳，0 表示永不过期
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -117,19 +171,1581 @@ func (x *GetResponse) GetValue() []byte {
 	return nil
 }
 
-var File_groupcache_proto protoreflect.FileDescriptor
+func (x *GetResponse) GetExpireAt() int64 {
+	if x != nil {
+		return x.ExpireAt
+	}
+	return 0
+}
 
-const file_groupcache_proto_rawDesc = "" +
-	"\n" +
-	"\x10groupcache.proto\x12\tfishcache\"4\n" +
-	"\n" +
-	"GetRequest\x12\x14\n" +
-	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
-	"\x03key\x18\x02 \x01(\tR\x03key\"#\n" +
-	"\vGetResponse\x12\x14\n" +
-	"\x05value\x18\x01 \x01(\fR\x05value2F\n" +
-	"\fCacheService\x126\n" +
-	"\x03Get\x12\x15.fishcache.GetRequest\x1a\x16.fishcache.GetResponse\"\x00B\x03Z\x01.b\x06proto3"
+type SetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	ExpireAt      int64                  `protobuf:"varint,4,opt,name=expire_at,json=expireAt,proto3" json:"expire_at,omitempty"` // 过期时间的unix毫秒时间戳，0 表示永不过期
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetRequest) Reset() {
+	*x = SetRequest{}
+	mi := &file_groupcache_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetRequest) ProtoMessage() {}
+
+func (x *SetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetRequest.ProtoReflect.Descriptor instead.
+func (*SetRequest) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SetRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *SetRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *SetRequest) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *SetRequest) GetExpireAt() int64 {
+	if x != nil {
+		return x.ExpireAt
+	}
+	return 0
+}
+
+type SetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetResponse) Reset() {
+	*x = SetResponse{}
+	mi := &file_groupcache_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetResponse) ProtoMessage() {}
+
+func (x *SetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetResponse.ProtoReflect.Descriptor instead.
+func (*SetResponse) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{3}
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_groupcache_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DeleteRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *DeleteRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_groupcache_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{5}
+}
+
+type InvalidateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InvalidateRequest) Reset() {
+	*x = InvalidateRequest{}
+	mi := &file_groupcache_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InvalidateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InvalidateRequest) ProtoMessage() {}
+
+func (x *InvalidateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InvalidateRequest.ProtoReflect.Descriptor instead.
+func (*InvalidateRequest) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *InvalidateRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *InvalidateRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type InvalidateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InvalidateResponse) Reset() {
+	*x = InvalidateResponse{}
+	mi := &file_groupcache_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InvalidateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InvalidateResponse) ProtoMessage() {}
+
+func (x *InvalidateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InvalidateResponse.ProtoReflect.Descriptor instead.
+func (*InvalidateResponse) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{7}
+}
+
+type GetMultiRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Keys          []string               `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMultiRequest) Reset() {
+	*x = GetMultiRequest{}
+	mi := &file_groupcache_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMultiRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMultiRequest) ProtoMessage() {}
+
+func (x *GetMultiRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMultiRequest.ProtoReflect.Descriptor instead.
+func (*GetMultiRequest) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetMultiRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *GetMultiRequest) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+type KeyValue struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	ExpireAt      int64                  `protobuf:"varint,3,opt,name=expire_at,json=expireAt,proto3" json:"expire_at,omitempty"` // 过期时间的unix毫秒时间戳，0 表示永不过期
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`                        // 获取失败时的错误信息，为空表示成功
+	NotFound      bool                   `protobuf:"varint,5,opt,name=not_found,json=notFound,proto3" json:"not_found,omitempty"` // key在数据源中不存在，此时 error 为对应的错误信息
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyValue) Reset() {
+	*x = KeyValue{}
+	mi := &file_groupcache_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyValue) ProtoMessage() {}
+
+func (x *KeyValue) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyValue.ProtoReflect.Descriptor instead.
+func (*KeyValue) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *KeyValue) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *KeyValue) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *KeyValue) GetExpireAt() int64 {
+	if x != nil {
+		return x.ExpireAt
+	}
+	return 0
+}
+
+func (x *KeyValue) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *KeyValue) GetNotFound() bool {
+	if x != nil {
+		return x.NotFound
+	}
+	return false
+}
+
+type GetMultiResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*KeyValue            `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMultiResponse) Reset() {
+	*x = GetMultiResponse{}
+	mi := &file_groupcache_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMultiResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMultiResponse) ProtoMessage() {}
+
+func (x *GetMultiResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMultiResponse.ProtoReflect.Descriptor instead.
+func (*GetMultiResponse) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetMultiResponse) GetEntries() []*KeyValue {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+type HandoffEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	ExpireAt      int64                  `protobuf:"varint,4,opt,name=expire_at,json=expireAt,proto3" json:"expire_at,omitempty"` // 过期时间的unix毫秒时间戳，0 表示永不过期
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HandoffEntry) Reset() {
+	*x = HandoffEntry{}
+	mi := &file_groupcache_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HandoffEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HandoffEntry) ProtoMessage() {}
+
+func (x *HandoffEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HandoffEntry.ProtoReflect.Descriptor instead.
+func (*HandoffEntry) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *HandoffEntry) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *HandoffEntry) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *HandoffEntry) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *HandoffEntry) GetExpireAt() int64 {
+	if x != nil {
+		return x.ExpireAt
+	}
+	return 0
+}
+
+type HandoffResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accepted      int64                  `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"` // 接收方实际保存的缓存数量，本地已有的key不会被覆盖
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HandoffResponse) Reset() {
+	*x = HandoffResponse{}
+	mi := &file_groupcache_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HandoffResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HandoffResponse) ProtoMessage() {}
+
+func (x *HandoffResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HandoffResponse.ProtoReflect.Descriptor instead.
+func (*HandoffResponse) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *HandoffResponse) GetAccepted() int64 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+type Node struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Addr          string                 `protobuf:"bytes,1,opt,name=addr,proto3" json:"addr,omitempty"`
+	Weight        int64                  `protobuf:"varint,2,opt,name=weight,proto3" json:"weight,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Node) Reset() {
+	*x = Node{}
+	mi := &file_groupcache_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Node) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Node) ProtoMessage() {}
+
+func (x *Node) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Node.ProtoReflect.Descriptor instead.
+func (*Node) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Node) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+func (x *Node) GetWeight() int64 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+type PullRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Node          string                 `protobuf:"bytes,1,opt,name=node,proto3" json:"node,omitempty"`   // 请求方的地址
+	Nodes         []*Node                `protobuf:"bytes,2,rep,name=nodes,proto3" json:"nodes,omitempty"` // 请求方看到的所有节点及权重，接收方据此判断key的归属
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PullRequest) Reset() {
+	*x = PullRequest{}
+	mi := &file_groupcache_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PullRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PullRequest) ProtoMessage() {}
+
+func (x *PullRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PullRequest.ProtoReflect.Descriptor instead.
+func (*PullRequest) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *PullRequest) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *PullRequest) GetNodes() []*Node {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+type SubscribeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Groups        []string               `protobuf:"bytes,1,rep,name=groups,proto3" json:"groups,omitempty"`                   // 订阅的 Group，为空时订阅所有 Group
+	Epoch         uint64                 `protobuf:"varint,2,opt,name=epoch,proto3" json:"epoch,omitempty"`                    // 上次订阅时收到的纪元，服务端重启后纪元改变，无法续传
+	FromSeq       uint64                 `protobuf:"varint,3,opt,name=from_seq,json=fromSeq,proto3" json:"from_seq,omitempty"` // 从该序号之后续传，epoch 为0时忽略
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_groupcache_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *SubscribeRequest) GetGroups() []string {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+func (x *SubscribeRequest) GetFromSeq() uint64 {
+	if x != nil {
+		return x.FromSeq
+	}
+	return 0
+}
+
+type Invalidation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Epoch         uint64                 `protobuf:"varint,1,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	Seq           uint64                 `protobuf:"varint,2,opt,name=seq,proto3" json:"seq,omitempty"` // 同一纪元内单调递增，RESET 中为当前的最新序号
+	Kind          InvalidationKind       `protobuf:"varint,3,opt,name=kind,proto3,enum=fishcache.InvalidationKind" json:"kind,omitempty"`
+	Group         string                 `protobuf:"bytes,4,opt,name=group,proto3" json:"group,omitempty"`
+	Key           string                 `protobuf:"bytes,5,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Invalidation) Reset() {
+	*x = Invalidation{}
+	mi := &file_groupcache_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Invalidation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Invalidation) ProtoMessage() {}
+
+func (x *Invalidation) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Invalidation.ProtoReflect.Descriptor instead.
+func (*Invalidation) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *Invalidation) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+func (x *Invalidation) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Invalidation) GetKind() InvalidationKind {
+	if x != nil {
+		return x.Kind
+	}
+	return InvalidationKind_INVALIDATION_SET
+}
+
+func (x *Invalidation) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *Invalidation) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type ListGroupsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListGroupsRequest) Reset() {
+	*x = ListGroupsRequest{}
+	mi := &file_groupcache_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListGroupsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListGroupsRequest) ProtoMessage() {}
+
+func (x *ListGroupsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListGroupsRequest.ProtoReflect.Descriptor instead.
+func (*ListGroupsRequest) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{17}
+}
+
+type GroupInfo struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Name           string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	EvictionPolicy string                 `protobuf:"bytes,2,opt,name=eviction_policy,json=evictionPolicy,proto3" json:"eviction_policy,omitempty"`
+	MaxBytes       int64                  `protobuf:"varint,3,opt,name=max_bytes,json=maxBytes,proto3" json:"max_bytes,omitempty"` // 主缓存和热点缓存的总容量
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *GroupInfo) Reset() {
+	*x = GroupInfo{}
+	mi := &file_groupcache_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GroupInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GroupInfo) ProtoMessage() {}
+
+func (x *GroupInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GroupInfo.ProtoReflect.Descriptor instead.
+func (*GroupInfo) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *GroupInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *GroupInfo) GetEvictionPolicy() string {
+	if x != nil {
+		return x.EvictionPolicy
+	}
+	return ""
+}
+
+func (x *GroupInfo) GetMaxBytes() int64 {
+	if x != nil {
+		return x.MaxBytes
+	}
+	return 0
+}
+
+type ListGroupsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Groups        []*GroupInfo           `protobuf:"bytes,1,rep,name=groups,proto3" json:"groups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListGroupsResponse) Reset() {
+	*x = ListGroupsResponse{}
+	mi := &file_groupcache_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListGroupsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListGroupsResponse) ProtoMessage() {}
+
+func (x *ListGroupsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListGroupsResponse.ProtoReflect.Descriptor instead.
+func (*ListGroupsResponse) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ListGroupsResponse) GetGroups() []*GroupInfo {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+type CacheStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Items         int64                  `protobuf:"varint,1,opt,name=items,proto3" json:"items,omitempty"`
+	Bytes         int64                  `protobuf:"varint,2,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Evictions     int64                  `protobuf:"varint,3,opt,name=evictions,proto3" json:"evictions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CacheStats) Reset() {
+	*x = CacheStats{}
+	mi := &file_groupcache_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CacheStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CacheStats) ProtoMessage() {}
+
+func (x *CacheStats) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CacheStats.ProtoReflect.Descriptor instead.
+func (*CacheStats) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *CacheStats) GetItems() int64 {
+	if x != nil {
+		return x.Items
+	}
+	return 0
+}
+
+func (x *CacheStats) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *CacheStats) GetEvictions() int64 {
+	if x != nil {
+		return x.Evictions
+	}
+	return 0
+}
+
+type GroupStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Gets          int64                  `protobuf:"varint,2,opt,name=gets,proto3" json:"gets,omitempty"`
+	Hits          int64                  `protobuf:"varint,3,opt,name=hits,proto3" json:"hits,omitempty"`
+	HotHits       int64                  `protobuf:"varint,4,opt,name=hot_hits,json=hotHits,proto3" json:"hot_hits,omitempty"`
+	Misses        int64                  `protobuf:"varint,5,opt,name=misses,proto3" json:"misses,omitempty"`
+	Loads         int64                  `protobuf:"varint,6,opt,name=loads,proto3" json:"loads,omitempty"`
+	LocalLoads    int64                  `protobuf:"varint,7,opt,name=local_loads,json=localLoads,proto3" json:"local_loads,omitempty"`
+	PeerLoads     int64                  `protobuf:"varint,8,opt,name=peer_loads,json=peerLoads,proto3" json:"peer_loads,omitempty"`
+	PeerErrors    int64                  `protobuf:"varint,9,opt,name=peer_errors,json=peerErrors,proto3" json:"peer_errors,omitempty"`
+	Main          *CacheStats            `protobuf:"bytes,10,opt,name=main,proto3" json:"main,omitempty"`
+	Hot           *CacheStats            `protobuf:"bytes,11,opt,name=hot,proto3" json:"hot,omitempty"`
+	Disk          *CacheStats            `protobuf:"bytes,12,opt,name=disk,proto3" json:"disk,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GroupStats) Reset() {
+	*x = GroupStats{}
+	mi := &file_groupcache_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GroupStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GroupStats) ProtoMessage() {}
+
+func (x *GroupStats) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GroupStats.ProtoReflect.Descriptor instead.
+func (*GroupStats) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *GroupStats) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *GroupStats) GetGets() int64 {
+	if x != nil {
+		return x.Gets
+	}
+	return 0
+}
+
+func (x *GroupStats) GetHits() int64 {
+	if x != nil {
+		return x.Hits
+	}
+	return 0
+}
+
+func (x *GroupStats) GetHotHits() int64 {
+	if x != nil {
+		return x.HotHits
+	}
+	return 0
+}
+
+func (x *GroupStats) GetMisses() int64 {
+	if x != nil {
+		return x.Misses
+	}
+	return 0
+}
+
+func (x *GroupStats) GetLoads() int64 {
+	if x != nil {
+		return x.Loads
+	}
+	return 0
+}
+
+func (x *GroupStats) GetLocalLoads() int64 {
+	if x != nil {
+		return x.LocalLoads
+	}
+	return 0
+}
+
+func (x *GroupStats) GetPeerLoads() int64 {
+	if x != nil {
+		return x.PeerLoads
+	}
+	return 0
+}
+
+func (x *GroupStats) GetPeerErrors() int64 {
+	if x != nil {
+		return x.PeerErrors
+	}
+	return 0
+}
+
+func (x *GroupStats) GetMain() *CacheStats {
+	if x != nil {
+		return x.Main
+	}
+	return nil
+}
+
+func (x *GroupStats) GetHot() *CacheStats {
+	if x != nil {
+		return x.Hot
+	}
+	return nil
+}
+
+func (x *GroupStats) GetDisk() *CacheStats {
+	if x != nil {
+		return x.Disk
+	}
+	return nil
+}
+
+type StatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsRequest) Reset() {
+	*x = StatsRequest{}
+	mi := &file_groupcache_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsRequest) ProtoMessage() {}
+
+func (x *StatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsRequest.ProtoReflect.Descriptor instead.
+func (*StatsRequest) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{22}
+}
+
+type StatsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Addr          string                 `protobuf:"bytes,1,opt,name=addr,proto3" json:"addr,omitempty"`
+	Weight        int64                  `protobuf:"varint,2,opt,name=weight,proto3" json:"weight,omitempty"`
+	Placement     string                 `protobuf:"bytes,3,opt,name=placement,proto3" json:"placement,omitempty"`
+	Replicas      int64                  `protobuf:"varint,4,opt,name=replicas,proto3" json:"replicas,omitempty"`
+	Draining      bool                   `protobuf:"varint,5,opt,name=draining,proto3" json:"draining,omitempty"`
+	UptimeMs      int64                  `protobuf:"varint,6,opt,name=uptime_ms,json=uptimeMs,proto3" json:"uptime_ms,omitempty"`
+	Nodes         []*Node                `protobuf:"bytes,7,rep,name=nodes,proto3" json:"nodes,omitempty"` // 接收节点当前看到的所有节点及权重
+	Groups        []*GroupStats          `protobuf:"bytes,8,rep,name=groups,proto3" json:"groups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsResponse) Reset() {
+	*x = StatsResponse{}
+	mi := &file_groupcache_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsResponse) ProtoMessage() {}
+
+func (x *StatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsResponse.ProtoReflect.Descriptor instead.
+func (*StatsResponse) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *StatsResponse) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+func (x *StatsResponse) GetWeight() int64 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetPlacement() string {
+	if x != nil {
+		return x.Placement
+	}
+	return ""
+}
+
+func (x *StatsResponse) GetReplicas() int64 {
+	if x != nil {
+		return x.Replicas
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetDraining() bool {
+	if x != nil {
+		return x.Draining
+	}
+	return false
+}
+
+func (x *StatsResponse) GetUptimeMs() int64 {
+	if x != nil {
+		return x.UptimeMs
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetNodes() []*Node {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *StatsResponse) GetGroups() []*GroupStats {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+type DrainRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DrainRequest) Reset() {
+	*x = DrainRequest{}
+	mi := &file_groupcache_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DrainRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainRequest) ProtoMessage() {}
+
+func (x *DrainRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainRequest.ProtoReflect.Descriptor instead.
+func (*DrainRequest) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{24}
+}
+
+type DrainResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Remaining     int64                  `protobuf:"varint,1,opt,name=remaining,proto3" json:"remaining,omitempty"` // 迁移结束后本节点仍保存的缓存数量
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DrainResponse) Reset() {
+	*x = DrainResponse{}
+	mi := &file_groupcache_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DrainResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainResponse) ProtoMessage() {}
+
+func (x *DrainResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainResponse.ProtoReflect.Descriptor instead.
+func (*DrainResponse) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *DrainResponse) GetRemaining() int64 {
+	if x != nil {
+		return x.Remaining
+	}
+	return 0
+}
+
+type FlushRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlushRequest) Reset() {
+	*x = FlushRequest{}
+	mi := &file_groupcache_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlushRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlushRequest) ProtoMessage() {}
+
+func (x *FlushRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlushRequest.ProtoReflect.Descriptor instead.
+func (*FlushRequest) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *FlushRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+type FlushResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Removed       int64                  `protobuf:"varint,1,opt,name=removed,proto3" json:"removed,omitempty"` // 删除的key数量
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlushResponse) Reset() {
+	*x = FlushResponse{}
+	mi := &file_groupcache_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlushResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlushResponse) ProtoMessage() {}
+
+func (x *FlushResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlushResponse.ProtoReflect.Descriptor instead.
+func (*FlushResponse) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *FlushResponse) GetRemoved() int64 {
+	if x != nil {
+		return x.Removed
+	}
+	return 0
+}
+
+var File_groupcache_proto protoreflect.FileDescriptor
+
+const file_groupcache_proto_rawDesc = "" +
+	"\n" +
+	"\x10groupcache.proto\x12\tfishcache\"4\n" +
+	"\n" +
+	"GetRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\"@\n" +
+	"\vGetResponse\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\fR\x05value\x12\x1b\n" +
+	"\texpire_at\x18\x02 \x01(\x03R\bexpireAt\"g\n" +
+	"\n" +
+	"SetRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\fR\x05value\x12\x1b\n" +
+	"\texpire_at\x18\x04 \x01(\x03R\bexpireAt\"\r\n" +
+	"\vSetResponse\"7\n" +
+	"\rDeleteRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\"\x10\n" +
+	"\x0eDeleteResponse\";\n" +
+	"\x11InvalidateRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\"\x14\n" +
+	"\x12InvalidateResponse\";\n" +
+	"\x0fGetMultiRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x12\n" +
+	"\x04keys\x18\x02 \x03(\tR\x04keys\"\x82\x01\n" +
+	"\bKeyValue\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value\x12\x1b\n" +
+	"\texpire_at\x18\x03 \x01(\x03R\bexpireAt\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12\x1b\n" +
+	"\tnot_found\x18\x05 \x01(\bR\bnotFound\"A\n" +
+	"\x10GetMultiResponse\x12-\n" +
+	"\aentries\x18\x01 \x03(\v2\x13.fishcache.KeyValueR\aentries\"i\n" +
+	"\fHandoffEntry\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\fR\x05value\x12\x1b\n" +
+	"\texpire_at\x18\x04 \x01(\x03R\bexpireAt\"-\n" +
+	"\x0fHandoffResponse\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\x03R\baccepted\"2\n" +
+	"\x04Node\x12\x12\n" +
+	"\x04addr\x18\x01 \x01(\tR\x04addr\x12\x16\n" +
+	"\x06weight\x18\x02 \x01(\x03R\x06weight\"H\n" +
+	"\vPullRequest\x12\x12\n" +
+	"\x04node\x18\x01 \x01(\tR\x04node\x12%\n" +
+	"\x05nodes\x18\x02 \x03(\v2\x0f.fishcache.NodeR\x05nodes\"[\n" +
+	"\x10SubscribeRequest\x12\x16\n" +
+	"\x06groups\x18\x01 \x03(\tR\x06groups\x12\x14\n" +
+	"\x05epoch\x18\x02 \x01(\x04R\x05epoch\x12\x19\n" +
+	"\bfrom_seq\x18\x03 \x01(\x04R\afromSeq\"\x8f\x01\n" +
+	"\fInvalidation\x12\x14\n" +
+	"\x05epoch\x18\x01 \x01(\x04R\x05epoch\x12\x10\n" +
+	"\x03seq\x18\x02 \x01(\x04R\x03seq\x12/\n" +
+	"\x04kind\x18\x03 \x01(\x0e2\x1b.fishcache.InvalidationKindR\x04kind\x12\x14\n" +
+	"\x05group\x18\x04 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x05 \x01(\tR\x03key\"\x13\n" +
+	"\x11ListGroupsRequest\"e\n" +
+	"\tGroupInfo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12'\n" +
+	"\x0feviction_policy\x18\x02 \x01(\tR\x0eevictionPolicy\x12\x1b\n" +
+	"\tmax_bytes\x18\x03 \x01(\x03R\bmaxBytes\"B\n" +
+	"\x12ListGroupsResponse\x12,\n" +
+	"\x06groups\x18\x01 \x03(\v2\x14.fishcache.GroupInfoR\x06groups\"V\n" +
+	"\n" +
+	"CacheStats\x12\x14\n" +
+	"\x05items\x18\x01 \x01(\x03R\x05items\x12\x14\n" +
+	"\x05bytes\x18\x02 \x01(\x03R\x05bytes\x12\x1c\n" +
+	"\tevictions\x18\x03 \x01(\x03R\tevictions\"\xf1\x02\n" +
+	"\n" +
+	"GroupStats\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04gets\x18\x02 \x01(\x03R\x04gets\x12\x12\n" +
+	"\x04hits\x18\x03 \x01(\x03R\x04hits\x12\x19\n" +
+	"\bhot_hits\x18\x04 \x01(\x03R\ahotHits\x12\x16\n" +
+	"\x06misses\x18\x05 \x01(\x03R\x06misses\x12\x14\n" +
+	"\x05loads\x18\x06 \x01(\x03R\x05loads\x12\x1f\n" +
+	"\vlocal_loads\x18\a \x01(\x03R\n" +
+	"localLoads\x12\x1d\n" +
+	"\n" +
+	"peer_loads\x18\b \x01(\x03R\tpeerLoads\x12\x1f\n" +
+	"\vpeer_errors\x18\t \x01(\x03R\n" +
+	"peerErrors\x12)\n" +
+	"\x04main\x18\n" +
+	" \x01(\v2\x15.fishcache.CacheStatsR\x04main\x12'\n" +
+	"\x03hot\x18\v \x01(\v2\x15.fishcache.CacheStatsR\x03hot\x12)\n" +
+	"\x04disk\x18\f \x01(\v2\x15.fishcache.CacheStatsR\x04disk\"\x0e\n" +
+	"\fStatsRequest\"\x84\x02\n" +
+	"\rStatsResponse\x12\x12\n" +
+	"\x04addr\x18\x01 \x01(\tR\x04addr\x12\x16\n" +
+	"\x06weight\x18\x02 \x01(\x03R\x06weight\x12\x1c\n" +
+	"\tplacement\x18\x03 \x01(\tR\tplacement\x12\x1a\n" +
+	"\breplicas\x18\x04 \x01(\x03R\breplicas\x12\x1a\n" +
+	"\bdraining\x18\x05 \x01(\bR\bdraining\x12\x1b\n" +
+	"\tuptime_ms\x18\x06 \x01(\x03R\buptimeMs\x12%\n" +
+	"\x05nodes\x18\a \x03(\v2\x0f.fishcache.NodeR\x05nodes\x12-\n" +
+	"\x06groups\x18\b \x03(\v2\x15.fishcache.GroupStatsR\x06groups\"\x0e\n" +
+	"\fDrainRequest\"-\n" +
+	"\rDrainResponse\x12\x1c\n" +
+	"\tremaining\x18\x01 \x01(\x03R\tremaining\"$\n" +
+	"\fFlushRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\")\n" +
+	"\rFlushResponse\x12\x18\n" +
+	"\aremoved\x18\x01 \x01(\x03R\aremoved*q\n" +
+	"\x10InvalidationKind\x12\x14\n" +
+	"\x10INVALIDATION_SET\x10\x00\x12\x17\n" +
+	"\x13INVALIDATION_DELETE\x10\x01\x12\x16\n" +
+	"\x12INVALIDATION_EVICT\x10\x02\x12\x16\n" +
+	"\x12INVALIDATION_RESET\x10\x032\xa2\x06\n" +
+	"\fCacheService\x126\n" +
+	"\x03Get\x12\x15.fishcache.GetRequest\x1a\x16.fishcache.GetResponse\"\x00\x12E\n" +
+	"\bGetMulti\x12\x1a.fishcache.GetMultiRequest\x1a\x1b.fishcache.GetMultiResponse\"\x00\x126\n" +
+	"\x03Set\x12\x15.fishcache.SetRequest\x1a\x16.fishcache.SetResponse\"\x00\x12?\n" +
+	"\x06Delete\x12\x18.fishcache.DeleteRequest\x1a\x19.fishcache.DeleteResponse\"\x00\x12K\n" +
+	"\n" +
+	"Invalidate\x12\x1c.fishcache.InvalidateRequest\x1a\x1d.fishcache.InvalidateResponse\"\x00\x12B\n" +
+	"\aHandoff\x12\x17.fishcache.HandoffEntry\x1a\x1a.fishcache.HandoffResponse\"\x00(\x01\x12;\n" +
+	"\x04Pull\x12\x16.fishcache.PullRequest\x1a\x17.fishcache.HandoffEntry\"\x000\x01\x12E\n" +
+	"\tSubscribe\x12\x1b.fishcache.SubscribeRequest\x1a\x17.fishcache.Invalidation\"\x000\x01\x12K\n" +
+	"\n" +
+	"ListGroups\x12\x1c.fishcache.ListGroupsRequest\x1a\x1d.fishcache.ListGroupsResponse\"\x00\x12<\n" +
+	"\x05Stats\x12\x17.fishcache.StatsRequest\x1a\x18.fishcache.StatsResponse\"\x00\x12<\n" +
+	"\x05Drain\x12\x17.fishcache.DrainRequest\x1a\x18.fishcache.DrainResponse\"\x00\x12<\n" +
+	"\x05Flush\x12\x17.fishcache.FlushRequest\x1a\x18.fishcache.FlushResponse\"\x00B\x03Z\x01.b\x06proto3"
 
 var (
 	file_groupcache_proto_rawDescOnce sync.Once
@@ -143,19 +1759,78 @@ func file_groupcache_proto_rawDescGZIP() []byte {
 	return file_groupcache_proto_rawDescData
 }
 
-var file_groupcache_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_groupcache_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_groupcache_proto_msgTypes = make([]protoimpl.MessageInfo, 28)
 var file_groupcache_proto_goTypes = []any{
-	(*GetRequest)(nil),  // 0: fishcache.GetRequest
-	(*GetResponse)(nil), // 1: fishcache.GetResponse
+	(InvalidationKind)(0),      // 0: fishcache.InvalidationKind
+	(*GetRequest)(nil),         // 1: fishcache.GetRequest
+	(*GetResponse)(nil),        // 2: fishcache.GetResponse
+	(*SetRequest)(nil),         // 3: fishcache.SetRequest
+	(*SetResponse)(nil),        // 4: fishcache.SetResponse
+	(*DeleteRequest)(nil),      // 5: fishcache.DeleteRequest
+	(*DeleteResponse)(nil),     // 6: fishcache.DeleteResponse
+	(*InvalidateRequest)(nil),  // 7: fishcache.InvalidateRequest
+	(*InvalidateResponse)(nil), // 8: fishcache.InvalidateResponse
+	(*GetMultiRequest)(nil),    // 9: fishcache.GetMultiRequest
+	(*KeyValue)(nil),           // 10: fishcache.KeyValue
+	(*GetMultiResponse)(nil),   // 11: fishcache.GetMultiResponse
+	(*HandoffEntry)(nil),       // 12: fishcache.HandoffEntry
+	(*HandoffResponse)(nil),    // 13: fishcache.HandoffResponse
+	(*Node)(nil),               // 14: fishcache.Node
+	(*PullRequest)(nil),        // 15: fishcache.PullRequest
+	(*SubscribeRequest)(nil),   // 16: fishcache.SubscribeRequest
+	(*Invalidation)(nil),       // 17: fishcache.Invalidation
+	(*ListGroupsRequest)(nil),  // 18: fishcache.ListGroupsRequest
+	(*GroupInfo)(nil),          // 19: fishcache.GroupInfo
+	(*ListGroupsResponse)(nil), // 20: fishcache.ListGroupsResponse
+	(*CacheStats)(nil),         // 21: fishcache.CacheStats
+	(*GroupStats)(nil),         // 22: fishcache.GroupStats
+	(*StatsRequest)(nil),       // 23: fishcache.StatsRequest
+	(*StatsResponse)(nil),      // 24: fishcache.StatsResponse
+	(*DrainRequest)(nil),       // 25: fishcache.DrainRequest
+	(*DrainResponse)(nil),      // 26: fishcache.DrainResponse
+	(*FlushRequest)(nil),       // 27: fishcache.FlushRequest
+	(*FlushResponse)(nil),      // 28: fishcache.FlushResponse
 }
 var file_groupcache_proto_depIdxs = []int32{
-	0, // 0: fishcache.CacheService.Get:input_type -> fishcache.GetRequest
-	1, // 1: fishcache.CacheService.Get:output_type -> fishcache.GetResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	10, // 0: fishcache.GetMultiResponse.entries:type_name -> fishcache.KeyValue
+	14, // 1: fishcache.PullRequest.nodes:type_name -> fishcache.Node
+	0,  // 2: fishcache.Invalidation.kind:type_name -> fishcache.InvalidationKind
+	19, // 3: fishcache.ListGroupsResponse.groups:type_name -> fishcache.GroupInfo
+	21, // 4: fishcache.GroupStats.main:type_name -> fishcache.CacheStats
+	21, // 5: fishcache.GroupStats.hot:type_name -> fishcache.CacheStats
+	21, // 6: fishcache.GroupStats.disk:type_name -> fishcache.CacheStats
+	14, // 7: fishcache.StatsResponse.nodes:type_name -> fishcache.Node
+	22, // 8: fishcache.StatsResponse.groups:type_name -> fishcache.GroupStats
+	1,  // 9: fishcache.CacheService.Get:input_type -> fishcache.GetRequest
+	9,  // 10: fishcache.CacheService.GetMulti:input_type -> fishcache.GetMultiRequest
+	3,  // 11: fishcache.CacheService.Set:input_type -> fishcache.SetRequest
+	5,  // 12: fishcache.CacheService.Delete:input_type -> fishcache.DeleteRequest
+	7,  // 13: fishcache.CacheService.Invalidate:input_type -> fishcache.InvalidateRequest
+	12, // 14: fishcache.CacheService.Handoff:input_type -> fishcache.HandoffEntry
+	15, // 15: fishcache.CacheService.Pull:input_type -> fishcache.PullRequest
+	16, // 16: fishcache.CacheService.Subscribe:input_type -> fishcache.SubscribeRequest
+	18, // 17: fishcache.CacheService.ListGroups:input_type -> fishcache.ListGroupsRequest
+	23, // 18: fishcache.CacheService.Stats:input_type -> fishcache.StatsRequest
+	25, // 19: fishcache.CacheService.Drain:input_type -> fishcache.DrainRequest
+	27, // 20: fishcache.CacheService.Flush:input_type -> fishcache.FlushRequest
+	2,  // 21: fishcache.CacheService.Get:output_type -> fishcache.GetResponse
+	11, // 22: fishcache.CacheService.GetMulti:output_type -> fishcache.GetMultiResponse
+	4,  // 23: fishcache.CacheService.Set:output_type -> fishcache.SetResponse
+	6,  // 24: fishcache.CacheService.Delete:output_type -> fishcache.DeleteResponse
+	8,  // 25: fishcache.CacheService.Invalidate:output_type -> fishcache.InvalidateResponse
+	13, // 26: fishcache.CacheService.Handoff:output_type -> fishcache.HandoffResponse
+	12, // 27: fishcache.CacheService.Pull:output_type -> fishcache.HandoffEntry
+	17, // 28: fishcache.CacheService.Subscribe:output_type -> fishcache.Invalidation
+	20, // 29: fishcache.CacheService.ListGroups:output_type -> fishcache.ListGroupsResponse
+	24, // 30: fishcache.CacheService.Stats:output_type -> fishcache.StatsResponse
+	26, // 31: fishcache.CacheService.Drain:output_type -> fishcache.DrainResponse
+	28, // 32: fishcache.CacheService.Flush:output_type -> fishcache.FlushResponse
+	21, // [21:33] is the sub-list for method output_type
+	9,  // [9:21] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
 }
 
 func init() { file_groupcache_proto_init() }
@@ -168,13 +1843,14 @@ func file_groupcache_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_groupcache_proto_rawDesc), len(file_groupcache_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      1,
+			NumMessages:   28,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_groupcache_proto_goTypes,
 		DependencyIndexes: file_groupcache_proto_depIdxs,
+		EnumInfos:         file_groupcache_proto_enumTypes,
 		MessageInfos:      file_groupcache_proto_msgTypes,
 	}.Build()
 	File_groupcache_proto = out.File
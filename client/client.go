@@ -0,0 +1,419 @@
+// Package client 是 FishCache 的Go客户端。
+//
+// Client 与服务端订阅相同的服务发现（静态节点、节点文件或etcd），并使用与服务端相同的数据分布算法
+// 在本地维护节点定位器，请求直接发送给key的归属节点，而不必经由任意节点转发。
+// 归属节点不可达时按优先顺序重试下一个节点，由其转发给归属节点或从其副本读取。
+package client
+
+import (
+	pb "FishCache/api/groupcachepb"
+	"FishCache/consistent"
+	"FishCache/internal/cache"
+	"FishCache/internal/discovery"
+	"FishCache/internal/discovery/etcd"
+	"FishCache/internal/discovery/file"
+	"FishCache/internal/discovery/static"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	defaultTimeout  = 10 * time.Second // 默认的单次请求超时时间
+	defaultRetries  = 2                // 默认的重试次数
+	defaultPoolSize = 1                // 默认的每个节点的连接数
+)
+
+// 数据分布算法，必须与服务端的 -placement 一致
+const (
+	PlacementRing       = string(cache.PlacementRing)
+	PlacementRendezvous = string(cache.PlacementRendezvous)
+	PlacementJump       = string(cache.PlacementJump)
+	PlacementMaglev     = string(cache.PlacementMaglev)
+)
+
+var (
+	// ErrNotFound 表示key在数据源中不存在或 Group 不存在，与服务端的 cache.ErrNotFound 相同
+	ErrNotFound = cache.ErrNotFound
+	// ErrUnavailable 表示节点不可达或响应超时，重试所有候选节点后仍失败时返回
+	ErrUnavailable = cache.ErrPeerUnavailable
+	// ErrNoNodes 表示服务发现中没有任何节点
+	ErrNoNodes = errors.New("no cache nodes available")
+	// ErrClosed 表示 Client 已关闭
+	ErrClosed = errors.New("client is closed")
+)
+
+// Node 服务发现中的一个缓存节点，Weight 与节点容量成正比，未知时使用 DefaultWeight
+type Node = discovery.Node
+
+// DefaultWeight 节点的默认权重，与服务端的 -weight 默认值相同
+const DefaultWeight = discovery.DefaultWeight
+
+// Discoverer 是 Client 使用的服务发现，只需要查询和监听节点，可通过 WithDiscoverer 接入自定义的注册中心
+type Discoverer interface {
+	// Watch 节点列表可能发生变化时向返回的通道发送通知，连续的变化可能合并为一次通知；ctx 取消后通道关闭
+	Watch(ctx context.Context) (<-chan struct{}, error)
+	// List 返回当前所有节点
+	List(ctx context.Context) ([]Node, error)
+}
+
+// Client 是并发安全的 FishCache 客户端，使用完毕后需调用 Close
+type Client struct {
+	discoverer     Discoverer
+	ownsDiscoverer bool // discoverer 由 Client 创建，关闭时一并关闭
+	peers          []string
+	peersFile      string
+	etcd           *consistent.Etcd
+	placement      string
+	timeout        time.Duration
+	retries        int
+	poolSize       int
+	creds          credentials.TransportCredentials
+	near           *nearCache // 近端缓存，为nil时不启用
+
+	mu      sync.RWMutex
+	locator cache.NodeLocator    // 每次节点变化时重建，构建后不再修改
+	pools   map[string]*connPool // 每个节点的连接池
+	closed  bool
+
+	cancel context.CancelFunc
+	done   chan struct{} // 节点监听协程退出时关闭
+}
+
+// Option 用于定制 Client 的可选配置
+type Option func(*Client)
+
+// WithPeers 使用固定的节点列表，与服务端的 -peers 一致
+func WithPeers(addrs ...string) Option {
+	return func(c *Client) {
+		c.peers = addrs
+	}
+}
+
+// WithPeersFile 从JSON或YAML节点文件中读取节点，文件修改后自动生效，与服务端的 -peers-file 一致
+func WithPeersFile(path string) Option {
+	return func(c *Client) {
+		c.peersFile = path
+	}
+}
+
+// WithEtcd 从etcd中获取并监听节点，与服务端的 -etcd 和 -service 一致
+func WithEtcd(conf consistent.Etcd) Option {
+	return func(c *Client) {
+		c.etcd = &conf
+	}
+}
+
+// WithDiscoverer 使用已有的服务发现，优先于其他节点来源，Close 时不会关闭 d
+func WithDiscoverer(d Discoverer) Option {
+	return func(c *Client) {
+		c.discoverer = d
+	}
+}
+
+// WithPlacement 设置数据分布算法，必须与服务端一致，默认为一致性哈希环
+func WithPlacement(placement string) Option {
+	return func(c *Client) {
+		c.placement = placement
+	}
+}
+
+// WithTimeout 设置单次请求的超时时间，每次重试重新计时，默认为10秒
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+	}
+}
+
+// WithRetries 设置节点不可达时按优先顺序重试的节点数，默认为2，0表示不重试
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		if n >= 0 {
+			c.retries = n
+		}
+	}
+}
+
+// WithPoolSize 设置到每个节点的连接数，请求在连接间轮询，默认为1
+func WithPoolSize(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.poolSize = n
+		}
+	}
+}
+
+// WithNearCache 启用进程内的近端缓存，适合读多写少的key。近端缓存最多保存 maxBytes 字节，
+// 每条缓存最多保存 staleness（<=0 时为5秒）。客户端订阅每个节点的失效事件，key在归属节点上
+// 被写入、删除或淘汰时从近端缓存中删除；与节点的订阅断开期间，读到的值最多陈旧 staleness。
+func WithNearCache(maxBytes int64, staleness time.Duration) Option {
+	return func(c *Client) {
+		if maxBytes <= 0 {
+			return
+		}
+		if staleness <= 0 {
+			staleness = defaultNearStaleness
+		}
+		c.near = newNearCache(maxBytes, staleness)
+	}
+}
+
+// WithTLS 使用TLS连接节点，服务端开启 -tls-client-auth 时 conf 中需包含客户端证书
+func WithTLS(conf *tls.Config) Option {
+	return func(c *Client) {
+		c.creds = credentials.NewTLS(conf)
+	}
+}
+
+// WithCredentials 使用给定的gRPC传输凭证连接节点，可以在每次握手时更新证书，并按节点地址校验服务端证书
+func WithCredentials(creds credentials.TransportCredentials) Option {
+	return func(c *Client) {
+		c.creds = creds
+	}
+}
+
+// New 创建客户端，获取一次节点列表后返回，之后在后台监听节点变化。
+// 节点来源的优先顺序为 WithDiscoverer、WithEtcd、WithPeersFile、WithPeers。
+func New(opts ...Option) (*Client, error) {
+	c := &Client{
+		placement: PlacementRing,
+		timeout:   defaultTimeout,
+		retries:   defaultRetries,
+		poolSize:  defaultPoolSize,
+		creds:     insecure.NewCredentials(),
+		pools:     make(map[string]*connPool),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	// 提前校验分布算法
+	if _, err := cache.NewNodeLocator(cache.PlacementType(c.placement)); err != nil {
+		return nil, err
+	}
+	if err := c.openDiscoverer(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	updates, err := c.discoverer.Watch(ctx)
+	if err == nil {
+		err = c.refresh(ctx)
+	}
+	if err != nil {
+		cancel()
+		c.closeDiscoverer()
+		return nil, err
+	}
+	go c.watch(ctx, updates)
+	return c, nil
+}
+
+// 根据配置创建服务发现
+func (c *Client) openDiscoverer() error {
+	var err error
+	switch {
+	case c.discoverer != nil:
+		return nil
+	case c.etcd != nil:
+		c.discoverer, err = etcd.New(*c.etcd)
+	case c.peersFile != "":
+		c.discoverer, err = file.New(c.peersFile, 0)
+	case len(c.peers) != 0:
+		c.discoverer = static.New(c.peers)
+	default:
+		return errors.New("no discovery source, use WithPeers, WithPeersFile, WithEtcd or WithDiscoverer")
+	}
+	if err != nil {
+		return fmt.Errorf("create discoverer failed: %w", err)
+	}
+	c.ownsDiscoverer = true
+	return nil
+}
+
+func (c *Client) closeDiscoverer() {
+	if closer, ok := c.discoverer.(io.Closer); ok && c.ownsDiscoverer {
+		if err := closer.Close(); err != nil {
+			log.Errorf("close discoverer failed: %v", err)
+		}
+	}
+}
+
+// 收到节点变化通知时重建节点定位器，获取节点失败时保留当前的节点
+func (c *Client) watch(ctx context.Context, updates <-chan struct{}) {
+	defer close(c.done)
+	for {
+		select {
+		case _, ok := <-updates:
+			if !ok {
+				return
+			}
+			if err := c.refresh(ctx); err != nil {
+				log.Errorf("refresh cache nodes failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 获取节点列表，重建节点定位器并更新连接池
+func (c *Client) refresh(ctx context.Context) error {
+	nodes, err := c.discoverer.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list cache nodes failed: %w", err)
+	}
+	weights := make(map[string]int, len(nodes))
+	for _, node := range nodes {
+		weights[node.Addr] = max(node.Weight, 1)
+	}
+	locator, _ := cache.NewNodeLocator(cache.PlacementType(c.placement))
+	locator.SetNodes(weights)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	pools := make(map[string]*connPool, len(weights))
+	for addr := range weights {
+		// 复用仍存在的节点的连接
+		if pool, ok := c.pools[addr]; ok {
+			pools[addr] = pool
+			continue
+		}
+		pool, err := newConnPool(addr, c.poolSize, c.creds)
+		if err != nil {
+			log.Errorf("create connections to %s failed: %v", addr, err)
+			continue
+		}
+		if c.near != nil {
+			var subCtx context.Context
+			subCtx, pool.cancel = context.WithCancel(ctx)
+			go c.subscribe(subCtx, pool)
+		}
+		pools[addr] = pool
+	}
+	// 关闭已离开的节点的连接
+	for addr, pool := range c.pools {
+		if _, ok := pools[addr]; !ok {
+			pool.close()
+		}
+	}
+	c.locator, c.pools = locator, pools
+	return nil
+}
+
+// Nodes 返回当前的所有节点地址
+func (c *Client) Nodes() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	nodes := make([]string, 0, len(c.pools))
+	for addr := range c.pools {
+		nodes = append(nodes, addr)
+	}
+	return nodes
+}
+
+// Owners 按优先顺序返回负责key的前n个节点地址，第一个为归属节点，之后为副本或重试时的候选节点
+func (c *Client) Owners(key string, n int) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed || c.locator == nil {
+		return nil
+	}
+	return c.locator.GetNodes(key, n)
+}
+
+// Close 停止监听节点变化并关闭所有连接，正在进行的请求会失败
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	for _, pool := range c.pools {
+		pool.close()
+	}
+	c.pools = nil
+	c.mu.Unlock()
+
+	c.cancel()
+	<-c.done
+	c.closeDiscoverer()
+	c.near.close()
+	return nil
+}
+
+// 按优先顺序返回处理key的候选节点及其连接池，第一个为归属节点
+func (c *Client) candidates(key string) ([]*connPool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+	nodes := c.locator.GetNodes(key, c.retries+1)
+	pools := make([]*connPool, 0, len(nodes))
+	for _, node := range nodes {
+		if pool, ok := c.pools[node]; ok {
+			pools = append(pools, pool)
+		}
+	}
+	if len(pools) == 0 {
+		return nil, ErrNoNodes
+	}
+	return pools, nil
+}
+
+// 每个节点的一组连接，grpc.NewClient 不会立即拨号，连接在首次请求时建立并自动重连
+type connPool struct {
+	addr    string
+	conns   []*grpc.ClientConn
+	clients []pb.CacheServiceClient
+	next    atomic.Uint32
+	cancel  context.CancelFunc // 停止订阅失效事件，未订阅时为nil
+}
+
+func newConnPool(addr string, size int, creds credentials.TransportCredentials) (*connPool, error) {
+	p := &connPool{addr: addr}
+	for i := 0; i < size; i++ {
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+		p.clients = append(p.clients, pb.NewCacheServiceClient(conn))
+	}
+	return p, nil
+}
+
+// 轮询选择一个连接
+func (p *connPool) client() pb.CacheServiceClient {
+	return p.clients[int(p.next.Add(1))%len(p.clients)]
+}
+
+func (p *connPool) close() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	for _, conn := range p.conns {
+		if err := conn.Close(); err != nil {
+			log.Errorf("close connection to %s failed: %v", p.addr, err)
+		}
+	}
+}
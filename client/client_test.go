@@ -0,0 +1,235 @@
+package client
+
+import (
+	"FishCache/internal/cache"
+	"FishCache/internal/discovery/static"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// 启动一个缓存节点，返回其地址
+func startServer(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	s, err := cache.NewRPCServer(addr, static.New(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.RunServer()
+	return addr
+}
+
+func TestClient(t *testing.T) {
+	cache.NewGroup("clientGroup", 2<<10, cache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "Tom" {
+			return []byte("630"), nil
+		}
+		return nil, fmt.Errorf("%s: %w", key, cache.ErrNotFound)
+	}))
+	addr := startServer(t)
+	// 端口1上没有服务，归属该节点的key需重试下一个节点
+	const deadAddr = "127.0.0.1:1"
+	c, err := New(WithPeers(deadAddr, addr), WithRetries(1), WithTimeout(time.Second), WithPoolSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	// 等待节点开始监听
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err = c.Get(ctx, "clientGroup", "Tom"); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Get(Tom) = %v", err)
+	}
+
+	// 找到归属两个节点的key
+	var deadKey, liveKey string
+	for i := 0; deadKey == "" || liveKey == ""; i++ {
+		key := fmt.Sprintf("key%d", i)
+		pools, err := c.candidates(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pools[0].addr == deadAddr {
+			deadKey = key
+		} else {
+			liveKey = key
+		}
+	}
+	if owners := c.Owners(deadKey, 2); len(owners) != 2 || owners[0] != deadAddr || owners[1] != addr {
+		t.Fatalf("Owners(%s) = %v", deadKey, owners)
+	}
+	for _, key := range []string{deadKey, liveKey} {
+		if err := c.Set(ctx, "clientGroup", key, []byte("v-"+key), time.Minute); err != nil {
+			t.Fatalf("Set(%s) = %v", key, err)
+		}
+		if v, err := c.Get(ctx, "clientGroup", key); err != nil || string(v) != "v-"+key {
+			t.Fatalf("Get(%s) = %q, %v", key, v, err)
+		}
+	}
+
+	results := c.GetMulti(ctx, "clientGroup", []string{deadKey, liveKey, "Tom", "missing", ""})
+	if r := results[deadKey]; r.Err != nil || string(r.Value) != "v-"+deadKey || r.ExpireAt.IsZero() {
+		t.Fatalf("GetMulti[%s] = %+v", deadKey, r)
+	}
+	if r := results[liveKey]; r.Err != nil || string(r.Value) != "v-"+liveKey {
+		t.Fatalf("GetMulti[%s] = %+v", liveKey, r)
+	}
+	if r := results["Tom"]; r.Err != nil || string(r.Value) != "630" || !r.ExpireAt.IsZero() {
+		t.Fatalf("GetMulti[Tom] = %+v", r)
+	}
+	if r := results["missing"]; !errors.Is(r.Err, ErrNotFound) {
+		t.Fatalf("GetMulti[missing] = %+v", r)
+	}
+	if r := results[""]; !errors.Is(r.Err, ErrEmptyKey) {
+		t.Fatalf("GetMulti[\"\"] = %+v", r)
+	}
+
+	if err := c.Delete(ctx, "clientGroup", liveKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "clientGroup", liveKey); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if _, err := c.Get(ctx, "noSuchGroup", "Tom"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(noSuchGroup) = %v, want ErrNotFound", err)
+	}
+
+	// 不重试时归属故障节点的key不可用
+	noRetry, err := New(WithPeers(deadAddr, addr), WithRetries(0), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer noRetry.Close()
+	if _, err := noRetry.Get(ctx, "clientGroup", deadKey); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Get without retry = %v, want ErrUnavailable", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "clientGroup", "Tom"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Get after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestNew_invalid(t *testing.T) {
+	if _, err := New(); err == nil {
+		t.Fatal("New without discovery source should fail")
+	}
+	if _, err := New(WithPeers("127.0.0.1:1"), WithPlacement("unknown")); err == nil {
+		t.Fatal("New with unknown placement should fail")
+	}
+}
+
+// fixedDiscoverer 是返回固定节点的自定义服务发现
+type fixedDiscoverer []Node
+
+func (d fixedDiscoverer) Watch(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (d fixedDiscoverer) List(context.Context) ([]Node, error) {
+	return d, nil
+}
+
+func TestClient_customDiscoverer(t *testing.T) {
+	d := fixedDiscoverer{{Addr: "127.0.0.1:1", Weight: DefaultWeight}, {Addr: "127.0.0.1:2", Weight: DefaultWeight}}
+	c, err := New(WithDiscoverer(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if owners := c.Owners("Tom", 3); len(owners) != 2 {
+		t.Fatalf("Owners(Tom) = %v, want both nodes", owners)
+	}
+}
+
+func TestClient_nearCache(t *testing.T) {
+	group := cache.NewGroup("nearGroup", 2<<10, cache.GetterFunc(func(key string) ([]byte, error) {
+		return []byte("loaded-" + key), nil
+	}))
+	addr := startServer(t)
+	c, err := New(WithPeers(addr), WithNearCache(1<<20, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	writer, err := New(WithPeers(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	ctx := context.Background()
+
+	// 等待近端缓存命中：节点开始监听后，订阅建立时的 RESET 可能清空较早写入的近端缓存
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		gets := group.Stats.Gets.Load()
+		v, err := c.Get(ctx, "nearGroup", "k")
+		if err == nil && string(v) != "loaded-k" {
+			t.Fatalf("Get(k) = %q", v)
+		}
+		if err == nil && group.Stats.Gets.Load() == gets {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("near cache never hit, last error %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// 其他客户端写入后，归属节点推送失效事件，近端缓存在最大陈旧时间之前失效
+	if err := writer.Set(ctx, "nearGroup", "k", []byte("v2"), 0); err != nil {
+		t.Fatal(err)
+	}
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		v, err := c.Get(ctx, "nearGroup", "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(v) == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("near cache not invalidated, Get(k) = %q", v)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// 本客户端的写入立即删除近端缓存
+	if err := c.Set(ctx, "nearGroup", "k", []byte("v3"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	results := c.GetMulti(ctx, "nearGroup", []string{"k"})
+	if r := results["k"]; r.Err != nil || string(r.Value) != "v3" || r.ExpireAt.IsZero() {
+		t.Fatalf("GetMulti after Set = %+v", r)
+	}
+	if err := c.Delete(ctx, "nearGroup", "k"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get(ctx, "nearGroup", "k"); err != nil || string(v) != "loaded-k" {
+		t.Fatalf("Get after Delete = %q, %v", v, err)
+	}
+}
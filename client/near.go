@@ -0,0 +1,164 @@
+package client
+
+import (
+	pb "FishCache/api/groupcachepb"
+	"FishCache/internal/cache/eviction"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// 默认的近端缓存最大陈旧时间
+	defaultNearStaleness = 5 * time.Second
+	// 订阅断开后重连的最大等待时间
+	maxSubscribeBackoff = 5 * time.Second
+)
+
+// 近端缓存中的一条缓存
+type nearEntry struct {
+	value    []byte
+	expireAt time.Time // 值本身的过期时间，零值表示永不过期
+	evictAt  time.Time // 从近端缓存中删除的时间，不晚于 expireAt 和最大陈旧时间
+}
+
+func (e nearEntry) Len() int {
+	return len(e.value)
+}
+
+// ExpireAt 实现 eviction.Expirable
+func (e nearEntry) ExpireAt() time.Time {
+	return e.evictAt
+}
+
+// nearCache 是进程内的LRU缓存，由各节点推送的失效事件保持一致。
+// 订阅断开期间无法收到失效事件，此时缓存最多陈旧 staleness。
+type nearCache struct {
+	maxBytes  int64
+	staleness time.Duration
+
+	mu     sync.RWMutex
+	policy eviction.Policy // RESET 时整体替换
+	// 每次失效时递增，读取远程节点期间发生过失效时不写入近端缓存，避免保存失效前读到的旧值
+	gen atomic.Uint64
+}
+
+func newNearCache(maxBytes int64, staleness time.Duration) *nearCache {
+	n := &nearCache{maxBytes: maxBytes, staleness: staleness}
+	n.policy = n.newPolicy()
+	return n
+}
+
+func (n *nearCache) newPolicy() eviction.Policy {
+	policy, _ := eviction.New(eviction.PolicyLRU, n.maxBytes, nil)
+	return policy
+}
+
+// group 和key之间以0分隔，Group 名称中不应包含0
+func nearKey(group, key string) string {
+	return group + "\x00" + key
+}
+
+func (n *nearCache) current() eviction.Policy {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.policy
+}
+
+// 返回值的副本及其过期时间
+func (n *nearCache) get(group, key string) ([]byte, time.Time, bool) {
+	if n == nil {
+		return nil, time.Time{}, false
+	}
+	v, _, ok := n.current().Get(nearKey(group, key))
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	entry := v.(nearEntry)
+	return append([]byte(nil), entry.value...), entry.expireAt, true
+}
+
+// 保存从远程节点读到的值，gen 为读取前的 n.gen
+func (n *nearCache) add(group, key string, value []byte, expireAt time.Time, gen uint64) {
+	if n == nil || n.gen.Load() != gen {
+		return
+	}
+	evictAt := time.Now().Add(n.staleness)
+	if !expireAt.IsZero() && expireAt.Before(evictAt) {
+		evictAt = expireAt
+	}
+	entry := nearEntry{value: append([]byte(nil), value...), expireAt: expireAt, evictAt: evictAt}
+	n.current().Add(nearKey(group, key), entry)
+}
+
+func (n *nearCache) remove(group, key string) {
+	if n == nil {
+		return
+	}
+	n.gen.Add(1)
+	n.current().Remove(nearKey(group, key))
+}
+
+// 丢弃所有缓存
+func (n *nearCache) reset() {
+	n.gen.Add(1)
+	n.mu.Lock()
+	old := n.policy
+	n.policy = n.newPolicy()
+	n.mu.Unlock()
+	old.Stop()
+}
+
+// 读取远程节点前记录当前的失效计数
+func (n *nearCache) generation() uint64 {
+	if n == nil {
+		return 0
+	}
+	return n.gen.Load()
+}
+
+func (n *nearCache) close() {
+	if n == nil {
+		return
+	}
+	n.current().Stop()
+}
+
+// 处理一条失效事件
+func (n *nearCache) apply(event *pb.Invalidation) {
+	if event.Kind == pb.InvalidationKind_INVALIDATION_RESET {
+		n.reset()
+		return
+	}
+	n.remove(event.Group, event.Key)
+}
+
+// 订阅节点的失效事件直到 ctx 取消，断开后按纪元和序号续传，无法续传时节点会先发送 RESET
+func (c *Client) subscribe(ctx context.Context, pool *connPool) {
+	var epoch, seq uint64
+	backoff := 100 * time.Millisecond
+	for {
+		stream, err := pool.client().Subscribe(ctx, &pb.SubscribeRequest{Epoch: epoch, FromSeq: seq})
+		for err == nil {
+			var event *pb.Invalidation
+			if event, err = stream.Recv(); err == nil {
+				c.near.apply(event)
+				epoch, seq = event.Epoch, event.Seq
+				backoff = 100 * time.Millisecond
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Debugf("subscription to %s broken, retry in %v: %v", pool.addr, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxSubscribeBackoff)
+	}
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	pb "FishCache/api/groupcachepb"
+	"FishCache/internal/cache"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrEmptyKey 表示请求的key为空
+var ErrEmptyKey = cache.ErrEmptyKey
+
+// Result 是 GetMulti 中单个key的结果
+type Result struct {
+	Value    []byte
+	ExpireAt time.Time // 过期时间，零值表示永不过期
+	Err      error
+}
+
+// Get 读取缓存，启用近端缓存时优先从近端缓存读取；否则从key的归属节点读取，未命中时由归属节点从数据源加载。
+// key不存在时返回 ErrNotFound
+func (c *Client) Get(ctx context.Context, group, key string) ([]byte, error) {
+	if value, _, ok := c.near.get(group, key); ok {
+		return value, nil
+	}
+	gen := c.near.generation()
+	var value []byte
+	err := c.do(ctx, key, func(ctx context.Context, client pb.CacheServiceClient) error {
+		resp, err := client.Get(ctx, &pb.GetRequest{Group: group, Key: key})
+		if err != nil {
+			return err
+		}
+		value = resp.Value
+		c.near.add(group, key, value, expireAtFromMillis(resp.ExpireAt), gen)
+		return nil
+	})
+	return value, err
+}
+
+// Set 写入缓存，ttl<=0 表示永不过期
+func (c *Client) Set(ctx context.Context, group, key string, value []byte, ttl time.Duration) error {
+	var expireAt int64
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl).UnixMilli()
+	}
+	// 无论成功与否都删除近端缓存，写入失败时节点上的值也可能已经改变
+	defer c.near.remove(group, key)
+	return c.do(ctx, key, func(ctx context.Context, client pb.CacheServiceClient) error {
+		_, err := client.Set(ctx, &pb.SetRequest{Group: group, Key: key, Value: value, ExpireAt: expireAt})
+		return err
+	})
+}
+
+// Delete 删除缓存
+func (c *Client) Delete(ctx context.Context, group, key string) error {
+	defer c.near.remove(group, key)
+	return c.do(ctx, key, func(ctx context.Context, client pb.CacheServiceClient) error {
+		_, err := client.Delete(ctx, &pb.DeleteRequest{Group: group, Key: key})
+		return err
+	})
+}
+
+// GetMulti 批量读取缓存，近端缓存未命中的key按归属节点分组，每个节点只发起一次批量请求并行获取。
+// 返回每个key各自的值或错误，key不存在时为 ErrNotFound；节点不可达时其中的key按优先顺序重试下一个节点。
+func (c *Client) GetMulti(ctx context.Context, group string, keys []string) map[string]Result {
+	results := make(map[string]Result, len(keys))
+	gen := c.near.generation()
+	candidates := make(map[string][]*connPool, len(keys))
+	var pending []string
+	for _, key := range keys {
+		if _, ok := results[key]; ok {
+			continue
+		}
+		if key == "" {
+			results[key] = Result{Err: ErrEmptyKey}
+			continue
+		}
+		if value, expireAt, ok := c.near.get(group, key); ok {
+			results[key] = Result{Value: value, ExpireAt: expireAt}
+			continue
+		}
+		pools, err := c.candidates(key)
+		results[key] = Result{Err: err}
+		if err == nil {
+			candidates[key] = pools
+			pending = append(pending, key)
+		}
+	}
+
+	// 每一轮将待获取的key发送给各自的第 attempt 个候选节点，节点不可达的key留到下一轮
+	for attempt := 0; len(pending) > 0; attempt++ {
+		byNode := make(map[*connPool][]string)
+		for _, key := range pending {
+			if pools := candidates[key]; attempt < len(pools) {
+				byNode[pools[attempt]] = append(byNode[pools[attempt]], key)
+			}
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var failed []string
+		for pool, nodeKeys := range byNode {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var resp *pb.GetMultiResponse
+				err := c.call(ctx, pool, func(ctx context.Context, client pb.CacheServiceClient) error {
+					var err error
+					resp, err = client.GetMulti(ctx, &pb.GetMultiRequest{Group: group, Keys: nodeKeys})
+					return err
+				})
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					for _, key := range nodeKeys {
+						results[key] = Result{Err: err}
+					}
+					if errors.Is(err, ErrUnavailable) {
+						failed = append(failed, nodeKeys...)
+					}
+					return
+				}
+				for _, key := range nodeKeys {
+					results[key] = Result{Err: fmt.Errorf("%s: no entry for %s in response", pool.addr, key)}
+				}
+				for _, entry := range resp.Entries {
+					result := entryResult(entry)
+					results[entry.Key] = result
+					if result.Err == nil {
+						c.near.add(group, entry.Key, result.Value, result.ExpireAt, gen)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		pending = failed
+	}
+	return results
+}
+
+func entryResult(entry *pb.KeyValue) Result {
+	switch {
+	case entry.NotFound:
+		return Result{Err: fmt.Errorf("%w: %s", ErrNotFound, entry.Error)}
+	case entry.Error != "":
+		return Result{Err: errors.New(entry.Error)}
+	}
+	return Result{Value: entry.Value, ExpireAt: expireAtFromMillis(entry.ExpireAt)}
+}
+
+// 将unix毫秒时间戳转换为过期时间，0 表示永不过期
+func expireAtFromMillis(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// 按优先顺序将请求发送给key的候选节点，节点不可达时重试下一个节点
+func (c *Client) do(ctx context.Context, key string, fn func(ctx context.Context, client pb.CacheServiceClient) error) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	pools, err := c.candidates(key)
+	if err != nil {
+		return err
+	}
+	for _, pool := range pools {
+		if err = c.call(ctx, pool, fn); !errors.Is(err, ErrUnavailable) {
+			return err
+		}
+	}
+	return err
+}
+
+// 在调用方 ctx 的基础上为单次请求设置超时时间，并将RPC错误转换为本包的错误
+func (c *Client) call(parent context.Context, pool *connPool, fn func(ctx context.Context, client pb.CacheServiceClient) error) error {
+	ctx, cancel := context.WithTimeout(parent, c.timeout)
+	defer cancel()
+
+	err := fn(ctx, pool.client())
+	switch {
+	case err == nil:
+		return nil
+	case parent.Err() != nil:
+		// 调用方已取消或超时，不再重试
+		return fmt.Errorf("%w: %v", parent.Err(), err)
+	}
+	switch status.Code(err) {
+	case codes.NotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, status.Convert(err).Message())
+	case codes.InvalidArgument:
+		return fmt.Errorf("%w: %s", ErrEmptyKey, status.Convert(err).Message())
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return fmt.Errorf("%w: %s: %v", ErrUnavailable, pool.addr, err)
+	default:
+		return fmt.Errorf("%s: %w", pool.addr, err)
+	}
+}
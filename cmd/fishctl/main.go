@@ -0,0 +1,508 @@
+// fishctl 是 FishCache 集群的命令行管理工具，通过gRPC访问缓存节点。
+//
+// 节点来源与缓存节点相同：-etcd、-peers-file 或 -peers，读写key时与 client 包一样直接请求归属节点，
+// 管理命令（stats、drain、flush 等）直接发送给指定的节点。
+//
+//	fishctl -peers 127.0.0.1:23333 set -ttl 1m scores Tom 640
+//	fishctl -etcd 127.0.0.1:2379 owner Tom
+//	fishctl -etcd 127.0.0.1:2379 drain 127.0.0.1:23334
+package main
+
+import (
+	pb "FishCache/api/groupcachepb"
+	"FishCache/client"
+	"FishCache/consistent"
+	"FishCache/internal/discovery"
+	"FishCache/internal/discovery/etcd"
+	"FishCache/internal/discovery/file"
+	"FishCache/internal/discovery/static"
+	"FishCache/internal/tlsutil"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// 子命令
+type command struct {
+	usage string
+	help  string
+	run   func(c *ctl, args []string) error
+}
+
+var commands map[string]command
+
+// 命令的处理函数会引用 commands 输出用法，需在 init 中构建
+func init() {
+	commands = map[string]command{
+		"get":    {"get <group> <key>", "print the value of a key", (*ctl).get},
+		"set":    {"set [-ttl duration] <group> <key> <value>", "write a key", (*ctl).set},
+		"delete": {"delete <group> <key>", "delete a key", (*ctl).delete},
+		"groups": {"groups [node]", "list the groups of a node", (*ctl).groups},
+		"owner":  {"owner [-n count] <key>", "show the nodes owning a key in priority order", (*ctl).owner},
+		"stats":  {"stats [node...]", "dump stats of the given nodes, all nodes if empty", (*ctl).stats},
+		"drain":  {"drain <node>", "hand off all keys of a node and remove it from the cluster", (*ctl).drain},
+		"flush":  {"flush <group> [node...]", "remove all keys of a group on the given nodes, all nodes if empty", (*ctl).flush},
+		"watch":  {"watch", "print membership changes until interrupted", (*ctl).watch},
+	}
+}
+
+// 命令执行时的上下文
+type ctl struct {
+	ctx        context.Context
+	discoverer discovery.Discoverer
+	placement  string
+	timeout    time.Duration
+	creds      credentials.TransportCredentials // 为nil时使用明文
+}
+
+func main() {
+	var peers []string
+	var peersFile string
+	var etcdServersIP []string
+	var etcdServiceName string
+	var etcdTLS tlsutil.Config
+	var peerTLS tlsutil.Config
+	c := &ctl{}
+	flag.Func("peers", "A list of peers separated by commas", func(s string) error {
+		peers = strings.Split(s, ",")
+		return nil
+	})
+	flag.Func("etcd", "etcd servers separated by commas", func(s string) error {
+		etcdServersIP = strings.Split(s, ",")
+		return nil
+	})
+	flag.StringVar(&peersFile, "peers-file", "", "JSON or YAML file listing peers")
+	flag.StringVar(&etcdServiceName, "service", consistent.DefaultServiceName, "service name registered in etcd")
+	flag.StringVar(&c.placement, "placement", client.PlacementRing, "key placement of the cluster: ring, rendezvous, jump or maglev")
+	flag.DurationVar(&c.timeout, "timeout", 10*time.Second, "timeout of a single request")
+	flag.StringVar(&peerTLS.CertFile, "tls-cert", "", "PEM client certificate, for clusters requiring mutual TLS")
+	flag.StringVar(&peerTLS.KeyFile, "tls-key", "", "PEM private key of -tls-cert")
+	flag.StringVar(&peerTLS.CAFile, "tls-ca", "", "PEM CA verifying nodes, enables TLS")
+	flag.StringVar(&etcdTLS.CertFile, "etcd-cert", "", "PEM client certificate for etcd")
+	flag.StringVar(&etcdTLS.KeyFile, "etcd-key", "", "PEM private key of -etcd-cert")
+	flag.StringVar(&etcdTLS.CAFile, "etcd-ca", "", "PEM CA verifying etcd, enables TLS to etcd")
+	flag.StringVar(&etcdTLS.ServerName, "etcd-server-name", "", "name in the etcd server certificate, required when -etcd lists IPs")
+	flag.Usage = usage
+	flag.Parse()
+
+	// 命令行工具只输出警告，避免干扰命令的输出
+	log.SetOutput(os.Stderr)
+	log.SetLevel(log.WarnLevel)
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fatalf("unknown command %q, run fishctl -h for usage", flag.Arg(0))
+	}
+
+	if peerTLS.Enabled() {
+		reloader, err := tlsutil.NewReloader(peerTLS)
+		if err != nil {
+			fatalf("load tls certificates: %v", err)
+		}
+		c.creds = reloader.Credentials()
+	}
+
+	// 节点来源的优先顺序与缓存节点相同
+	switch {
+	case len(etcdServersIP) != 0:
+		etcdConf := consistent.Etcd{Address: etcdServersIP, Timeout: 5 * time.Second, ServiceName: etcdServiceName}
+		if etcdTLS.Enabled() {
+			reloader, err := tlsutil.NewReloader(etcdTLS)
+			if err != nil {
+				fatalf("load etcd tls certificates: %v", err)
+			}
+			etcdConf.TLS = reloader.ClientConfig()
+		}
+		d, err := etcd.New(etcdConf)
+		if err != nil {
+			fatalf("connect to etcd: %v", err)
+		}
+		defer d.Close()
+		c.discoverer = d
+	case peersFile != "":
+		d, err := file.New(peersFile, 0)
+		if err != nil {
+			fatalf("read peers file: %v", err)
+		}
+		c.discoverer = d
+	case len(peers) != 0:
+		c.discoverer = static.New(peers)
+	default:
+		fatalf("one of -etcd, -peers-file or -peers is required")
+	}
+
+	// 收到中断信号时取消正在执行的命令
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	c.ctx = ctx
+
+	if err := cmd.run(c, flag.Args()[1:]); err != nil {
+		stop()
+		fatalf("%s: %v", flag.Arg(0), err)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: fishctl [flags] <command> [args]\n\nCommands:\n")
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, name := range slices.Sorted(maps.Keys(commands)) {
+		fmt.Fprintf(w, "  %s\t%s\n", commands[name].usage, commands[name].help)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "fishctl: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// 解析子命令的参数，参数数量不在 [min, max] 内时返回错误，max 小于0表示不限
+func parseArgs(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		return nil, fmt.Errorf("usage: fishctl %s", commands[fs.Name()].usage)
+	}
+	return fs.Args(), nil
+}
+
+// 创建与集群使用相同节点来源和分布算法的客户端
+func (c *ctl) client() (*client.Client, error) {
+	opts := []client.Option{
+		client.WithDiscoverer(c.discoverer),
+		client.WithPlacement(c.placement),
+		client.WithTimeout(c.timeout),
+	}
+	if c.creds != nil {
+		opts = append(opts, client.WithCredentials(c.creds))
+	}
+	return client.New(opts...)
+}
+
+// 连接指定的节点，用于只需发送给该节点的管理命令
+func (c *ctl) dial(addr string) (pb.CacheServiceClient, func(), error) {
+	creds := insecure.NewCredentials()
+	if c.creds != nil {
+		creds = c.creds
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	return pb.NewCacheServiceClient(conn), func() { conn.Close() }, nil
+}
+
+// 返回参数中的节点，为空时返回服务发现中的所有节点
+func (c *ctl) nodes(args []string) ([]string, error) {
+	if len(args) > 0 {
+		return args, nil
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	defer cancel()
+	nodes, err := c.discoverer.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list nodes: %w", err)
+	}
+	if len(nodes) == 0 {
+		return nil, client.ErrNoNodes
+	}
+	addrs := make([]string, len(nodes))
+	for i, node := range nodes {
+		addrs[i] = node.Addr
+	}
+	slices.Sort(addrs)
+	return addrs, nil
+}
+
+func (c *ctl) get(args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("get", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	cli, err := c.client()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	value, err := cli.Get(c.ctx, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(value)
+	fmt.Println()
+	return nil
+}
+
+func (c *ctl) set(args []string) error {
+	fs := flag.NewFlagSet("set", flag.ContinueOnError)
+	ttl := fs.Duration("ttl", 0, "time to live, 0 never expires")
+	args, err := parseArgs(fs, args, 3, 3)
+	if err != nil {
+		return err
+	}
+	cli, err := c.client()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	return cli.Set(c.ctx, args[0], args[1], []byte(args[2]), *ttl)
+}
+
+func (c *ctl) delete(args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("delete", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	cli, err := c.client()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	return cli.Delete(c.ctx, args[0], args[1])
+}
+
+func (c *ctl) groups(args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("groups", flag.ContinueOnError), args, 0, 1)
+	if err != nil {
+		return err
+	}
+	// 所有节点的 Group 相同，默认询问第一个节点
+	nodes, err := c.nodes(args)
+	if err != nil {
+		return err
+	}
+	cc, closeConn, err := c.dial(nodes[0])
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	defer cancel()
+	resp, err := cc.ListGroups(ctx, &pb.ListGroupsRequest{})
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tEVICTION\tMAX_BYTES")
+	for _, g := range resp.Groups {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", g.Name, g.EvictionPolicy, g.MaxBytes)
+	}
+	return w.Flush()
+}
+
+func (c *ctl) owner(args []string) error {
+	fs := flag.NewFlagSet("owner", flag.ContinueOnError)
+	n := fs.Int("n", 1, "number of nodes to show, including replicas and retry candidates")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	cli, err := c.client()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	owners := cli.Owners(args[0], max(*n, 1))
+	if len(owners) == 0 {
+		return client.ErrNoNodes
+	}
+	for i, addr := range owners {
+		role := "owner"
+		if i > 0 {
+			role = "replica"
+		}
+		fmt.Printf("%s\t%s\n", addr, role)
+	}
+	return nil
+}
+
+func (c *ctl) stats(args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("stats", flag.ContinueOnError), args, 0, -1)
+	if err != nil {
+		return err
+	}
+	nodes, err := c.nodes(args)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i, addr := range nodes {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err = c.nodeStats(addr); err != nil {
+			fmt.Printf("%s: %v\n", addr, err)
+			errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 输出一个节点的统计
+func (c *ctl) nodeStats(addr string) error {
+	cc, closeConn, err := c.dial(addr)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	defer cancel()
+	resp, err := cc.Stats(ctx, &pb.StatsRequest{})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("node %s  weight=%d placement=%s replicas=%d draining=%t uptime=%s\n",
+		resp.Addr, resp.Weight, resp.Placement, resp.Replicas, resp.Draining,
+		(time.Duration(resp.UptimeMs) * time.Millisecond).Round(time.Second))
+	peers := make([]string, len(resp.Nodes))
+	for i, node := range resp.Nodes {
+		peers[i] = fmt.Sprintf("%s(%d)", node.Addr, node.Weight)
+	}
+	fmt.Printf("ring %s\n", strings.Join(peers, " "))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "GROUP\tGETS\tHITS\tHOT_HITS\tMISSES\tLOADS\tLOCAL\tPEER\tPEER_ERR\tITEMS\tBYTES\tEVICTED\tHOT_ITEMS\tDISK_ITEMS\t")
+	for _, g := range resp.Groups {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+			g.Name, g.Gets, g.Hits, g.HotHits, g.Misses, g.Loads, g.LocalLoads, g.PeerLoads, g.PeerErrors,
+			g.Main.GetItems(), g.Main.GetBytes(), g.Main.GetEvictions(), g.Hot.GetItems(), g.Disk.GetItems())
+	}
+	return w.Flush()
+}
+
+func (c *ctl) drain(args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("drain", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	cc, closeConn, err := c.dial(args[0])
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	// 迁移按节点的 -handoff-rate 限速，不设超时，中断时取消
+	resp, err := cc.Drain(c.ctx, &pb.DrainRequest{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("drained %s, %d keys remaining\n", args[0], resp.Remaining)
+	return nil
+}
+
+func (c *ctl) flush(args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("flush", flag.ContinueOnError), args, 1, -1)
+	if err != nil {
+		return err
+	}
+	nodes, err := c.nodes(args[1:])
+	if err != nil {
+		return err
+	}
+	var total int64
+	var errs []error
+	for _, addr := range nodes {
+		removed, err := c.flushNode(addr, args[0])
+		if err != nil {
+			fmt.Printf("%s: %v\n", addr, err)
+			errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+			continue
+		}
+		total += removed
+		fmt.Printf("%s: %d keys removed\n", addr, removed)
+	}
+	fmt.Printf("total: %d keys removed\n", total)
+	return errors.Join(errs...)
+}
+
+// 清空一个节点上的 Group
+func (c *ctl) flushNode(addr, group string) (int64, error) {
+	cc, closeConn, err := c.dial(addr)
+	if err != nil {
+		return 0, err
+	}
+	defer closeConn()
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	defer cancel()
+	resp, err := cc.Flush(ctx, &pb.FlushRequest{Group: group})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Removed, nil
+}
+
+func (c *ctl) watch(args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("watch", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+	updates, err := c.discoverer.Watch(c.ctx)
+	if err != nil {
+		return err
+	}
+	// 先输出当前的所有节点，之后每次变化时输出加入、离开和权重变化的节点
+	current := map[string]int{}
+	for {
+		ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+		nodes, err := c.discoverer.List(ctx)
+		cancel()
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "list nodes: %v\n", err)
+		} else {
+			current = printChanges(os.Stdout, current, nodes)
+		}
+		if _, ok := <-updates; !ok {
+			return nil
+		}
+	}
+}
+
+// 输出两次节点列表之间的变化，返回新的节点列表
+func printChanges(w io.Writer, prev map[string]int, nodes []discovery.Node) map[string]int {
+	next := make(map[string]int, len(nodes))
+	for _, node := range nodes {
+		next[node.Addr] = node.Weight
+	}
+	now := time.Now().Format(time.TimeOnly)
+	for _, addr := range slices.Sorted(maps.Keys(prev)) {
+		if _, ok := next[addr]; !ok {
+			fmt.Fprintf(w, "%s - %s\n", now, addr)
+		}
+	}
+	for _, addr := range slices.Sorted(maps.Keys(next)) {
+		weight, ok := prev[addr]
+		switch {
+		case !ok:
+			fmt.Fprintf(w, "%s + %s weight=%d\n", now, addr, next[addr])
+		case weight != next[addr]:
+			fmt.Fprintf(w, "%s ~ %s weight=%d->%d\n", now, addr, weight, next[addr])
+		}
+	}
+	return next
+}
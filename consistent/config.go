@@ -1,13 +1,14 @@
 package consistent
 
-import "time"
+import (
+	"crypto/tls"
+	"time"
+)
 
 const (
 	DefaultServiceName = "fishcache"
 )
 
-var Conf *Config
-
 type Config struct {
 	Etcd *Etcd
 }
@@ -16,4 +17,5 @@ type Etcd struct {
 	Address     []string
 	Timeout     time.Duration
 	ServiceName string
+	TLS         *tls.Config // 连接etcd的TLS配置，为nil时使用明文连接
 }
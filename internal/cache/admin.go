@@ -0,0 +1,140 @@
+package cache
+
+import (
+	pb "FishCache/api/groupcachepb"
+	"FishCache/internal/discovery"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListGroups 返回本节点上的所有 Group，按名称排序
+func (s *Server) ListGroups(_ context.Context, _ *pb.ListGroupsRequest) (*pb.ListGroupsResponse, error) {
+	resp := &pb.ListGroupsResponse{}
+	for _, g := range allGroups() {
+		maxBytes := g.cache.maxBytes
+		if g.hot != nil {
+			maxBytes += g.hot.maxBytes
+		}
+		resp.Groups = append(resp.Groups, &pb.GroupInfo{
+			Name:           g.name,
+			EvictionPolicy: string(g.policy),
+			MaxBytes:       maxBytes,
+		})
+	}
+	return resp, nil
+}
+
+// Stats 返回本节点的配置、当前看到的节点和各 Group 的统计
+func (s *Server) Stats(_ context.Context, _ *pb.StatsRequest) (*pb.StatsResponse, error) {
+	s.mu.RLock()
+	resp := &pb.StatsResponse{
+		Addr:      s.address,
+		Weight:    int64(s.weight),
+		Placement: string(s.placement),
+		Replicas:  int64(s.replicas),
+		Draining:  s.draining,
+		UptimeMs:  time.Since(s.startedAt).Milliseconds(),
+	}
+	for _, addr := range slices.Sorted(maps.Keys(s.nodes)) {
+		resp.Nodes = append(resp.Nodes, &pb.Node{Addr: addr, Weight: int64(s.nodes[addr])})
+	}
+	s.mu.RUnlock()
+
+	for _, g := range allGroups() {
+		resp.Groups = append(resp.Groups, &pb.GroupStats{
+			Name:       g.name,
+			Gets:       g.Stats.Gets.Load(),
+			Hits:       g.Stats.Hits.Load(),
+			HotHits:    g.Stats.HotHits.Load(),
+			Misses:     g.Stats.Misses.Load(),
+			Loads:      g.Stats.Loads.Load(),
+			LocalLoads: g.Stats.LocalLoads.Load(),
+			PeerLoads:  g.Stats.PeerLoads.Load(),
+			PeerErrors: g.Stats.PeerErrors.Load(),
+			Main:       cacheStatsPB(g.cache.stats()),
+			Hot:        cacheStatsPB(g.hot.stats()),
+			Disk:       cacheStatsPB(g.cache.disk.stats()),
+		})
+	}
+	return resp, nil
+}
+
+func cacheStatsPB(s CacheStats) *pb.CacheStats {
+	return &pb.CacheStats{Items: s.Items, Bytes: s.Bytes, Evictions: s.Evictions}
+}
+
+// Drain 使本节点退出集群：停止注册并注销本节点，将自身移出哈希环，等待缓存迁移给其他节点后返回。
+// 之后本节点仍可处理请求，但只作为转发节点；服务器停止前不会重新注册。集群中没有其他节点时拒绝执行。
+func (s *Server) Drain(ctx context.Context, _ *pb.DrainRequest) (*pb.DrainResponse, error) {
+	s.mu.Lock()
+	if s.ctx == nil {
+		s.mu.Unlock()
+		return nil, status.Error(codes.FailedPrecondition, "server not initialized")
+	}
+	var others []discovery.Node
+	for addr, weight := range s.nodes {
+		if addr != s.address {
+			others = append(others, discovery.Node{Addr: addr, Weight: weight})
+		}
+	}
+	if len(others) == 0 {
+		s.mu.Unlock()
+		return nil, status.Error(codes.FailedPrecondition, "no other nodes to drain to")
+	}
+	s.draining = true
+	if s.registerCancel != nil {
+		s.registerCancel()
+	}
+	s.mu.Unlock()
+
+	log.Infof("draining %s, handoff to %d nodes", s.address, len(others))
+	dctx, cancel := context.WithTimeout(ctx, s.callTimeout)
+	if err := s.discoverer.Deregister(dctx, s.address); err != nil {
+		log.Errorf("deregister %s failed: %v", s.address, err)
+	}
+	cancel()
+
+	s.SetPeers(others)
+	s.mu.RLock()
+	done := s.handoffDone
+	s.mu.RUnlock()
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, grpcError(ctx.Err())
+		}
+	}
+
+	var remaining int64
+	for _, g := range allGroups() {
+		remaining += g.cache.stats().Items
+	}
+	log.Infof("drained %s, %d keys remaining", s.address, remaining)
+	return &pb.DrainResponse{Remaining: remaining}, nil
+}
+
+// Draining 返回本节点是否已通过 Drain 退出集群
+func (s *Server) Draining() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.draining
+}
+
+// Flush 清空本节点上指定 Group 的所有缓存，不转发给其他节点
+func (s *Server) Flush(_ context.Context, req *pb.FlushRequest) (*pb.FlushResponse, error) {
+	group := GetGroup(req.Group)
+	if group == nil {
+		return &pb.FlushResponse{}, grpcError(fmt.Errorf("%w: %s", ErrGroupNotFound, req.Group))
+	}
+	removed := group.Flush()
+	log.Infof("flushed group %s, %d keys removed", req.Group, removed)
+	return &pb.FlushResponse{Removed: int64(removed)}, nil
+}
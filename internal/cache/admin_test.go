@@ -0,0 +1,101 @@
+package cache
+
+import (
+	pb "FishCache/api/groupcachepb"
+	"FishCache/internal/discovery"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServer_flushAndStats(t *testing.T) {
+	mygrp := NewGroup("flushGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithHotCache(10, 1, 0))
+	s, _ := startTestServer(t)
+	ctx := context.Background()
+
+	mygrp.cache.add("a", ByteView{b: []byte("1")})
+	mygrp.cache.add("b", ByteView{b: []byte("2")})
+	mygrp.hot.add("b", ByteView{b: []byte("2")})
+	mygrp.hot.add("c", ByteView{b: []byte("3")})
+	if _, err := mygrp.Get("d"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.Stats(ctx, &pb.StatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(stats.Groups, func(g *pb.GroupStats) bool { return g.Name == "flushGroup" })
+	if i < 0 {
+		t.Fatalf("flushGroup missing in stats")
+	}
+	if g := stats.Groups[i]; g.Gets != 1 || g.LocalLoads != 1 || g.Main.Items != 3 || g.Hot.Items != 2 {
+		t.Fatalf("stats = %+v", g)
+	}
+	if stats.Addr != s.address || stats.Draining {
+		t.Fatalf("node stats = %+v", stats)
+	}
+
+	// 主缓存和热点缓存中的key各计一次
+	resp, err := s.Flush(ctx, &pb.FlushRequest{Group: "flushGroup"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Removed != 4 {
+		t.Fatalf("removed = %d, want 4", resp.Removed)
+	}
+	if n := mygrp.cache.stats().Items + mygrp.hot.stats().Items; n != 0 {
+		t.Fatalf("%d items left after flush", n)
+	}
+
+	_, err = s.Flush(ctx, &pb.FlushRequest{Group: "noSuchGroup"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("flush unknown group: %v", err)
+	}
+}
+
+func TestServer_drain(t *testing.T) {
+	s, _ := startTestServer(t)
+	s.ctx = context.Background()
+	s.handoffLimiter = nil
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 集群中只有本节点时拒绝退出
+	s.SetPeers(nil)
+	if _, err := s.Drain(ctx, &pb.DrainRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("drain single node: %v", err)
+	}
+	if s.Draining() {
+		t.Fatal("draining after rejected drain")
+	}
+
+	s.SetPeers([]discovery.Node{{Addr: "127.0.0.1:1", Weight: 10}})
+	if _, err := s.Drain(ctx, &pb.DrainRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Draining() {
+		t.Fatal("not draining after drain")
+	}
+	// 之后收到的节点列表中即使包含本节点，也不再加入哈希环
+	s.SetPeers([]discovery.Node{{Addr: s.address, Weight: 10}, {Addr: "127.0.0.1:1", Weight: 10}})
+	if owner := s.locator.GetNode("any"); owner != "127.0.0.1:1" {
+		t.Fatalf("owner = %q after drain", owner)
+	}
+	stats, err := s.Stats(ctx, &pb.StatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.Draining || len(stats.Nodes) != 1 {
+		t.Fatalf("stats after drain = %+v", stats)
+	}
+	if err = s.Register(); err != nil {
+		t.Fatalf("register after drain: %v", err)
+	}
+}
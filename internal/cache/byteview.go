@@ -1,11 +1,26 @@
 package cache
 
-import "time"
+import (
+	"FishCache/internal/cache/eviction"
+	"time"
+)
 
 // ByteView 抽象一个只读数据结构 ByteView 用来表示缓存值
 type ByteView struct {
 	b        []byte    // 选择 byte 类型是为了能够支持任意的数据类型的存储，例如字符串、图片等。
 	expireAt time.Time // 过期时间，零值表示永不过期
+	// 从快照或磁盘日志恢复、之后未被写入的值，可能在节点停机期间已被修改，迁移来的数据会覆盖它。
+	// PolicyRing 只保存字节和过期时间，不保留该标记
+	restored bool
+}
+
+// 由源数据和过期时长构造 ByteView，ttl<=0 表示永不过期
+func newByteView(b []byte, ttl time.Duration) ByteView {
+	v := ByteView{b: cloneBytes(b)}
+	if ttl > 0 {
+		v.expireAt = time.Now().Add(ttl)
+	}
+	return v
 }
 
 // Len 实现缓存对象中必须实现的Value的接口，返回其所占的内存大小
@@ -18,6 +33,16 @@ func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
 }
 
+// AppendBytes 实现 eviction.Encodable，使 ByteView 可以存入 PolicyRing 的字节缓冲区
+func (v ByteView) AppendBytes(dst []byte) []byte {
+	return append(dst, v.b...)
+}
+
+// 从 PolicyRing 的字节缓冲区还原 ByteView
+func decodeByteView(data []byte, expireAt time.Time) eviction.Value {
+	return ByteView{b: data, expireAt: expireAt}
+}
+
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
@@ -35,3 +60,32 @@ func (v ByteView) IsExpired() bool {
 	// expireAt < now 即 time.Now() 在 expireAt 之后，表示已过期，返回true
 	return !v.expireAt.IsZero() && time.Now().After(v.expireAt)
 }
+
+// ExpireAt 返回过期时间，零值表示永不过期
+func (v ByteView) ExpireAt() time.Time {
+	return v.expireAt
+}
+
+// 返回过期时间不晚于 ttl 之后的副本
+func (v ByteView) withMaxTTL(ttl time.Duration) ByteView {
+	if limit := time.Now().Add(ttl); v.expireAt.IsZero() || v.expireAt.After(limit) {
+		v.expireAt = limit
+	}
+	return v
+}
+
+// 将过期时间转换为unix毫秒时间戳，用于节点间传输，0 表示永不过期
+func (v ByteView) expireAtMillis() int64 {
+	if v.expireAt.IsZero() {
+		return 0
+	}
+	return v.expireAt.UnixMilli()
+}
+
+// 将unix毫秒时间戳还原为过期时间
+func expireAtFromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
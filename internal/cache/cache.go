@@ -9,36 +9,70 @@ import (
 
 type Cache struct {
 	mu       sync.RWMutex
-	strategy *eviction.CacheUseLRU
+	strategy eviction.Policy
 	maxBytes int64
+	disk     *diskTier        // 磁盘二级缓存，保存从内存中淘汰的缓存，为nil时不启用
+	onEvict  func(key string) // 缓存因容量或过期被淘汰时调用，为nil时忽略
 }
 
-func NewCache(maxBytes int64) (*Cache, error) {
+// NewCache 创建使用指定淘汰策略的缓存，policy 为空时使用LRU
+func NewCache(maxBytes int64, policy eviction.PolicyType) (*Cache, error) {
 	if maxBytes <= 0 {
 		return nil, fmt.Errorf("cache size must be positive, got %d", maxBytes)
 	}
 
+	c := &Cache{maxBytes: maxBytes}
 	onEvicted := func(key string, val eviction.Value) {
 		log.Warnf("Cache entry evicted: key=%s\n", key)
+		// 淘汰可能发生在 Add 中，也可能发生在 Get 的过期检查或淘汰策略的后台清理中，此时不一定持有 c.mu，
+		// 但持有淘汰策略的分片锁，磁盘写入放入队列由后台完成；c.disk 和 c.onEvict 只在创建时设置。
+		// 已过期的值不写入磁盘，同时删除磁盘中的同名旧值：后台清理可能在 add 删除磁盘旧值之后、
+		// 写入新值之前把旧值淘汰到磁盘，新值过期后不能再读到该旧值
+		if bv, ok := val.(ByteView); ok {
+			c.disk.enqueue(key, diskOp{value: bv, del: bv.IsExpired()})
+		}
+		if c.onEvict != nil {
+			c.onEvict(key)
+		}
 	}
-	return &Cache{
-		maxBytes: maxBytes,
-		strategy: eviction.NewLRUCache(maxBytes, onEvicted),
-	}, nil
+	strategy, err := eviction.New(policy, maxBytes, onEvicted, eviction.WithDecoder(decodeByteView))
+	if err != nil {
+		return nil, err
+	}
+	c.strategy = strategy
+	return c, nil
 }
 
 func (c *Cache) get(key string) (ByteView, bool) {
+	if c == nil {
+		return ByteView{}, false
+	}
+
 	c.mu.RLock()
-	defer c.mu.RUnlock()
+	v, _, exists := c.strategy.Get(key)
+	c.mu.RUnlock()
 
-	if v, _, exists := c.strategy.Get(key); exists {
+	if exists {
 		// 类型断言，将接口类型的变量 v *Value 转换为具体的类型 ByteView
 		if bv, ok := v.(ByteView); ok {
 			return bv, ok
 		}
 	}
+	if c.disk == nil {
+		return ByteView{}, false
+	}
 
-	return ByteView{}, false
+	// 内存未命中时查找磁盘，命中后移回内存
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bv, ok := c.disk.get(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	c.disk.remove(key)
+	c.strategy.Add(key, bv)
+	return bv, true
 }
 
 func (c *Cache) add(key string, value ByteView) {
@@ -49,5 +83,99 @@ func (c *Cache) add(key string, value ByteView) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	// 删除磁盘中的旧值，避免内存淘汰前读到过期的数据
+	c.disk.remove(key)
 	c.strategy.Add(key, value)
 }
+
+func (c *Cache) remove(key string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 先从内存删除再删除磁盘：后台清理不持有 c.mu，若先删除磁盘，清理可能在两步之间把该key淘汰回磁盘
+	inMemory := c.strategy.Remove(key)
+	return c.disk.remove(key) || inMemory
+}
+
+// 遍历缓存的快照，fn 在锁外调用，返回false时停止
+func (c *Cache) rangeEntries(fn func(key string, value ByteView) bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.RLock()
+	strategy := c.strategy
+	c.mu.RUnlock()
+
+	strategy.Range(func(key string, v eviction.Value) bool {
+		if bv, ok := v.(ByteView); ok {
+			return fn(key, bv)
+		}
+		return true
+	})
+}
+
+// 导出缓存的快照，淘汰策略不支持快照时按遍历顺序导出，空闲时间记为0
+func (c *Cache) snapshot() []eviction.SnapshotEntry {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	strategy := c.strategy
+	c.mu.RUnlock()
+
+	if s, ok := strategy.(eviction.Snapshotter); ok {
+		return s.Snapshot()
+	}
+	var entries []eviction.SnapshotEntry
+	strategy.Range(func(key string, v eviction.Value) bool {
+		entries = append(entries, eviction.SnapshotEntry{Key: key, Value: v})
+		return true
+	})
+	return entries
+}
+
+// 按快照的顺序恢复缓存
+func (c *Cache) restore(entries []eviction.SnapshotEntry) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.strategy.(eviction.Snapshotter); ok {
+		s.Restore(entries)
+		return
+	}
+	for _, e := range entries {
+		c.strategy.Add(e.Key, e.Value)
+	}
+}
+
+// CacheStats 缓存的容量统计
+type CacheStats struct {
+	Items     int64 // 缓存数据个数
+	Bytes     int64 // 占用的字节数
+	Evictions int64 // 累计淘汰的缓存数量
+}
+
+func (c *Cache) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return CacheStats{
+		Items:     int64(c.strategy.Len()),
+		Bytes:     c.strategy.Bytes(),
+		Evictions: c.strategy.Evictions(),
+	}
+}
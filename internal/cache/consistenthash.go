@@ -1,7 +1,10 @@
 package cache
 
 import (
+	"FishCache/internal/discovery"
 	"hash/crc32"
+	"math"
+	"slices"
 	"sort"
 	"strconv"
 	"sync"
@@ -23,6 +26,10 @@ type ConsistentMap struct {
 	keys []int // Sorted
 	//虚拟节点与真实节点的映射表 hashMap，键是虚拟节点的哈希值，值是真实节点的名称。
 	hashMap map[int]string
+	//真实节点的权重
+	weights map[string]int
+	//所有真实节点的权重之和
+	totalWeight int
 }
 
 // NewConsistentHash 允许自定义虚拟节点倍数和 Hash 函数。
@@ -38,20 +45,39 @@ func NewConsistentHash(replicas int, fn Hash) *ConsistentMap {
 	return m
 }
 
-// AddNodes 函数允许传入 0 或 多个真实节点的名称
+// AddNodes 函数允许传入 0 或 多个真实节点的名称，所有节点使用默认权重
 func (m *ConsistentMap) AddNodes(nodes ...string) {
+	weights := make(map[string]int, len(nodes))
+	for _, nodeName := range nodes {
+		weights[nodeName] = discovery.DefaultWeight
+	}
+	m.AddWeightedNodes(weights)
+}
+
+// AddWeightedNodes 按权重传入真实节点，节点的虚拟节点数为 replicas*weight/discovery.DefaultWeight，至少为1，
+// 使节点负责的key数量与权重成正比。权重为默认值的节点与 AddNodes 添加的节点在哈希环上的位置相同。
+func (m *ConsistentMap) AddWeightedNodes(weights map[string]int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	m.keys = nil                     // 清空之前的keys
 	m.hashMap = make(map[int]string) // 清空之前的hashMap
+	m.weights = make(map[string]int, len(weights))
+	m.totalWeight = 0
 
 	// 对节点名称进行排序
+	nodes := make([]string, 0, len(weights))
+	for nodeName := range weights {
+		nodes = append(nodes, nodeName)
+	}
 	sort.Strings(nodes)
 
-	// 对每一个真实节点 node，对应创建 m.replicas 个虚拟节点。缓解真实节点少时的数据倾斜问题。
+	// 对每一个真实节点 node，按权重创建虚拟节点。缓解真实节点少时的数据倾斜问题。
 	for _, nodeName := range nodes {
-		for i := 0; i < m.replicas; i++ {
+		m.weights[nodeName] = max(weights[nodeName], 1)
+		m.totalWeight += m.weights[nodeName]
+		replicas := max(m.replicas*m.weights[nodeName]/discovery.DefaultWeight, 1)
+		for i := 0; i < replicas; i++ {
 			// 虚拟节点的名称是：strconv.Itoa(i) + nodeName，通过添加编号的方式区分不同虚拟节点。
 			vnodeHash := int(m.hash([]byte(strconv.Itoa(i) + nodeName)))
 			m.keys = append(m.keys, vnodeHash)
@@ -63,15 +89,81 @@ func (m *ConsistentMap) AddNodes(nodes ...string) {
 	sort.Ints(m.keys)
 }
 
+// SetNodes 实现了 NodeLocator 接口，等同于 AddWeightedNodes
+func (m *ConsistentMap) SetNodes(weights map[string]int) {
+	m.AddWeightedNodes(weights)
+}
+
 // GetNode 返回指定key的对应节点
 func (m *ConsistentMap) GetNode(key string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if len(m.keys) == 0 {
 		return ""
 	}
 
+	// 第三步，通过 hashMap 映射得到真实的节点。
+	return m.hashMap[m.keys[m.search(key)]]
+}
+
+// GetNodes 从key的位置沿哈希环顺时针依次取 n 个不同的真实节点
+func (m *ConsistentMap) GetNodes(key string, n int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	n = min(n, len(m.weights))
+	nodes := make([]string, 0, n)
+	index := m.search(key)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		nodeName := m.hashMap[m.keys[(index+i)%len(m.keys)]]
+		if !slices.Contains(nodes, nodeName) {
+			nodes = append(nodes, nodeName)
+		}
+	}
+	return nodes
+}
+
+// GetNodeBounded 实现有界负载的一致性哈希（Mirrokni 等人提出）：load 返回节点当前的负载，
+// 每个节点的容量为 ceil((1+epsilon)·(总负载+1)·节点权重/总权重)。key 对应的节点已满时，
+// 沿哈希环顺时针寻找下一个仍有容量的节点；所有节点都已满时返回原本的节点。
+func (m *ConsistentMap) GetNodeBounded(key string, epsilon float64, load func(node string) float64) string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	if len(m.keys) == 0 {
+		return ""
+	}
+
+	var total float64
+	for nodeName := range m.weights {
+		total += load(nodeName)
+	}
+	hasRoom := func(nodeName string) bool {
+		capacity := math.Ceil((1 + epsilon) * (total + 1) * float64(m.weights[nodeName]) / float64(m.totalWeight))
+		return load(nodeName)+1 <= capacity
+	}
+
+	index := m.search(key)
+	checked := make(map[string]bool, len(m.weights))
+	for i := 0; i < len(m.keys) && len(checked) < len(m.weights); i++ {
+		nodeName := m.hashMap[m.keys[(index+i)%len(m.keys)]]
+		if checked[nodeName] {
+			continue
+		}
+		if hasRoom(nodeName) {
+			return nodeName
+		}
+		checked[nodeName] = true
+	}
+	return m.hashMap[m.keys[index]]
+}
+
+// 返回key在哈希环上顺时针遇到的第一个虚拟节点的下标，调用方需持有读锁且哈希环非空
+func (m *ConsistentMap) search(key string) int {
 	// 第一步，计算 key 的哈希值。
 	hash := int(m.hash([]byte(key)))
 	// 第二步，顺时针找到第一个匹配的虚拟节点的下标 idx
@@ -83,6 +175,5 @@ func (m *ConsistentMap) GetNode(key string) string {
 	if index == len(m.keys) {
 		index = 0
 	}
-	// 第三步，通过 hashMap 映射得到真实的节点。
-	return m.hashMap[m.keys[index]]
+	return index
 }
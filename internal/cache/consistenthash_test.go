@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestConsistentMap_weighted(t *testing.T) {
+	m := NewConsistentHash(50, nil)
+	m.AddWeightedNodes(map[string]int{"small:23333": 10, "large:23333": 80})
+
+	counts := make(map[string]int)
+	for i := 0; i < 90000; i++ {
+		counts[m.GetNode("key"+strconv.Itoa(i))]++
+	}
+	// 权重为 1:8，大节点负责的key应明显多于小节点
+	if ratio := float64(counts["large:23333"]) / float64(counts["small:23333"]); ratio < 4 || ratio > 16 {
+		t.Errorf("节点负责的key数量应与权重大致成正比，实际为 %v", counts)
+	}
+	// 非正数的权重按1处理，虚拟节点数与权重为1时相同
+	zero := NewConsistentHash(100, nil)
+	zero.AddWeightedNodes(map[string]int{"a:23333": 0})
+	one := NewConsistentHash(100, nil)
+	one.AddWeightedNodes(map[string]int{"a:23333": 1})
+	if len(zero.keys) != len(one.keys) {
+		t.Errorf("权重为0的节点应有 %d 个虚拟节点，实际为 %d", len(one.keys), len(zero.keys))
+	}
+}
+
+func TestConsistentMap_defaultWeight(t *testing.T) {
+	plain := NewConsistentHash(50, nil)
+	plain.AddNodes("a:23333", "b:23333", "c:23333")
+	weighted := NewConsistentHash(50, nil)
+	weighted.AddWeightedNodes(map[string]int{"a:23333": 10, "b:23333": 10, "c:23333": 10})
+
+	// 默认权重的节点在哈希环上的位置应与 AddNodes 相同
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		if plain.GetNode(key) != weighted.GetNode(key) {
+			t.Fatalf("key %s 的归属节点不一致", key)
+		}
+	}
+}
+
+func TestConsistentMap_bounded(t *testing.T) {
+	m := NewConsistentHash(50, nil)
+	m.AddNodes("a:23333", "b:23333", "c:23333")
+
+	owner := m.GetNode("Tom")
+	// 负载均衡时返回归属节点
+	if node := m.GetNodeBounded("Tom", 0.25, func(string) float64 { return 10 }); node != owner {
+		t.Errorf("负载均衡时应返回归属节点 %s，实际为 %s", owner, node)
+	}
+	// 归属节点过载时顺延到其他节点
+	overloaded := func(node string) float64 {
+		if node == owner {
+			return 100
+		}
+		return 10
+	}
+	if node := m.GetNodeBounded("Tom", 0.25, overloaded); node == owner || node == "" {
+		t.Errorf("归属节点 %s 过载时应顺延到其他节点，实际为 %s", owner, node)
+	}
+	// 所有节点都过载时返回归属节点
+	if node := m.GetNodeBounded("Tom", 0, func(string) float64 { return 100 }); node != owner {
+		t.Errorf("所有节点都过载时应返回归属节点 %s，实际为 %s", owner, node)
+	}
+}
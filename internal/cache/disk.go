@@ -0,0 +1,467 @@
+package cache
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 磁盘日志的记录格式（大端序）：
+//
+//	crc32c uint32 | kind uint8 | keyLen uint32 | valueLen uint32 | expireAt int64 | key | value
+//
+// crc32c 校验 crc 之后的所有字节，expireAt 为unix毫秒，0表示永不过期。kind 为 diskPut 时
+// 写入一条缓存，为 diskDelete 时删除一条缓存（不携带value）。
+const (
+	diskHeaderSize = 4 + 1 + 4 + 4 + 8
+	diskPut        = 1
+	diskDelete     = 2
+
+	// 日志中的无效字节超过有效字节、且超过该值时压缩日志
+	diskCompactMinGarbage = 4 << 20
+	// 单个key允许的最大长度，恢复时超出即视为记录损坏
+	diskMaxKeyLen = 1 << 20
+)
+
+// 磁盘中一条有效的缓存记录
+type diskRecord struct {
+	key      string
+	offset   int64 // 记录在日志中的起始位置
+	size     int64 // 整条记录的字节数
+	expireAt int64
+	restored bool // 启动时从日志恢复的记录，读取后的值带有 ByteView.restored 标记
+}
+
+// diskTier 内存缓存之下的磁盘二级缓存。被淘汰的缓存追加写入日志文件，内存中只保存索引；
+// 有效记录超出 maxBytes 时按写入顺序淘汰最早的记录。日志和索引的操作都持有同一把锁。
+// 内存淘汰发生在淘汰策略的分片锁内，淘汰的缓存先放入队列，由后台协程写入日志和压缩，不阻塞分片。
+type diskTier struct {
+	mu       sync.Mutex
+	path     string
+	f        *os.File
+	size     int64 // 日志文件的字节数
+	live     int64 // 有效记录的字节数
+	maxBytes int64
+	index    map[string]*list.Element // key -> *diskRecord
+	order    *list.List               // 按写入顺序排列的有效记录
+
+	qmu     sync.Mutex
+	pending map[string]diskOp // 等待后台写入的操作，同一key只保留最后一次
+	wake    chan struct{}     // 有新的待写入操作时通知后台协程
+}
+
+// 一次等待写入磁盘的操作
+type diskOp struct {
+	value ByteView
+	del   bool // 删除磁盘中的旧值，而不是写入 value
+}
+
+// 打开或创建磁盘日志并重建索引。进程崩溃时日志末尾可能只写入了一部分，
+// 从第一条不完整或校验失败的记录处截断日志。
+func openDiskTier(path string, maxBytes int64) (*diskTier, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("disk tier size must be positive, got %d", maxBytes)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create disk tier directory: %w", err)
+	}
+	// 上次压缩未完成时留下的临时文件
+	_ = os.Remove(path + ".compact")
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open disk tier %s: %w", path, err)
+	}
+	t := &diskTier{
+		path:     path,
+		f:        f,
+		maxBytes: maxBytes,
+		index:    make(map[string]*list.Element),
+		order:    list.New(),
+		pending:  make(map[string]diskOp),
+		wake:     make(chan struct{}, 1),
+	}
+	if err = t.recover(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	go t.writeLoop()
+	return t, nil
+}
+
+// 顺序扫描日志重建索引
+func (t *diskTier) recover() error {
+	info, err := t.f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat disk tier %s: %w", t.path, err)
+	}
+	r := bufio.NewReader(io.NewSectionReader(t.f, 0, info.Size()))
+	var offset int64
+	for {
+		// 写入时整条记录不超过 maxBytes，也不可能超出文件的剩余部分
+		limit := min(t.maxBytes, info.Size()-offset) - diskHeaderSize
+		kind, key, _, expireAt, size, err := readDiskRecord(r, limit)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Warnf("disk tier %s: truncate at offset %d: %v", t.path, offset, err)
+			if err = t.f.Truncate(offset); err != nil {
+				return fmt.Errorf("truncate disk tier %s: %w", t.path, err)
+			}
+			break
+		}
+		switch kind {
+		case diskPut:
+			t.insert(&diskRecord{key: key, offset: offset, size: size, expireAt: expireAt, restored: true})
+		case diskDelete:
+			t.drop(key)
+		}
+		offset += size
+	}
+	t.size = offset
+	return nil
+}
+
+// 读取一条记录，key和value的总长度超过 maxBody 时视为记录头损坏，避免按损坏的长度分配内存；
+// 日志正常结束时返回 io.EOF
+func readDiskRecord(r io.Reader, maxBody int64) (kind byte, key string, value []byte, expireAt int64, size int64, err error) {
+	var header [diskHeaderSize]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = errors.New("partial header")
+		}
+		return
+	}
+	kind = header[4]
+	keyLen := binary.BigEndian.Uint32(header[5:])
+	valueLen := binary.BigEndian.Uint32(header[9:])
+	expireAt = int64(binary.BigEndian.Uint64(header[13:]))
+	if (kind != diskPut && kind != diskDelete) || keyLen > diskMaxKeyLen || int64(keyLen)+int64(valueLen) > maxBody {
+		err = fmt.Errorf("bad header")
+		return
+	}
+
+	body := make([]byte, int(keyLen)+int(valueLen))
+	if _, err = io.ReadFull(r, body); err != nil {
+		err = fmt.Errorf("partial record: %w", err)
+		return
+	}
+	crc := crc32.Update(crc32.Checksum(header[4:], crc32c), crc32c, body)
+	if crc != binary.BigEndian.Uint32(header[:4]) {
+		err = errors.New("checksum mismatch")
+		return
+	}
+	return kind, string(body[:keyLen]), body[keyLen:], expireAt, int64(len(header) + len(body)), nil
+}
+
+// 编码一条记录
+func encodeDiskRecord(kind byte, key string, value []byte, expireAt int64) []byte {
+	buf := make([]byte, diskHeaderSize, diskHeaderSize+len(key)+len(value))
+	buf[4] = kind
+	binary.BigEndian.PutUint32(buf[5:], uint32(len(key)))
+	binary.BigEndian.PutUint32(buf[9:], uint32(len(value)))
+	binary.BigEndian.PutUint64(buf[13:], uint64(expireAt))
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+	binary.BigEndian.PutUint32(buf[:4], crc32.Checksum(buf[4:], crc32c))
+	return buf
+}
+
+// 将一条缓存写入磁盘，已过期或超过整个预算的缓存直接丢弃
+func (t *diskTier) put(key string, value ByteView) {
+	if t == nil || value.IsExpired() {
+		return
+	}
+	expireAt := value.expireAtMillis()
+	buf := encodeDiskRecord(diskPut, key, value.b, expireAt)
+	if int64(len(buf)) > t.maxBytes {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.write(key, buf, expireAt, value.restored)
+	t.maybeCompact()
+}
+
+// 写入一条已编码的记录并加入索引，调用方持有 t.mu
+func (t *diskTier) write(key string, buf []byte, expireAt int64, restored bool) {
+	offset, err := t.append(buf)
+	if err != nil {
+		log.Warnf("disk tier %s: write %s: %v", t.path, key, err)
+		return
+	}
+	t.insert(&diskRecord{key: key, offset: offset, size: int64(len(buf)), expireAt: expireAt, restored: restored})
+}
+
+// 将操作放入后台写入的队列，不等待磁盘IO，可以在淘汰策略的锁内调用
+func (t *diskTier) enqueue(key string, op diskOp) {
+	if t == nil {
+		return
+	}
+	t.qmu.Lock()
+	t.pending[key] = op
+	t.qmu.Unlock()
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// 后台写入队列中的操作
+func (t *diskTier) writeLoop() {
+	for range t.wake {
+		t.flush()
+	}
+}
+
+// 写入队列中的所有操作，并在无效字节过多时压缩日志
+func (t *diskTier) flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.qmu.Lock()
+	ops := t.pending
+	t.pending = make(map[string]diskOp)
+	t.qmu.Unlock()
+
+	for key, op := range ops {
+		if op.del || op.value.IsExpired() {
+			t.removeLocked(key)
+			continue
+		}
+		buf := encodeDiskRecord(diskPut, key, op.value.b, op.value.expireAtMillis())
+		if int64(len(buf)) <= t.maxBytes {
+			t.write(key, buf, op.value.expireAtMillis(), op.value.restored)
+		}
+	}
+	t.maybeCompact()
+}
+
+// 读取磁盘中的缓存，记录已过期或读取失败时视为未命中
+func (t *diskTier) get(key string) (ByteView, bool) {
+	if t == nil {
+		return ByteView{}, false
+	}
+	// 尚未写入的操作比日志中的记录更新
+	t.qmu.Lock()
+	op, queued := t.pending[key]
+	t.qmu.Unlock()
+	if queued {
+		if op.del || op.value.IsExpired() {
+			return ByteView{}, false
+		}
+		return op.value, true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	elm, ok := t.index[key]
+	if !ok {
+		return ByteView{}, false
+	}
+	rec := elm.Value.(*diskRecord)
+	v := ByteView{expireAt: expireAtFromMillis(rec.expireAt), restored: rec.restored}
+	if v.IsExpired() {
+		t.drop(key)
+		return ByteView{}, false
+	}
+	_, _, value, _, _, err := readDiskRecord(io.NewSectionReader(t.f, rec.offset, rec.size), rec.size-diskHeaderSize)
+	if err != nil {
+		log.Warnf("disk tier %s: read %s: %v", t.path, key, err)
+		t.drop(key)
+		return ByteView{}, false
+	}
+	v.b = value
+	return v, true
+}
+
+// 删除磁盘中的缓存，写入删除记录使其在恢复后仍然生效，返回key是否存在
+func (t *diskTier) remove(key string) bool {
+	if t == nil {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// 持有 t.mu 时后台协程不会处于取出队列和写入日志之间，删除队列中的操作后不会再被写入
+	t.qmu.Lock()
+	op, queued := t.pending[key]
+	delete(t.pending, key)
+	t.qmu.Unlock()
+
+	existed := t.removeLocked(key)
+	t.maybeCompact()
+	if queued {
+		return !op.del && !op.value.IsExpired()
+	}
+	return existed
+}
+
+// 从索引中删除记录并写入删除记录，调用方持有 t.mu
+func (t *diskTier) removeLocked(key string) bool {
+	if !t.drop(key) {
+		return false
+	}
+	if _, err := t.append(encodeDiskRecord(diskDelete, key, nil, 0)); err != nil {
+		log.Warnf("disk tier %s: delete %s: %v", t.path, key, err)
+	}
+	return true
+}
+
+// 在日志末尾写入记录，返回记录的起始位置；写入失败时截断不完整的部分
+func (t *diskTier) append(buf []byte) (int64, error) {
+	offset := t.size
+	if _, err := t.f.WriteAt(buf, offset); err != nil {
+		_ = t.f.Truncate(offset)
+		return 0, err
+	}
+	t.size += int64(len(buf))
+	return offset, nil
+}
+
+// 将记录加入索引，替换同名的旧记录，并按写入顺序淘汰超出预算的记录
+func (t *diskTier) insert(rec *diskRecord) {
+	t.drop(rec.key)
+	t.index[rec.key] = t.order.PushBack(rec)
+	t.live += rec.size
+	for t.live > t.maxBytes {
+		t.drop(t.order.Front().Value.(*diskRecord).key)
+	}
+}
+
+// 从索引中删除记录，返回记录是否存在；被删除的记录在日志中成为无效字节
+func (t *diskTier) drop(key string) bool {
+	elm, ok := t.index[key]
+	if !ok {
+		return false
+	}
+	t.order.Remove(elm)
+	delete(t.index, key)
+	t.live -= elm.Value.(*diskRecord).size
+	return true
+}
+
+// 无效字节过多时压缩日志
+func (t *diskTier) maybeCompact() {
+	garbage := t.size - t.live
+	if garbage < diskCompactMinGarbage || garbage < t.live {
+		return
+	}
+	start := time.Now()
+	if err := t.compact(); err != nil {
+		log.Warnf("disk tier %s: compact: %v", t.path, err)
+		return
+	}
+	log.Infof("disk tier %s: compacted %d bytes to %d in %v", t.path, garbage+t.live, t.size, time.Since(start))
+}
+
+// 按写入顺序将有效记录复制到新文件，再替换旧日志
+func (t *diskTier) compact() error {
+	tmpPath := t.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	offsets := make([]int64, 0, t.order.Len())
+	var offset int64
+	for elm := t.order.Front(); elm != nil; elm = elm.Next() {
+		rec := elm.Value.(*diskRecord)
+		if _, err = io.Copy(w, io.NewSectionReader(t.f, rec.offset, rec.size)); err != nil {
+			return fail(err)
+		}
+		offsets = append(offsets, offset)
+		offset += rec.size
+	}
+	if err = w.Flush(); err != nil {
+		return fail(err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err = os.Rename(tmpPath, t.path); err != nil {
+		return fail(err)
+	}
+	// 同步目录，保证重命名在断电后仍然有效
+	if err = syncDir(filepath.Dir(t.path)); err != nil {
+		log.Warnf("disk tier %s: sync directory: %v", t.path, err)
+	}
+
+	t.f.Close()
+	t.f = tmp
+	t.size = offset
+	i := 0
+	for elm := t.order.Front(); elm != nil; elm = elm.Next() {
+		elm.Value.(*diskRecord).offset = offsets[i]
+		i++
+	}
+	return nil
+}
+
+// 返回磁盘中所有有效记录的key
+func (t *diskTier) keys() []string {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.qmu.Lock()
+	defer t.qmu.Unlock()
+
+	keys := make([]string, 0, len(t.index)+len(t.pending))
+	for key := range t.index {
+		if _, queued := t.pending[key]; !queued {
+			keys = append(keys, key)
+		}
+	}
+	for key, op := range t.pending {
+		if !op.del {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// 磁盘二级缓存的容量统计
+func (t *diskTier) stats() CacheStats {
+	if t == nil {
+		return CacheStats{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return CacheStats{Items: int64(len(t.index)), Bytes: t.live}
+}
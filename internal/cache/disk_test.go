@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiskTier_basic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.log")
+	tier, err := openDiskTier(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tier.put("a", ByteView{b: []byte("1")})
+	tier.put("b", ByteView{b: []byte("2"), expireAt: time.Now().Add(time.Hour)})
+	tier.put("a", ByteView{b: []byte("3")})
+	tier.put("expired", ByteView{b: []byte("4"), expireAt: time.Now().Add(-time.Second)})
+	tier.put("removed", ByteView{b: []byte("5")})
+	if !tier.remove("removed") {
+		t.Fatal("removed should exist")
+	}
+
+	check := func(tier *diskTier) {
+		t.Helper()
+		if v, ok := tier.get("a"); !ok || v.String() != "3" {
+			t.Errorf("a = %q, %v", v.String(), ok)
+		}
+		if v, ok := tier.get("b"); !ok || v.String() != "2" || v.ExpireAt().IsZero() {
+			t.Errorf("b = %q, %v, expireAt %v", v.String(), ok, v.ExpireAt())
+		}
+		for _, key := range []string{"expired", "removed"} {
+			if _, ok := tier.get(key); ok {
+				t.Errorf("%s should not exist", key)
+			}
+		}
+	}
+	check(tier)
+
+	// 重新打开后从日志恢复
+	tier.f.Close()
+	if tier, err = openDiskTier(path, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	check(tier)
+}
+
+func TestDiskTier_queue(t *testing.T) {
+	// 目录不存在时自动创建
+	tier, err := openDiskTier(filepath.Join(t.TempDir(), "sub", "disk.log"), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tier.put("a", ByteView{b: []byte("old")})
+	tier.put("b", ByteView{b: []byte("2")})
+	tier.put("c", ByteView{b: []byte("3")})
+
+	// 队列中的操作在写入日志前就对读取和删除可见
+	tier.enqueue("a", diskOp{value: ByteView{b: []byte("new")}})
+	tier.enqueue("b", diskOp{del: true})
+	tier.enqueue("c", diskOp{value: ByteView{b: []byte("4")}})
+	if v, ok := tier.get("a"); !ok || v.String() != "new" {
+		t.Errorf("a = %q, %v", v.String(), ok)
+	}
+	if _, ok := tier.get("b"); ok {
+		t.Error("b should be deleted")
+	}
+	if !tier.remove("c") {
+		t.Error("queued c should exist")
+	}
+
+	tier.flush()
+	if v, ok := tier.get("a"); !ok || v.String() != "new" {
+		t.Errorf("a = %q, %v after flush", v.String(), ok)
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, ok := tier.get(key); ok {
+			t.Errorf("%s should not exist after flush", key)
+		}
+	}
+}
+
+func TestDiskTier_budget(t *testing.T) {
+	value := []byte(strings.Repeat("v", 100))
+	recordSize := int64(diskHeaderSize + 2 + len(value))
+	tier, err := openDiskTier(filepath.Join(t.TempDir(), "disk.log"), 5*recordSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		tier.put(fmt.Sprintf("k%d", i), ByteView{b: value})
+	}
+	// 超出预算时按写入顺序淘汰最早的记录
+	if stats := tier.stats(); stats.Items != 5 || stats.Bytes != 5*recordSize {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if _, ok := tier.get("k4"); ok {
+		t.Error("k4 should be evicted")
+	}
+	if _, ok := tier.get("k5"); !ok {
+		t.Error("k5 should exist")
+	}
+}
+
+func TestDiskTier_compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.log")
+	value := []byte(strings.Repeat("v", 64<<10))
+	tier, err := openDiskTier(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 反复覆盖同一批key产生大量无效字节
+	for i := 0; i < 200; i++ {
+		tier.put(fmt.Sprintf("k%d", i%4), ByteView{b: value})
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit := 2*tier.live + diskCompactMinGarbage; info.Size() > limit {
+		t.Fatalf("log size %d exceeds %d after compaction", info.Size(), limit)
+	}
+	for i := 0; i < 4; i++ {
+		if v, ok := tier.get(fmt.Sprintf("k%d", i)); !ok || v.Len() != len(value) {
+			t.Errorf("k%d = %d bytes, %v", i, v.Len(), ok)
+		}
+	}
+}
+
+func TestDiskTier_recover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.log")
+	tier, err := openDiskTier(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tier.put("a", ByteView{b: []byte("1")})
+	tier.put("b", ByteView{b: []byte("2")})
+	size := tier.size
+	tier.f.Close()
+
+	// 模拟写入到一半时崩溃：日志末尾只有一条记录的前半部分
+	partial := encodeDiskRecord(diskPut, "c", []byte("3"), 0)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(partial[:len(partial)/2])
+	f.Close()
+
+	if tier, err = openDiskTier(path, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if tier.size != size {
+		t.Errorf("size = %d, want %d", tier.size, size)
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, ok := tier.get(key); !ok {
+			t.Errorf("%s should be recovered", key)
+		}
+	}
+	// 截断后可以继续写入
+	tier.put("c", ByteView{b: []byte("3")})
+	tier.f.Close()
+	if tier, err = openDiskTier(path, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := tier.get("c"); !ok || v.String() != "3" {
+		t.Errorf("c = %q, %v", v.String(), ok)
+	}
+	// 记录头中的长度损坏时不按该长度分配内存，同样从该记录处截断
+	size = tier.size
+	tier.f.Close()
+	corrupt := encodeDiskRecord(diskPut, "d", []byte("4"), 0)
+	binary.BigEndian.PutUint32(corrupt[9:], math.MaxUint32)
+	if f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Write(corrupt)
+	f.Close()
+	if tier, err = openDiskTier(path, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if tier.size != size {
+		t.Errorf("size = %d after corrupt header, want %d", tier.size, size)
+	}
+}
+
+func TestCache_diskTier(t *testing.T) {
+	c, err := NewCache(64, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.disk, err = openDiskTier(filepath.Join(t.TempDir(), "disk.log"), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	// 每个缓存分片只能容纳4字节，写入同一分片的其他key会淘汰旧的key
+	for i := 0; i < 100; i++ {
+		c.add(fmt.Sprintf("k%d", i), ByteView{b: []byte("vv")})
+	}
+	c.disk.flush()
+	if c.disk.stats().Items == 0 {
+		t.Fatal("evicted entries should be written to disk")
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := c.get(fmt.Sprintf("k%d", i)); !ok || v.String() != "vv" {
+			t.Errorf("k%d = %q, %v", i, v.String(), ok)
+		}
+	}
+
+	// 更新和删除会使磁盘中的旧值失效
+	c.add("k0", ByteView{b: []byte("new")})
+	c.add("k2", ByteView{b: []byte("vv")})
+	if v, ok := c.get("k0"); !ok || v.String() != "new" {
+		t.Errorf("k0 = %q, %v", v.String(), ok)
+	}
+	if c.remove("k1"); c.disk.remove("k1") {
+		t.Error("k1 should be removed from disk")
+	}
+	if _, ok := c.get("k1"); ok {
+		t.Error("k1 should be removed")
+	}
+}
+
+func TestCache_diskTierExpiredEviction(t *testing.T) {
+	c, err := NewCache(1<<10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.disk, err = openDiskTier(filepath.Join(t.TempDir(), "disk.log"), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟后台清理在 add 删除磁盘旧值后又把旧值淘汰到磁盘
+	c.strategy.Add("k", ByteView{b: []byte("new"), expireAt: time.Now().Add(20 * time.Millisecond)})
+	c.disk.put("k", ByteView{b: []byte("old")})
+	time.Sleep(30 * time.Millisecond)
+
+	// 新值过期后不应读到磁盘中的旧值
+	if v, ok := c.get("k"); ok {
+		t.Errorf("k = %q after the new value expired", v.String())
+	}
+	c.disk.flush()
+	if c.disk.stats().Items != 0 {
+		t.Error("expired eviction should remove the stale value from disk")
+	}
+}
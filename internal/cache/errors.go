@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrPeerUnavailable 表示远程节点不可达或响应超时，这类错误会按失败策略重试
+	ErrPeerUnavailable = errors.New("peer unavailable")
+	// ErrNotFound 表示key在数据源中不存在，Getter 可以返回或包装该错误；
+	// 节点间以 codes.NotFound 传递，HTTP网关返回404
+	ErrNotFound = errors.New("key not found")
+	// ErrGroupNotFound 表示请求的 Group 不存在
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrEmptyKey 表示请求的key为空
+	ErrEmptyKey = errors.New("key is empty")
+)
+
+// PeerError 表示按失败策略重试后仍无法从远程节点完成请求
+type PeerError struct {
+	Peer  string // 远程节点地址
+	Group string
+	Key   string // 批量请求时为空
+	Err   error  // 最后一次失败的原因
+}
+
+func (e *PeerError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("peer %s failed for group %s: %v", e.Peer, e.Group, e.Err)
+	}
+	return fmt.Sprintf("peer %s failed for %s/%s: %v", e.Peer, e.Group, e.Key, e.Err)
+}
+
+func (e *PeerError) Unwrap() error {
+	return e.Err
+}
+
+// 将缓存错误转换为带状态码的gRPC错误，错误信息保持不变
+func grpcError(err error) error {
+	var peerErr *PeerError
+	code := codes.Unknown
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrGroupNotFound):
+		code = codes.NotFound
+	case errors.Is(err, ErrEmptyKey):
+		code = codes.InvalidArgument
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, ErrPeerUnavailable), errors.As(err, &peerErr):
+		code = codes.Unavailable
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,206 @@
+package eviction
+
+import "container/list"
+
+// CacheUseARC 自适应替换缓存（Adaptive Replacement Cache），同时维护最近访问和经常访问两个队列，
+// 并根据幽灵队列的命中情况动态调整两者的容量比例，批量扫描只会冲刷最近访问队列。
+type CacheUseARC struct {
+	*segmentedCache
+}
+
+func NewARCCache(maxBytes int64, onEvicted func(string, Value)) *CacheUseARC {
+	return &CacheUseARC{
+		segmentedCache: newSegmentedCache(maxBytes, onEvicted, func(maxBytes int64, onEvicted func(string, Value)) shard {
+			return newARCShard(maxBytes, onEvicted)
+		}),
+	}
+}
+
+// ARC中的四个队列
+const (
+	arcT1 = iota // 只访问过一次的缓存
+	arcT2        // 访问过多次的缓存
+	arcB1        // 从T1淘汰的幽灵记录，只保留key和大小
+	arcB2        // 从T2淘汰的幽灵记录
+)
+
+// ARC缓存分片中的元素
+type arcItem struct {
+	key   string
+	entry *Entry // 幽灵记录的entry为nil
+	size  int64
+	where int // 所在的队列
+}
+
+// ARC缓存分片，按字节而非条目数计算各队列容量
+type arcShard struct {
+	maxBytes  int64
+	p         int64         // T1的目标容量，随幽灵队列命中自适应调整
+	lists     [4]*list.List // 各队列，队头为最近访问
+	sizes     [4]int64      // 各队列占用的字节数
+	items     map[string]*list.Element
+	onEvicted func(key string, value Value)
+}
+
+func newARCShard(maxBytes int64, onEvicted func(string, Value)) *arcShard {
+	s := &arcShard{
+		maxBytes:  maxBytes,
+		items:     make(map[string]*list.Element),
+		onEvicted: onEvicted,
+	}
+	for i := range s.lists {
+		s.lists[i] = list.New()
+	}
+	return s
+}
+
+func (s *arcShard) get(key string) (*Entry, bool) {
+	elm, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := elm.Value.(*arcItem)
+	if item.where == arcB1 || item.where == arcB2 {
+		// 幽灵记录不保存value，视为未命中
+		return nil, false
+	}
+	// 再次访问的缓存移入T2
+	s.move(elm, arcT2)
+	return item.entry, true
+}
+
+func (s *arcShard) add(key string, value Value) {
+	size := entrySize(key, value)
+	elm, ok := s.items[key]
+	if !ok {
+		// 新缓存放入T1，先淘汰旧缓存腾出空间，否则缓存预热后T1中只有新缓存，会被立即淘汰
+		s.replace(false, size)
+		s.items[key] = s.push(&arcItem{key: key, entry: newEntry(key, value), size: size}, arcT1)
+		s.replace(false, 0)
+		s.trimGhosts()
+		return
+	}
+
+	item := elm.Value.(*arcItem)
+	fromB2 := item.where == arcB2
+	switch item.where {
+	case arcB1:
+		// 命中B1说明T1容量不足，增大T1的目标容量
+		s.p = min(s.maxBytes, s.p+s.delta(size, s.sizes[arcB2], s.sizes[arcB1]))
+	case arcB2:
+		// 命中B2说明T2容量不足，减小T1的目标容量
+		s.p = max(0, s.p-s.delta(size, s.sizes[arcB1], s.sizes[arcB2]))
+	}
+	s.sizes[item.where] += size - item.size
+	item.size = size
+	if item.entry == nil {
+		item.entry = newEntry(key, value)
+	} else {
+		item.entry.value = value
+		item.entry.UpdatedTTLTime()
+	}
+	s.move(elm, arcT2)
+	s.replace(fromB2, 0)
+	s.trimGhosts()
+}
+
+func (s *arcShard) remove(key string) (*Entry, bool) {
+	elm, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := elm.Value.(*arcItem)
+	s.unlink(elm)
+	delete(s.items, key)
+	if item.where == arcB1 || item.where == arcB2 {
+		return nil, false
+	}
+	return item.entry, true
+}
+
+func (s *arcShard) rangeEntries(fn func(e *Entry) bool) {
+	for _, where := range []int{arcT1, arcT2} {
+		for elm := s.lists[where].Front(); elm != nil; elm = elm.Next() {
+			if !fn(elm.Value.(*arcItem).entry) {
+				return
+			}
+		}
+	}
+}
+
+func (s *arcShard) len() int {
+	return s.lists[arcT1].Len() + s.lists[arcT2].Len()
+}
+
+func (s *arcShard) bytes() int64 {
+	return s.sizes[arcT1] + s.sizes[arcT2]
+}
+
+// 计算幽灵命中时目标容量的调整幅度，另一侧幽灵队列越大调整越多
+func (s *arcShard) delta(size, other, hit int64) int64 {
+	if hit > 0 && other > hit {
+		return size * other / hit
+	}
+	return size
+}
+
+// 缓存占用再加入 extra 字节会超出容量时，按目标容量从T1或T2淘汰缓存，被淘汰的缓存转为幽灵记录
+func (s *arcShard) replace(fromB2 bool, extra int64) {
+	for s.maxBytes != 0 && s.sizes[arcT1]+s.sizes[arcT2]+extra > s.maxBytes && s.len() > 0 {
+		from := arcT2
+		if s.lists[arcT1].Len() > 0 && (s.sizes[arcT1] > s.p || (fromB2 && s.sizes[arcT1] == s.p) || s.lists[arcT2].Len() == 0) {
+			from = arcT1
+		}
+		elm := s.lists[from].Back()
+		item := elm.Value.(*arcItem)
+		entry := item.entry
+		item.entry = nil
+		if from == arcT1 {
+			s.move(elm, arcB1)
+		} else {
+			s.move(elm, arcB2)
+		}
+		if s.onEvicted != nil {
+			s.onEvicted(entry.key, entry.value)
+		}
+	}
+}
+
+// 限制幽灵记录的规模：T1+B1不超过容量，全部队列不超过两倍容量
+func (s *arcShard) trimGhosts() {
+	if s.maxBytes == 0 {
+		return
+	}
+	for s.sizes[arcT1]+s.sizes[arcB1] > s.maxBytes && s.lists[arcB1].Len() > 0 {
+		s.dropGhost(arcB1)
+	}
+	for s.sizes[arcT1]+s.sizes[arcT2]+s.sizes[arcB1]+s.sizes[arcB2] > 2*s.maxBytes && s.lists[arcB2].Len() > 0 {
+		s.dropGhost(arcB2)
+	}
+}
+
+// 删除幽灵队列中最久的记录
+func (s *arcShard) dropGhost(where int) {
+	elm := s.lists[where].Back()
+	s.unlink(elm)
+	delete(s.items, elm.Value.(*arcItem).key)
+}
+
+// 将元素移动到指定队列的队头
+func (s *arcShard) move(elm *list.Element, where int) {
+	item := elm.Value.(*arcItem)
+	s.unlink(elm)
+	s.items[item.key] = s.push(item, where)
+}
+
+func (s *arcShard) push(item *arcItem, where int) *list.Element {
+	item.where = where
+	s.sizes[where] += item.size
+	return s.lists[where].PushFront(item)
+}
+
+func (s *arcShard) unlink(elm *list.Element) {
+	item := elm.Value.(*arcItem)
+	s.lists[item.where].Remove(elm)
+	s.sizes[item.where] -= item.size
+}
@@ -0,0 +1,151 @@
+package eviction
+
+import "container/list"
+
+// CacheUseLFU 按访问频率淘汰缓存，访问次数最少的缓存最先被淘汰，次数相同时淘汰最久未访问的。
+// 适合热点稳定的场景，偶发的批量扫描不会冲掉高频访问的缓存。
+type CacheUseLFU struct {
+	*segmentedCache
+}
+
+func NewLFUCache(maxBytes int64, onEvicted func(string, Value)) *CacheUseLFU {
+	return &CacheUseLFU{
+		segmentedCache: newSegmentedCache(maxBytes, onEvicted, func(maxBytes int64, onEvicted func(string, Value)) shard {
+			return newLFUShard(maxBytes, onEvicted)
+		}),
+	}
+}
+
+// LFU缓存分片中的元素
+type lfuItem struct {
+	entry *Entry
+	freq  int // 访问次数
+}
+
+// LFU缓存分片，每个访问次数对应一个双向链表，查找、新增和淘汰均为O(1)
+type lfuShard struct {
+	maxBytes  int64
+	nowBytes  int64
+	items     map[string]*list.Element
+	freqs     map[int]*list.List // 访问次数 -> 该次数下的缓存，队头为最久未访问
+	minFreq   int                // 当前最小的访问次数
+	onEvicted func(key string, value Value)
+}
+
+func newLFUShard(maxBytes int64, onEvicted func(string, Value)) *lfuShard {
+	return &lfuShard{
+		maxBytes:  maxBytes,
+		items:     make(map[string]*list.Element),
+		freqs:     make(map[int]*list.List),
+		onEvicted: onEvicted,
+	}
+}
+
+func (s *lfuShard) get(key string) (*Entry, bool) {
+	if elm, ok := s.items[key]; ok {
+		s.touch(elm)
+		return elm.Value.(*lfuItem).entry, true
+	}
+	return nil, false
+}
+
+func (s *lfuShard) add(key string, value Value) {
+	if elm, ok := s.items[key]; ok {
+		// 修改
+		entry := elm.Value.(*lfuItem).entry
+		s.nowBytes += entrySize(key, value) - entrySize(key, entry.value)
+		entry.value = value
+		entry.UpdatedTTLTime()
+		s.touch(elm)
+	} else {
+		// 添加：先淘汰旧缓存腾出空间，再以访问次数1加入，否则缓存预热后新缓存总是访问次数最少的，会被立即淘汰
+		size := entrySize(key, value)
+		s.evict(size)
+		s.items[key] = s.pushFreq(&lfuItem{entry: newEntry(key, value), freq: 1})
+		s.minFreq = 1
+		s.nowBytes += size
+	}
+	// 修改后变大的缓存，或单个超出容量的缓存
+	s.evict(0)
+}
+
+// 淘汰访问次数最少的缓存，直到再加入 extra 字节也不超出容量
+func (s *lfuShard) evict(extra int64) {
+	for s.maxBytes != 0 && s.nowBytes+extra > s.maxBytes && len(s.items) > 0 {
+		elm := s.freqs[s.minFreq].Front()
+		entry := s.removeElement(elm)
+		if s.onEvicted != nil {
+			s.onEvicted(entry.key, entry.value)
+		}
+	}
+}
+
+func (s *lfuShard) remove(key string) (*Entry, bool) {
+	if elm, ok := s.items[key]; ok {
+		return s.removeElement(elm), true
+	}
+	return nil, false
+}
+
+func (s *lfuShard) rangeEntries(fn func(e *Entry) bool) {
+	for _, elm := range s.items {
+		if !fn(elm.Value.(*lfuItem).entry) {
+			return
+		}
+	}
+}
+
+func (s *lfuShard) len() int {
+	return len(s.items)
+}
+
+func (s *lfuShard) bytes() int64 {
+	return s.nowBytes
+}
+
+// 访问次数加一，移动到下一个访问次数的链表
+func (s *lfuShard) touch(elm *list.Element) {
+	item := elm.Value.(*lfuItem)
+	l := s.freqs[item.freq]
+	l.Remove(elm)
+	if l.Len() == 0 {
+		delete(s.freqs, item.freq)
+		// 该元素将移入下一个访问次数，它就是新的最小访问次数
+		if s.minFreq == item.freq {
+			s.minFreq++
+		}
+	}
+	item.freq++
+	s.items[item.entry.key] = s.pushFreq(item)
+}
+
+// 将元素放入对应访问次数链表的队尾
+func (s *lfuShard) pushFreq(item *lfuItem) *list.Element {
+	l, ok := s.freqs[item.freq]
+	if !ok {
+		l = list.New()
+		s.freqs[item.freq] = l
+	}
+	return l.PushBack(item)
+}
+
+func (s *lfuShard) removeElement(elm *list.Element) *Entry {
+	item := elm.Value.(*lfuItem)
+	l := s.freqs[item.freq]
+	l.Remove(elm)
+	if l.Len() == 0 {
+		delete(s.freqs, item.freq)
+		// 最小访问次数的链表被删空时重新查找
+		if s.minFreq == item.freq {
+			s.minFreq = 0
+			for freq := range s.freqs {
+				if s.minFreq == 0 || freq < s.minFreq {
+					s.minFreq = freq
+				}
+			}
+		}
+	}
+	delete(s.items, item.entry.key)
+	s.nowBytes -= entrySize(item.entry.key, item.entry.value)
+	return item.entry
+}
@@ -30,9 +30,11 @@ type segment struct {
 	cache map[string]*list.Element
 	// 记录被移除时的回调函数
 	OnEvicted func(key string, value Value)
+	// 累计淘汰的缓存数量
+	evictions int64
 }
 
-// CacheUseLRU 负责管理缓存分片，支持查找、新增或更新，不直接支持删除
+// CacheUseLRU 负责管理缓存分片，支持查找、新增或更新、删除
 // 分片设计，将整个缓存划分为多个独立的分片。
 type CacheUseLRU struct {
 	// 缓存分片集合
@@ -66,7 +68,7 @@ func NewLRUCache(maxBytes int64, onEvicted func(string, Value)) *CacheUseLRU {
 		}
 	}
 	// 开启定时清理过期缓存的任务
-	go cache.cleanUpRoutine()
+	go cache.cleanUpRoutine(cache.stopCleanup, cache.cleanupInterval)
 
 	return cache
 }
@@ -81,14 +83,20 @@ func (cache *CacheUseLRU) getSegment(key string) *segment {
 }
 
 // Get 在管理器中查找对应缓存段中的value, 并移动value至队列尾部
+// 值自身携带的过期时间已到时，删除该缓存并视为未命中
 func (cache *CacheUseLRU) Get(key string) (value Value, updateAt time.Time, ok bool) {
 	seg := cache.getSegment(key)
-	seg.mu.RLock()
-	defer seg.mu.RUnlock()
+	// 移动链表节点会修改缓存段，需要加写锁
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
 
 	if elm, ok := seg.cache[key]; ok {
-		seg.ll.MoveToBack(elm)
 		kv := elm.Value.(*Entry)
+		if kv.valueExpired() {
+			seg.removeElement(elm)
+			return nil, time.Time{}, false
+		}
+		seg.ll.MoveToBack(elm)
 		kv.UpdatedTTLTime() // 更新TTL时间
 		return kv.value, kv.updateAt, true
 	}
@@ -100,6 +108,11 @@ func (cache *CacheUseLRU) Add(key string, value Value) {
 	seg := cache.getSegment(key)
 	seg.mu.Lock()
 	defer seg.mu.Unlock()
+	seg.add(key, value, time.Now())
+}
+
+// 新增或更新value并移动至队列尾部，updateAt 为该缓存上次被访问的时间，调用方需持有写锁
+func (seg *segment) add(key string, value Value, updateAt time.Time) {
 	// 计算最新的k+v比特大小
 	newBytes := int64(len(key)) + int64(value.Len())
 	// 尝试在缓存段中根据key获取value
@@ -108,7 +121,7 @@ func (cache *CacheUseLRU) Add(key string, value Value) {
 		entry := elm.Value.(*Entry)
 		oldBytes := int64(len(entry.key)) + int64(entry.value.Len())
 		entry.value = value
-		entry.UpdatedTTLTime() // 更新TTL时间
+		entry.updateAt = updateAt // 更新TTL时间
 		seg.nowBytes = seg.nowBytes - oldBytes + newBytes
 		seg.ll.MoveToBack(elm)
 	} else {
@@ -116,7 +129,7 @@ func (cache *CacheUseLRU) Add(key string, value Value) {
 		entry := &Entry{
 			key:      key,
 			value:    value,
-			updateAt: time.Now(),
+			updateAt: updateAt,
 		}
 		elm = seg.ll.PushBack(entry)
 		seg.cache[key] = elm
@@ -129,6 +142,73 @@ func (cache *CacheUseLRU) Add(key string, value Value) {
 	}
 }
 
+// Remove 主动删除缓存段中的value，返回key是否存在；主动删除不会触发淘汰回调
+func (cache *CacheUseLRU) Remove(key string) bool {
+	seg := cache.getSegment(key)
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+
+	if elm, ok := seg.cache[key]; ok {
+		seg.deleteElement(elm)
+		return true
+	}
+	return false
+}
+
+// Range 依次遍历各缓存段的快照，同一缓存段内按最久未访问到最近访问的顺序
+func (cache *CacheUseLRU) Range(fn func(key string, value Value) bool) {
+	for _, seg := range cache.segments {
+		seg.mu.RLock()
+		// 复制缓存元数据，避免在锁外读取被并发修改的值
+		entries := make([]Entry, 0, seg.ll.Len())
+		for elm := seg.ll.Front(); elm != nil; elm = elm.Next() {
+			entries = append(entries, *elm.Value.(*Entry))
+		}
+		seg.mu.RUnlock()
+
+		if !rangeSnapshot(entries, fn) {
+			return
+		}
+	}
+}
+
+// Snapshot 依次导出各缓存段中未过期的缓存，同一缓存段内按最久未访问到最近访问的顺序
+func (cache *CacheUseLRU) Snapshot() []SnapshotEntry {
+	now := time.Now()
+	var entries []SnapshotEntry
+	for _, seg := range cache.segments {
+		seg.mu.RLock()
+		for elm := seg.ll.Front(); elm != nil; elm = elm.Next() {
+			e := elm.Value.(*Entry)
+			if e.valueExpired() {
+				continue
+			}
+			entries = append(entries, SnapshotEntry{Key: e.key, Value: e.value, Idle: now.Sub(e.updateAt)})
+		}
+		seg.mu.RUnlock()
+	}
+	return entries
+}
+
+// Restore 按 Snapshot 的顺序写入缓存，恢复后的缓存保持原有的访问顺序和空闲时间；
+// 空闲时间已超过TTL的缓存会被跳过
+func (cache *CacheUseLRU) Restore(entries []SnapshotEntry) {
+	cache.mu.RLock()
+	ttl := cache.ttl
+	cache.mu.RUnlock()
+
+	now := time.Now()
+	for _, e := range entries {
+		if e.Idle >= ttl {
+			continue
+		}
+		seg := cache.getSegment(e.Key)
+		seg.mu.Lock()
+		seg.add(e.Key, e.Value, now.Add(-e.Idle))
+		seg.mu.Unlock()
+	}
+}
+
 // 删除缓存段中的最近最少使用(队头)数据
 func (seg *segment) removeOldest() {
 	if ele := seg.ll.Front(); ele != nil {
@@ -136,21 +216,28 @@ func (seg *segment) removeOldest() {
 	}
 }
 
-// 删除缓存段中的缓存数据
+// 淘汰缓存段中的缓存数据，并触发淘汰回调
 func (seg *segment) removeElement(elm *list.Element) {
-	seg.ll.Remove(elm)
-	entry := elm.Value.(*Entry)
-	delete(seg.cache, entry.key)                                     // 从哈希表中删除对应key
-	seg.nowBytes -= int64(len(entry.key)) + int64(entry.value.Len()) // 计算缓存段中的nowBytes
+	entry := seg.deleteElement(elm)
+	seg.evictions++
 
 	if seg.OnEvicted != nil {
 		seg.OnEvicted(entry.key, entry.value)
 	}
 }
 
-// 定时触发TTL缓存队列检查
-func (cache *CacheUseLRU) cleanUpRoutine() {
-	ticker := time.NewTicker(cache.cleanupInterval) // 新建一个定时器
+// 从链表和哈希表中移除缓存数据
+func (seg *segment) deleteElement(elm *list.Element) *Entry {
+	seg.ll.Remove(elm)
+	entry := elm.Value.(*Entry)
+	delete(seg.cache, entry.key)                                     // 从哈希表中删除对应key
+	seg.nowBytes -= int64(len(entry.key)) + int64(entry.value.Len()) // 计算缓存段中的nowBytes
+	return entry
+}
+
+// 定时触发TTL缓存队列检查，stop 和 interval 由启动方在持有锁时传入，不再读取可能被替换的字段
+func (cache *CacheUseLRU) cleanUpRoutine(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval) // 新建一个定时器
 	defer ticker.Stop()
 
 	for {
@@ -158,7 +245,7 @@ func (cache *CacheUseLRU) cleanUpRoutine() {
 		case <-ticker.C:
 			// 到达定时器触发时间，清除一次TTL过期的缓存
 			cache.cleanUPSegments()
-		case <-cache.stopCleanup:
+		case <-stop:
 			return
 		}
 	}
@@ -203,6 +290,28 @@ func (cache *CacheUseLRU) Len() int {
 	return total
 }
 
+// Bytes 对外提供 计算当前缓存段集占用的字节数
+func (cache *CacheUseLRU) Bytes() int64 {
+	var total int64
+	for _, seg := range cache.segments {
+		seg.mu.RLock()
+		total += seg.nowBytes
+		seg.mu.RUnlock()
+	}
+	return total
+}
+
+// Evictions 对外提供 累计淘汰的缓存数量，包括过期清理
+func (cache *CacheUseLRU) Evictions() int64 {
+	var total int64
+	for _, seg := range cache.segments {
+		seg.mu.RLock()
+		total += seg.evictions
+		seg.mu.RUnlock()
+	}
+	return total
+}
+
 // SetTTL 对外提供 设置缓存管理器TTL时间的方法
 func (cache *CacheUseLRU) SetTTL(ttl time.Duration) {
 	cache.mu.Lock()
@@ -220,7 +329,7 @@ func (cache *CacheUseLRU) SetCleanupInterval(interval time.Duration) {
 	cache.stopCleanup = make(chan struct{})
 	cache.cleanupInterval = interval
 
-	go cache.cleanUpRoutine()
+	go cache.cleanUpRoutine(cache.stopCleanup, cache.cleanupInterval)
 }
 
 // Stop 停止当前的清理goroutine
@@ -12,6 +12,10 @@ func (d String) Len() int {
 	return len(d)
 }
 
+func (d String) AppendBytes(dst []byte) []byte {
+	return append(dst, d...)
+}
+
 // TestCacheUseLRU_Basic 测试基础功能
 func TestCacheUseLRU_Basic(t *testing.T) {
 	// 定义一个测试用例，名称为"creation"
@@ -52,6 +56,29 @@ func TestCacheUseLRU_Basic(t *testing.T) {
 			t.Errorf("更新后获取键'key1'失败，实际值为 %v，期望值为 'value2'", v)
 		}
 	})
+
+	// 定义一个测试用例，名称为"remove"
+	t.Run("remove", func(t *testing.T) {
+		evicted := 0
+		lru := NewLRUCache(1024, func(string, Value) { evicted++ })
+
+		lru.Add("key1", String("value1"))
+		// 删除存在的键
+		if !lru.Remove("key1") {
+			t.Error("删除存在的键'key1'应返回true")
+		}
+		if _, _, ok := lru.Get("key1"); ok {
+			t.Error("删除后不应再获取到键'key1'")
+		}
+		// 删除不存在的键
+		if lru.Remove("missing") {
+			t.Error("删除不存在的键应返回false")
+		}
+		// 主动删除不触发淘汰回调
+		if evicted != 0 {
+			t.Errorf("主动删除不应触发淘汰回调，实际触发 %d 次", evicted)
+		}
+	})
 }
 
 // TestCacheUseLRU_CleanUp 用于测试 LRU 缓存的清理功能
@@ -92,6 +119,42 @@ func TestCacheUseLRU_CleanUp(t *testing.T) {
 	}
 }
 
+// expiringString 自身携带过期时间的测试值
+type expiringString struct {
+	String
+	expireAt time.Time
+}
+
+func (e expiringString) ExpireAt() time.Time {
+	return e.expireAt
+}
+
+// TestCacheUseLRU_ValueExpire 测试值自身携带的过期时间
+func TestCacheUseLRU_ValueExpire(t *testing.T) {
+	lru := NewLRUCache(1024, nil)
+	lru.SetCleanupInterval(50 * time.Millisecond)
+
+	lru.Add("short", expiringString{String("v1"), time.Now().Add(30 * time.Millisecond)})
+	lru.Add("long", expiringString{String("v2"), time.Now().Add(time.Hour)})
+	lru.Add("forever", expiringString{String: String("v3")})
+
+	if _, _, ok := lru.Get("short"); !ok {
+		t.Fatal("未过期的键'short'应该存在")
+	}
+	time.Sleep(40 * time.Millisecond)
+	// 读取时发现过期，视为未命中
+	if _, _, ok := lru.Get("short"); ok {
+		t.Error("过期的键'short'不应再被获取到")
+	}
+
+	lru.Add("short", expiringString{String("v1"), time.Now().Add(30 * time.Millisecond)})
+	// 等待清理任务删除过期条目
+	time.Sleep(100 * time.Millisecond)
+	if lru.Len() != 2 {
+		t.Errorf("清理后应剩余 2 个条目，当前长度为 %d", lru.Len())
+	}
+}
+
 func TestCacheUseLRU_Concurrent(t *testing.T) {
 	lru := NewLRUCache(1024, nil)
 	var wg sync.WaitGroup
@@ -125,3 +188,42 @@ func TestCacheUseLRU_Concurrent(t *testing.T) {
 	wg.Wait()
 	//fmt.Println("\n共存在", lru.Len(), "个缓存数据")
 }
+
+// TestCacheUseLRU_Snapshot 测试快照的导出和恢复保留访问顺序与空闲时间
+func TestCacheUseLRU_Snapshot(t *testing.T) {
+	lru := NewLRUCache(1<<20, nil)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		lru.Add(key, String("v"+key))
+	}
+	lru.Get("a") // 访问后 a 成为最近访问的缓存
+	lru.Add("expired", expiringString{String("v"), time.Now().Add(-time.Second)})
+
+	entries := lru.Snapshot()
+	if len(entries) != 4 {
+		t.Fatalf("快照应包含 4 个未过期的条目，实际为 %d", len(entries))
+	}
+	entries[0].Idle = time.Minute
+
+	restored := NewLRUCache(1<<20, nil)
+	restored.Restore(entries)
+	got := restored.Snapshot()
+	if len(got) != len(entries) {
+		t.Fatalf("恢复后应有 %d 个条目，实际为 %d", len(entries), len(got))
+	}
+	for i := range entries {
+		if got[i].Key != entries[i].Key || got[i].Value != entries[i].Value {
+			t.Errorf("第 %d 个条目为 %s=%v，期望 %s=%v", i, got[i].Key, got[i].Value, entries[i].Key, entries[i].Value)
+		}
+	}
+	if got[0].Idle < time.Minute {
+		t.Errorf("恢复后应保留空闲时间，实际为 %v", got[0].Idle)
+	}
+
+	// 空闲时间超过TTL的条目不会被恢复
+	restored = NewLRUCache(1<<20, nil)
+	restored.SetTTL(30 * time.Second)
+	restored.Restore(entries)
+	if restored.Len() != 3 {
+		t.Errorf("应跳过空闲超过TTL的条目，实际长度为 %d", restored.Len())
+	}
+}
@@ -0,0 +1,117 @@
+package eviction
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policy 缓存淘汰策略需要实现的方法，上层缓存只依赖该接口
+type Policy interface {
+	// Get 查找key对应的value，并更新该缓存的访问信息
+	Get(key string) (value Value, updateAt time.Time, ok bool)
+	// Add 新增或更新value，超出容量时按策略淘汰并触发淘汰回调
+	Add(key string, value Value)
+	// Remove 主动删除value，返回key是否存在，不触发淘汰回调
+	Remove(key string) bool
+	// Range 按分片依次遍历缓存的快照，fn 返回false时停止。fn 在锁外调用，可以执行耗时操作，
+	// 但遍历期间的修改不一定会被反映；已过期的缓存会被跳过
+	Range(fn func(key string, value Value) bool)
+	// Len 返回当前缓存数据个数
+	Len() int
+	// Bytes 返回当前缓存占用的字节数
+	Bytes() int64
+	// Evictions 返回累计淘汰的缓存数量，包括过期清理
+	Evictions() int64
+	// SetTTL 设置缓存未被访问时的过期时间
+	SetTTL(ttl time.Duration)
+	// SetCleanupInterval 设置清理过期缓存的定时器时间
+	SetCleanupInterval(interval time.Duration)
+	// Stop 停止清理过期缓存的goroutine
+	Stop()
+}
+
+// SnapshotEntry 快照中的一条缓存
+type SnapshotEntry struct {
+	Key   string
+	Value Value
+	Idle  time.Duration // 距上次访问的时间，恢复后据此计算剩余的TTL
+}
+
+// Snapshotter 由能按淘汰顺序导出和恢复缓存的策略实现，用于重启前后保留缓存
+type Snapshotter interface {
+	// Snapshot 按分片导出所有未过期的缓存，同一分片内按最先淘汰到最后淘汰的顺序
+	Snapshot() []SnapshotEntry
+	// Restore 按 Snapshot 的顺序写入缓存，保留访问顺序和空闲时间
+	Restore(entries []SnapshotEntry)
+}
+
+// PolicyType 淘汰策略的名称
+type PolicyType string
+
+const (
+	PolicyLRU     PolicyType = "lru"     // 最近最少使用
+	PolicyLFU     PolicyType = "lfu"     // 最不经常使用
+	PolicyARC     PolicyType = "arc"     // 自适应替换缓存
+	PolicyTinyLFU PolicyType = "tinylfu" // W-TinyLFU，窗口LRU + 频率准入的分段LRU
+	PolicyRing    PolicyType = "ring"    // 环形字节缓冲区 + CLOCK淘汰，减少GC开销
+)
+
+// Validate 检查策略名称是否受支持，名称为空时表示LRU
+func (kind PolicyType) Validate() error {
+	switch kind {
+	case PolicyLRU, PolicyLFU, PolicyARC, PolicyTinyLFU, PolicyRing, "":
+		return nil
+	default:
+		return fmt.Errorf("unknown eviction policy %q", kind)
+	}
+}
+
+// Option 创建淘汰策略时的可选配置
+type Option func(*options)
+
+type options struct {
+	decode Decoder
+}
+
+// WithDecoder 设置 PolicyRing 将字节还原为值的函数，默认还原为 Bytes；其他策略忽略该配置
+func WithDecoder(decode Decoder) Option {
+	return func(o *options) {
+		o.decode = decode
+	}
+}
+
+var (
+	_ Policy = (*CacheUseLRU)(nil)
+	_ Policy = (*CacheUseLFU)(nil)
+	_ Policy = (*CacheUseARC)(nil)
+	_ Policy = (*CacheUseTinyLFU)(nil)
+	_ Policy = (*CacheUseRing)(nil)
+
+	_ Snapshotter = (*CacheUseLRU)(nil)
+)
+
+// New 根据策略名称创建对应的缓存管理器，名称为空时使用LRU
+func New(kind PolicyType, maxBytes int64, onEvicted func(string, Value), opts ...Option) (Policy, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	switch kind {
+	case PolicyLRU, "":
+		return NewLRUCache(maxBytes, onEvicted), nil
+	case PolicyLFU:
+		return NewLFUCache(maxBytes, onEvicted), nil
+	case PolicyARC:
+		return NewARCCache(maxBytes, onEvicted), nil
+	case PolicyTinyLFU:
+		return NewTinyLFUCache(maxBytes, onEvicted), nil
+	case PolicyRing:
+		// 环形缓冲区按容量预先分配，不支持其他策略中表示不限容量的0
+		if maxBytes <= 0 {
+			return nil, fmt.Errorf("ring cache needs a positive size, got %d", maxBytes)
+		}
+		return NewRingCache(maxBytes, onEvicted, o.decode), nil
+	default:
+		return nil, fmt.Errorf("unknown eviction policy %q", kind)
+	}
+}
@@ -0,0 +1,182 @@
+package eviction
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var policyTypes = []PolicyType{PolicyLRU, PolicyLFU, PolicyARC, PolicyTinyLFU, PolicyRing}
+
+// PolicyRing 需要将字节还原为测试使用的 String
+func decodeString(data []byte, _ time.Time) Value {
+	return String(data)
+}
+
+// TestPolicy_Basic 测试各淘汰策略的基础功能
+func TestPolicy_Basic(t *testing.T) {
+	for _, kind := range policyTypes {
+		t.Run(string(kind), func(t *testing.T) {
+			p, err := New(kind, 1024, nil, WithDecoder(decodeString))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Stop()
+
+			p.Add("key1", String("value1"))
+			if v, _, ok := p.Get("key1"); !ok || string(v.(String)) != "value1" {
+				t.Errorf("获取键'key1'失败，实际值为 %v，期望值为 'value1'", v)
+			}
+			p.Add("key1", String("value2"))
+			if v, _, ok := p.Get("key1"); !ok || string(v.(String)) != "value2" {
+				t.Errorf("更新后获取键'key1'失败，实际值为 %v，期望值为 'value2'", v)
+			}
+			if _, _, ok := p.Get("missing"); ok {
+				t.Error("获取不存在的键应返回false")
+			}
+			if !p.Remove("key1") || p.Len() != 0 {
+				t.Errorf("删除键'key1'失败，当前长度为 %d", p.Len())
+			}
+		})
+	}
+
+	if _, err := New("fifo", 1024, nil); err == nil {
+		t.Error("未知的淘汰策略应返回错误")
+	}
+	for _, kind := range append(policyTypes, "") {
+		if err := kind.Validate(); err != nil {
+			t.Errorf("Validate(%q) = %v", kind, err)
+		}
+	}
+	if err := PolicyType("fifo").Validate(); err == nil {
+		t.Error("未知的淘汰策略应校验失败")
+	}
+}
+
+// TestPolicy_Capacity 测试各淘汰策略在超出容量时淘汰缓存
+func TestPolicy_Capacity(t *testing.T) {
+	for _, kind := range policyTypes {
+		t.Run(string(kind), func(t *testing.T) {
+			evicted := 0
+			// 每个分片 64 字节，每个条目 10 字节
+			p, _ := New(kind, 64*defaultNumSegments, func(string, Value) { evicted++ }, WithDecoder(decodeString))
+			defer p.Stop()
+
+			for i := 0; i < 1000; i++ {
+				p.Add(fmt.Sprintf("k%04d", i), String("vvvvv"))
+			}
+			if max := 6 * defaultNumSegments; p.Len() > max {
+				t.Errorf("缓存条目数不应超过 %d，实际为 %d", max, p.Len())
+			}
+			if evicted+p.Len() != 1000 {
+				t.Errorf("淘汰数 %d 与剩余数 %d 之和应为 1000", evicted, p.Len())
+			}
+		})
+	}
+}
+
+// TestPolicy_ScanResistance 测试批量扫描后热点缓存的保留情况，LRU会被扫描冲掉
+func TestPolicy_ScanResistance(t *testing.T) {
+	for _, kind := range []PolicyType{PolicyLFU, PolicyARC, PolicyTinyLFU} {
+		t.Run(string(kind), func(t *testing.T) {
+			p, _ := New(kind, 1<<14, nil)
+			defer p.Stop()
+
+			hot := make([]string, 50)
+			for i := range hot {
+				hot[i] = fmt.Sprintf("hot%02d", i)
+			}
+			// 反复访问热点数据
+			for round := 0; round < 5; round++ {
+				for _, key := range hot {
+					if _, _, ok := p.Get(key); !ok {
+						p.Add(key, String("vvvvvvvvvv"))
+					}
+				}
+			}
+			// 一次性扫描大量冷数据
+			for i := 0; i < 5000; i++ {
+				key := fmt.Sprintf("scan%05d", i)
+				p.Get(key)
+				p.Add(key, String("vvvvvvvvvv"))
+			}
+
+			hits := 0
+			for _, key := range hot {
+				if _, _, ok := p.Get(key); ok {
+					hits++
+				}
+			}
+			if hits < len(hot)*8/10 {
+				t.Errorf("扫描后热点缓存应大部分保留，实际命中 %d/%d", hits, len(hot))
+			}
+		})
+	}
+}
+
+// TestPolicy_AdmitWhenWarm 测试缓存预热后新加入的缓存不会被立即淘汰，W-TinyLFU 的准入过滤会拒绝冷数据，不参与测试
+func TestPolicy_AdmitWhenWarm(t *testing.T) {
+	for _, kind := range []PolicyType{PolicyLRU, PolicyLFU, PolicyARC, PolicyRing} {
+		t.Run(string(kind), func(t *testing.T) {
+			p, _ := New(kind, 1<<14, nil, WithDecoder(decodeString))
+			defer p.Stop()
+
+			// 填满缓存，并使每个缓存都被访问过
+			for i := 0; i < 2000; i++ {
+				p.Add(fmt.Sprintf("old%04d", i), String("vvvvvvvvvv"))
+			}
+			for i := 0; i < 2000; i++ {
+				p.Get(fmt.Sprintf("old%04d", i))
+			}
+
+			admitted := 0
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("new%04d", i)
+				p.Add(key, String("vvvvvvvvvv"))
+				if _, _, ok := p.Get(key); ok {
+					admitted++
+				}
+			}
+			if admitted != 100 {
+				t.Errorf("预热后新缓存应全部加入，实际加入 %d/100", admitted)
+			}
+		})
+	}
+}
+
+// TestPolicy_Range 测试各淘汰策略遍历缓存
+func TestPolicy_Range(t *testing.T) {
+	for _, kind := range policyTypes {
+		t.Run(string(kind), func(t *testing.T) {
+			p, err := New(kind, 1<<20, nil, WithDecoder(decodeString))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Stop()
+
+			for i := 0; i < 100; i++ {
+				p.Add(fmt.Sprintf("key%d", i), String(fmt.Sprintf("value%d", i)))
+			}
+			seen := make(map[string]bool)
+			p.Range(func(key string, value Value) bool {
+				if string(value.(String)) != "value"+key[3:] {
+					t.Errorf("键'%s'的值不匹配: %v", key, value)
+				}
+				seen[key] = true
+				return true
+			})
+			if len(seen) != 100 {
+				t.Errorf("应遍历 100 个缓存，实际为 %d", len(seen))
+			}
+
+			count := 0
+			p.Range(func(string, Value) bool {
+				count++
+				return count < 10
+			})
+			if count != 10 {
+				t.Errorf("fn 返回false后应停止遍历，实际遍历 %d 个", count)
+			}
+		})
+	}
+}
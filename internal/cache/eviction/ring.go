@@ -0,0 +1,307 @@
+package eviction
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	// 记录头：hash(8) | expireAt(8) | updateAt(8) | valueLen(4) | keyLen(2) | flags(1) | 保留(1)
+	ringHeaderSize = 32
+	// 记录已被删除或覆盖，空间在队尾经过时回收
+	ringDeleted = 1 << 0
+	// 记录在上次经过队尾后被访问过，淘汰时给予第二次机会
+	ringAccessed = 1 << 1
+)
+
+// CacheUseRing 将key和value存放在每个分片预先分配的环形字节缓冲区中，索引为 map[uint64]uint32，
+// 两者都不含指针，GC无需扫描缓存内容，适合大量小value的场景。淘汰采用CLOCK（第二次机会）算法近似LRU：
+// 新记录追加到队头，空间不足时检查队尾的记录，被访问过的记录清除访问标记后移到队头，否则淘汰。
+//
+// value 需要实现 Encodable，读取时通过 Decoder 还原，每次 Get 都会复制value；未实现的value无法保存，
+// 与超出容量的value一样视为立即淘汰。maxBytes 包含每条记录32字节的记录头，必须为正数（缓冲区预先分配，
+// 不支持不限容量），单个分片最多 4GiB，key 最长 64KiB。
+type CacheUseRing struct {
+	*segmentedCache
+}
+
+// NewRingCache 创建环形缓冲区缓存，maxBytes<=0 时 New 返回错误，直接调用时不会保存任何缓存
+func NewRingCache(maxBytes int64, onEvicted func(string, Value), decode Decoder) *CacheUseRing {
+	if decode == nil {
+		decode = decodeBytes
+	}
+	return &CacheUseRing{
+		segmentedCache: newSegmentedCache(maxBytes, onEvicted, func(maxBytes int64, onEvicted func(string, Value)) shard {
+			return newRingShard(maxBytes, onEvicted, decode)
+		}),
+	}
+}
+
+// 环形缓冲区缓存分片
+type ringShard struct {
+	buf       []byte
+	head      uint64            // 下一条记录写入的逻辑位置，只增不减
+	tail      uint64            // 最早一条记录的逻辑位置
+	index     map[uint64]uint32 // key的哈希 -> 记录在buf中的位置
+	count     int               // 有效记录数
+	nowBytes  int64             // 有效记录的key和value字节数
+	scratch   []byte            // 编码value时复用的缓冲区
+	moving    []byte            // 移动记录时复用的缓冲区
+	decode    Decoder
+	onEvicted func(key string, value Value)
+}
+
+// 记录头
+type ringHeader struct {
+	hash     uint64
+	expireAt int64 // unix纳秒，0表示永不过期
+	updateAt int64 // unix纳秒
+	valueLen uint32
+	keyLen   uint16
+	flags    byte
+}
+
+func (h *ringHeader) size() uint64 {
+	return ringHeaderSize + uint64(h.keyLen) + uint64(h.valueLen)
+}
+
+func newRingShard(maxBytes int64, onEvicted func(string, Value), decode Decoder) *ringShard {
+	return &ringShard{
+		buf:       make([]byte, min(max(maxBytes, ringHeaderSize), math.MaxUint32)),
+		index:     make(map[uint64]uint32),
+		decode:    decode,
+		onEvicted: onEvicted,
+	}
+}
+
+func (s *ringShard) get(key string) (*Entry, bool) {
+	off, h, ok := s.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	h.flags |= ringAccessed
+	h.updateAt = time.Now().UnixNano()
+	s.writeHeader(off, h)
+	return s.entry(off, h, key), true
+}
+
+func (s *ringShard) add(key string, value Value) {
+	enc, encodable := value.(Encodable)
+	if encodable {
+		s.scratch = enc.AppendBytes(s.scratch[:0])
+	}
+	var expireAt int64
+	if v, ok := value.(Expirable); ok && !v.ExpireAt().IsZero() {
+		expireAt = v.ExpireAt().UnixNano()
+	}
+
+	hash := hashKey(key)
+	if off, ok := s.index[hash]; ok {
+		h := s.readHeader(off)
+		if s.keyEquals(off, h, key) {
+			s.delete(off, h)
+		} else {
+			// 哈希冲突，淘汰原有的key
+			s.evict(off, h)
+		}
+	}
+
+	h := ringHeader{
+		hash:     hash,
+		expireAt: expireAt,
+		updateAt: time.Now().UnixNano(),
+		valueLen: uint32(len(s.scratch)),
+		keyLen:   uint16(len(key)),
+	}
+	size := h.size()
+	if !encodable || len(key) > math.MaxUint16 || size > uint64(len(s.buf)) {
+		// 无法编码或超出分片容量，与其他策略超出容量时一样视为立即淘汰
+		if s.onEvicted != nil {
+			s.onEvicted(key, value)
+		}
+		return
+	}
+	for uint64(len(s.buf))-(s.head-s.tail) < size {
+		s.evictTail()
+	}
+
+	off := s.offset(s.head)
+	s.writeHeader(off, h)
+	keyOff := s.offset(uint64(off) + ringHeaderSize)
+	s.write(keyOff, []byte(key))
+	s.write(s.offset(uint64(keyOff)+uint64(len(key))), s.scratch)
+	s.index[hash] = off
+	s.head += size
+	s.count++
+	s.nowBytes += int64(len(key)) + int64(len(s.scratch))
+}
+
+func (s *ringShard) remove(key string) (*Entry, bool) {
+	off, h, ok := s.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	e := s.entry(off, h, key)
+	s.delete(off, h)
+	return e, true
+}
+
+// 按从队尾到队头的顺序遍历，即最久写入到最近写入；每条记录的value都会被复制还原
+func (s *ringShard) rangeEntries(fn func(e *Entry) bool) {
+	for pos := s.tail; pos < s.head; {
+		off := s.offset(pos)
+		h := s.readHeader(off)
+		pos += h.size()
+		if h.flags&ringDeleted != 0 {
+			continue
+		}
+		if !fn(s.entry(off, h, "")) {
+			return
+		}
+	}
+}
+
+func (s *ringShard) len() int {
+	return s.count
+}
+
+func (s *ringShard) bytes() int64 {
+	return s.nowBytes
+}
+
+// 回收队尾的一条记录：已删除的直接跳过，被访问过的移到队头，否则淘汰
+func (s *ringShard) evictTail() {
+	off := s.offset(s.tail)
+	h := s.readHeader(off)
+	size := h.size()
+	switch {
+	case h.flags&ringDeleted != 0:
+		s.tail += size
+	case h.flags&ringAccessed != 0 && (h.expireAt == 0 || time.Now().UnixNano() < h.expireAt):
+		// 先复制整条记录再前移队尾，队头的写入可能覆盖原位置
+		s.moving = s.read(off, int(size), s.moving[:0])
+		s.tail += size
+		h.flags &^= ringAccessed
+		newOff := s.offset(s.head)
+		s.write(newOff, s.moving)
+		s.writeHeader(newOff, h)
+		s.index[h.hash] = newOff
+		s.head += size
+	default:
+		s.evict(off, h)
+		s.tail += size
+	}
+}
+
+// 删除记录并触发淘汰回调
+func (s *ringShard) evict(off uint32, h ringHeader) {
+	var e *Entry
+	if s.onEvicted != nil {
+		e = s.entry(off, h, "")
+	}
+	s.delete(off, h)
+	if e != nil {
+		s.onEvicted(e.key, e.value)
+	}
+}
+
+// 标记记录已删除并移出索引，空间在队尾经过时回收
+func (s *ringShard) delete(off uint32, h ringHeader) {
+	h.flags |= ringDeleted
+	s.writeHeader(off, h)
+	if cur, ok := s.index[h.hash]; ok && cur == off {
+		delete(s.index, h.hash)
+	}
+	s.count--
+	s.nowBytes -= int64(h.keyLen) + int64(h.valueLen)
+}
+
+// 查找key对应的记录
+func (s *ringShard) lookup(key string) (uint32, ringHeader, bool) {
+	off, ok := s.index[hashKey(key)]
+	if !ok {
+		return 0, ringHeader{}, false
+	}
+	h := s.readHeader(off)
+	if !s.keyEquals(off, h, key) {
+		return 0, ringHeader{}, false
+	}
+	return off, h, true
+}
+
+func (s *ringShard) keyEquals(off uint32, h ringHeader, key string) bool {
+	if int(h.keyLen) != len(key) {
+		return false
+	}
+	start := uint64(off) + ringHeaderSize
+	for i := 0; i < len(key); i++ {
+		if s.buf[(start+uint64(i))%uint64(len(s.buf))] != key[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 将记录还原为缓存元数据，value 复制到新的内存中；key 为空时从记录中读取
+func (s *ringShard) entry(off uint32, h ringHeader, key string) *Entry {
+	keyOff := s.offset(uint64(off) + ringHeaderSize)
+	if key == "" {
+		key = string(s.read(keyOff, int(h.keyLen), make([]byte, 0, h.keyLen)))
+	}
+	value := s.read(s.offset(uint64(keyOff)+uint64(h.keyLen)), int(h.valueLen), make([]byte, 0, h.valueLen))
+	var expireAt time.Time
+	if h.expireAt != 0 {
+		expireAt = time.Unix(0, h.expireAt)
+	}
+	return &Entry{
+		key:      key,
+		value:    s.decode(value, expireAt),
+		updateAt: time.Unix(0, h.updateAt),
+	}
+}
+
+// 逻辑位置对应的buf下标
+func (s *ringShard) offset(pos uint64) uint32 {
+	return uint32(pos % uint64(len(s.buf)))
+}
+
+// 从 off 开始读取 n 个字节追加到 dst，越过buf末尾时从头继续
+func (s *ringShard) read(off uint32, n int, dst []byte) []byte {
+	end := int(off) + n
+	if end <= len(s.buf) {
+		return append(dst, s.buf[off:end]...)
+	}
+	dst = append(dst, s.buf[off:]...)
+	return append(dst, s.buf[:end-len(s.buf)]...)
+}
+
+// 从 off 开始写入 b，越过buf末尾时从头继续
+func (s *ringShard) write(off uint32, b []byte) {
+	n := copy(s.buf[off:], b)
+	copy(s.buf, b[n:])
+}
+
+func (s *ringShard) readHeader(off uint32) ringHeader {
+	var b [ringHeaderSize]byte
+	s.read(off, ringHeaderSize, b[:0])
+	return ringHeader{
+		hash:     binary.LittleEndian.Uint64(b[0:]),
+		expireAt: int64(binary.LittleEndian.Uint64(b[8:])),
+		updateAt: int64(binary.LittleEndian.Uint64(b[16:])),
+		valueLen: binary.LittleEndian.Uint32(b[24:]),
+		keyLen:   binary.LittleEndian.Uint16(b[28:]),
+		flags:    b[30],
+	}
+}
+
+func (s *ringShard) writeHeader(off uint32, h ringHeader) {
+	var b [ringHeaderSize]byte
+	binary.LittleEndian.PutUint64(b[0:], h.hash)
+	binary.LittleEndian.PutUint64(b[8:], uint64(h.expireAt))
+	binary.LittleEndian.PutUint64(b[16:], uint64(h.updateAt))
+	binary.LittleEndian.PutUint32(b[24:], h.valueLen)
+	binary.LittleEndian.PutUint16(b[28:], h.keyLen)
+	b[30] = h.flags
+	s.write(off, b[:])
+}
@@ -0,0 +1,167 @@
+package eviction
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// TestCacheUseRing_model 随机读写并与参照的map比对，覆盖缓冲区回绕、覆盖写入和淘汰
+func TestCacheUseRing_model(t *testing.T) {
+	model := make(map[string]string)
+	ring := NewRingCache(4096*defaultNumSegments, func(key string, _ Value) { delete(model, key) }, decodeString)
+	defer ring.Stop()
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		key := fmt.Sprintf("key%d", r.Intn(2000))
+		switch op := r.Intn(10); {
+		case op < 5:
+			value := fmt.Sprintf("%s-%d-%s", key, i, make([]byte, r.Intn(64)))
+			ring.Add(key, String(value))
+			model[key] = value
+		case op < 9:
+			v, _, ok := ring.Get(key)
+			want, exists := model[key]
+			if ok != exists || (ok && string(v.(String)) != want) {
+				t.Fatalf("第 %d 次操作 Get(%s) = %v, %v，期望 %q, %v", i, key, v, ok, want, exists)
+			}
+		default:
+			_, exists := model[key]
+			if ring.Remove(key) != exists {
+				t.Fatalf("第 %d 次操作 Remove(%s) 应返回 %v", i, key, exists)
+			}
+			delete(model, key)
+		}
+	}
+	if ring.Len() != len(model) {
+		t.Errorf("缓存长度为 %d，期望 %d", ring.Len(), len(model))
+	}
+	var bytes int64
+	for key, value := range model {
+		bytes += int64(len(key) + len(value))
+	}
+	if ring.Bytes() != bytes {
+		t.Errorf("缓存字节数为 %d，期望 %d", ring.Bytes(), bytes)
+	}
+}
+
+// TestCacheUseRing_secondChance 测试被访问过的缓存在队尾时获得第二次机会
+func TestCacheUseRing_secondChance(t *testing.T) {
+	var evicted []string
+	// 每条记录 32+1+1=34 字节，分片只能容纳4条
+	s := newRingShard(4*34, func(key string, _ Value) { evicted = append(evicted, key) }, decodeString)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		s.add(key, String("v"))
+	}
+	s.get("a")
+	s.add("e", String("v"))
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatalf("应淘汰未被访问的 b，实际淘汰 %v", evicted)
+	}
+	if _, ok := s.get("a"); !ok {
+		t.Error("被访问过的 a 应保留")
+	}
+	if s.len() != 4 {
+		t.Errorf("分片应有 4 条记录，实际为 %d", s.len())
+	}
+}
+
+// 未实现 Encodable 的value
+type plainValue int
+
+func (v plainValue) Len() int { return 8 }
+
+// TestCacheUseRing_unencodable 测试无法编码的value视为立即淘汰，并删除同名的旧值
+func TestCacheUseRing_unencodable(t *testing.T) {
+	var evicted []string
+	s := newRingShard(1024, func(key string, _ Value) { evicted = append(evicted, key) }, decodeString)
+	s.add("a", String("v"))
+	s.add("a", plainValue(1))
+	if len(evicted) != 1 || evicted[0] != "a" {
+		t.Fatalf("无法编码的value应立即淘汰，实际淘汰 %v", evicted)
+	}
+	if _, ok := s.get("a"); ok || s.len() != 0 {
+		t.Errorf("旧值应被删除，当前记录数 %d", s.len())
+	}
+
+	if _, err := New(PolicyRing, 0, nil); err == nil {
+		t.Error("容量为0的环形缓冲区应返回错误")
+	}
+}
+
+const benchEntries = 1 << 20
+
+func benchPolicies() map[string]func() Policy {
+	return map[string]func() Policy{
+		"lru":  func() Policy { return NewLRUCache(benchEntries*64, nil) },
+		"ring": func() Policy { return NewRingCache(benchEntries*64, nil, decodeString) },
+	}
+}
+
+func benchKeys() []string {
+	keys := make([]string, benchEntries)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%08d", i)
+	}
+	return keys
+}
+
+func BenchmarkPolicy_Add(b *testing.B) {
+	keys := benchKeys()
+	for name, newPolicy := range benchPolicies() {
+		b.Run(name, func(b *testing.B) {
+			p := newPolicy()
+			defer p.Stop()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p.Add(keys[i%len(keys)], String("value-0123456789"))
+			}
+		})
+	}
+}
+
+func BenchmarkPolicy_Get(b *testing.B) {
+	keys := benchKeys()
+	for name, newPolicy := range benchPolicies() {
+		b.Run(name, func(b *testing.B) {
+			p := newPolicy()
+			defer p.Stop()
+			for _, key := range keys {
+				p.Add(key, String("value-0123456789"))
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.Int()
+				for pb.Next() {
+					p.Get(keys[i%len(keys)])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkPolicy_GC 测量缓存中保存大量小value时一次完整GC的耗时
+func BenchmarkPolicy_GC(b *testing.B) {
+	keys := benchKeys()
+	for name, newPolicy := range benchPolicies() {
+		b.Run(name, func(b *testing.B) {
+			p := newPolicy()
+			defer p.Stop()
+			for _, key := range keys {
+				p.Add(key, String("value-0123456789"))
+			}
+			runtime.GC()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+			}
+			b.StopTimer()
+			runtime.KeepAlive(p)
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package eviction
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shard 单个缓存分片需要实现的淘汰策略，方法均在分片锁内调用，实现本身无需加锁
+type shard interface {
+	// 查找缓存并更新访问信息
+	get(key string) (*Entry, bool)
+	// 新增或更新缓存，超出容量时按策略淘汰并触发淘汰回调
+	add(key string, value Value)
+	// 主动删除缓存，不触发淘汰回调
+	remove(key string) (*Entry, bool)
+	// 遍历分片中的缓存，fn 返回false时停止
+	rangeEntries(fn func(e *Entry) bool)
+	// 当前缓存数据个数
+	len() int
+	// 当前缓存占用的字节数
+	bytes() int64
+}
+
+// 加锁保护的缓存分片
+type lockedShard struct {
+	mu sync.Mutex
+	shard
+}
+
+// segmentedCache 负责管理缓存分片和定时清理过期缓存，淘汰策略由各分片实现。
+// 与 CacheUseLRU 相同，通过分片减少全局锁竞争。
+type segmentedCache struct {
+	// 缓存分片集合
+	segments []*lockedShard
+	// 记录被移除时的回调函数
+	onEvicted func(key string, value Value)
+	// 累计淘汰的缓存数量
+	evictions atomic.Int64
+	// TTL
+	ttl time.Duration
+	// 管理器读写锁
+	mu              sync.RWMutex
+	stopCleanup     chan struct{}
+	cleanupInterval time.Duration
+}
+
+// 创建分片管理器，newShard 根据每个分片的maxBytes创建分片，分片淘汰缓存时需调用传入的 onEvicted
+func newSegmentedCache(maxBytes int64, onEvicted func(string, Value), newShard func(maxBytes int64, onEvicted func(string, Value)) shard) *segmentedCache {
+	cache := &segmentedCache{
+		segments:        make([]*lockedShard, defaultNumSegments),
+		onEvicted:       onEvicted,
+		cleanupInterval: defaultCleanupInterval,
+		ttl:             defaultTTL,
+		stopCleanup:     make(chan struct{}),
+	}
+	// 由整体maxBytes定义缓存分片的平均maxBytes
+	segmentMaxBytes := maxBytes / int64(defaultNumSegments)
+	for i := range cache.segments {
+		cache.segments[i] = &lockedShard{shard: newShard(segmentMaxBytes, cache.evicted)}
+	}
+	// 开启定时清理过期缓存的任务
+	go cache.cleanUpRoutine(cache.stopCleanup, cache.cleanupInterval)
+
+	return cache
+}
+
+// 通过FNV-1a哈希算法确定key所属的缓存分片
+func (cache *segmentedCache) getSegment(key string) *lockedShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return cache.segments[h.Sum32()%uint32(len(cache.segments))]
+}
+
+// Get 在对应缓存分片中查找value，值自身携带的过期时间已到时删除并视为未命中
+func (cache *segmentedCache) Get(key string) (value Value, updateAt time.Time, ok bool) {
+	seg := cache.getSegment(key)
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+
+	entry, ok := seg.get(key)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	if entry.valueExpired() {
+		seg.remove(key)
+		cache.evicted(entry.key, entry.value)
+		return nil, time.Time{}, false
+	}
+	entry.UpdatedTTLTime() // 更新TTL时间
+	return entry.value, entry.updateAt, true
+}
+
+// Add 新增或更新缓存分片中的value
+func (cache *segmentedCache) Add(key string, value Value) {
+	seg := cache.getSegment(key)
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+
+	seg.add(key, value)
+}
+
+// Remove 主动删除缓存分片中的value，返回key是否存在
+func (cache *segmentedCache) Remove(key string) bool {
+	seg := cache.getSegment(key)
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+
+	_, ok := seg.remove(key)
+	return ok
+}
+
+// Range 依次遍历各缓存分片的快照
+func (cache *segmentedCache) Range(fn func(key string, value Value) bool) {
+	for _, seg := range cache.segments {
+		seg.mu.Lock()
+		// 复制缓存元数据，避免在锁外读取被并发修改的值
+		entries := make([]Entry, 0, seg.len())
+		seg.rangeEntries(func(e *Entry) bool {
+			entries = append(entries, *e)
+			return true
+		})
+		seg.mu.Unlock()
+
+		if !rangeSnapshot(entries, fn) {
+			return
+		}
+	}
+}
+
+// Len 计算所有缓存分片的缓存数据个数
+func (cache *segmentedCache) Len() int {
+	total := 0
+	for _, seg := range cache.segments {
+		seg.mu.Lock()
+		total += seg.len()
+		seg.mu.Unlock()
+	}
+	return total
+}
+
+// Bytes 计算所有缓存分片占用的字节数
+func (cache *segmentedCache) Bytes() int64 {
+	var total int64
+	for _, seg := range cache.segments {
+		seg.mu.Lock()
+		total += seg.bytes()
+		seg.mu.Unlock()
+	}
+	return total
+}
+
+// Evictions 返回累计淘汰的缓存数量，包括过期清理
+func (cache *segmentedCache) Evictions() int64 {
+	return cache.evictions.Load()
+}
+
+// SetTTL 设置缓存管理器TTL时间
+func (cache *segmentedCache) SetTTL(ttl time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.ttl = ttl
+}
+
+// SetCleanupInterval 设置缓存管理器定时器时间
+func (cache *segmentedCache) SetCleanupInterval(interval time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	close(cache.stopCleanup)
+
+	// 根据新的时间创建新定时器任务
+	cache.stopCleanup = make(chan struct{})
+	cache.cleanupInterval = interval
+
+	go cache.cleanUpRoutine(cache.stopCleanup, cache.cleanupInterval)
+}
+
+// Stop 停止当前的清理goroutine
+func (cache *segmentedCache) Stop() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	close(cache.stopCleanup)
+}
+
+// 定时触发TTL缓存检查，stop 和 interval 由启动方在持有锁时传入，不再读取可能被替换的字段
+func (cache *segmentedCache) cleanUpRoutine(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cache.cleanUPSegments()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// 遍历缓存分片，删除TTL过期的缓存
+func (cache *segmentedCache) cleanUPSegments() {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	for _, seg := range cache.segments {
+		seg.mu.Lock()
+		var expired []*Entry
+		seg.rangeEntries(func(e *Entry) bool {
+			if e.Expired(cache.ttl) {
+				expired = append(expired, e)
+			}
+			return true
+		})
+		for _, e := range expired {
+			seg.remove(e.key)
+			cache.evicted(e.key, e.value)
+		}
+		seg.mu.Unlock()
+	}
+}
+
+// 记录淘汰数量并触发淘汰回调
+func (cache *segmentedCache) evicted(key string, value Value) {
+	cache.evictions.Add(1)
+	if cache.onEvicted != nil {
+		cache.onEvicted(key, value)
+	}
+}
+
+// 计算缓存数据占用的内存大小
+func entrySize(key string, value Value) int64 {
+	return int64(len(key)) + int64(value.Len())
+}
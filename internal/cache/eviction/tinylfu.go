@@ -0,0 +1,290 @@
+package eviction
+
+import (
+	"container/list"
+	"hash/fnv"
+)
+
+const (
+	// 窗口LRU占分片容量的比例（百分比）
+	tinyLFUWindowPercent = 1
+	// 保护区占主区域容量的比例（百分比）
+	tinyLFUProtectedPercent = 80
+	// 估算频率草图宽度时假定的平均缓存大小
+	tinyLFUAvgEntryBytes = 64
+)
+
+// CacheUseTinyLFU 实现 W-TinyLFU：新缓存先进入一个很小的窗口LRU，从窗口淘汰的缓存只有在访问频率
+// 高于主区域待淘汰者时才会被准入。主区域是分为试用区和保护区的分段LRU，访问频率由带衰减的Count-Min Sketch估算。
+// 对批量扫描有很强的抵抗力，同时能容纳突发的新热点。
+type CacheUseTinyLFU struct {
+	*segmentedCache
+}
+
+func NewTinyLFUCache(maxBytes int64, onEvicted func(string, Value)) *CacheUseTinyLFU {
+	return &CacheUseTinyLFU{
+		segmentedCache: newSegmentedCache(maxBytes, onEvicted, func(maxBytes int64, onEvicted func(string, Value)) shard {
+			return newTinyLFUShard(maxBytes, onEvicted)
+		}),
+	}
+}
+
+// W-TinyLFU中的三个区域
+const (
+	tinyLFUWindow    = iota // 窗口LRU
+	tinyLFUProbation        // 主区域的试用区
+	tinyLFUProtected        // 主区域的保护区
+)
+
+// W-TinyLFU缓存分片中的元素
+type tinyLFUItem struct {
+	entry *Entry
+	hash  uint64
+	size  int64
+	where int // 所在的区域
+}
+
+// W-TinyLFU缓存分片
+type tinyLFUShard struct {
+	maxBytes     int64
+	windowMax    int64
+	protectedMax int64
+	lists        [3]*list.List // 各区域，队头为最近访问
+	sizes        [3]int64      // 各区域占用的字节数
+	items        map[string]*list.Element
+	sketch       *countMinSketch
+	onEvicted    func(key string, value Value)
+}
+
+func newTinyLFUShard(maxBytes int64, onEvicted func(string, Value)) *tinyLFUShard {
+	windowMax := maxBytes * tinyLFUWindowPercent / 100
+	s := &tinyLFUShard{
+		maxBytes:     maxBytes,
+		windowMax:    windowMax,
+		protectedMax: (maxBytes - windowMax) * tinyLFUProtectedPercent / 100,
+		items:        make(map[string]*list.Element),
+		sketch:       newCountMinSketch(maxBytes / tinyLFUAvgEntryBytes),
+		onEvicted:    onEvicted,
+	}
+	for i := range s.lists {
+		s.lists[i] = list.New()
+	}
+	return s
+}
+
+func (s *tinyLFUShard) get(key string) (*Entry, bool) {
+	h := hashKey(key)
+	s.sketch.increment(h)
+	elm, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.hit(elm)
+	return elm.Value.(*tinyLFUItem).entry, true
+}
+
+func (s *tinyLFUShard) add(key string, value Value) {
+	size := entrySize(key, value)
+	if elm, ok := s.items[key]; ok {
+		// 修改
+		item := elm.Value.(*tinyLFUItem)
+		s.sizes[item.where] += size - item.size
+		item.size = size
+		item.entry.value = value
+		item.entry.UpdatedTTLTime()
+		s.hit(elm)
+	} else {
+		// 添加，新缓存进入窗口LRU
+		h := hashKey(key)
+		s.sketch.increment(h)
+		s.items[key] = s.push(&tinyLFUItem{entry: newEntry(key, value), hash: h, size: size}, tinyLFUWindow)
+	}
+	s.evict()
+}
+
+func (s *tinyLFUShard) remove(key string) (*Entry, bool) {
+	elm, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.unlink(elm)
+	delete(s.items, key)
+	return elm.Value.(*tinyLFUItem).entry, true
+}
+
+func (s *tinyLFUShard) rangeEntries(fn func(e *Entry) bool) {
+	for _, l := range s.lists {
+		for elm := l.Front(); elm != nil; elm = elm.Next() {
+			if !fn(elm.Value.(*tinyLFUItem).entry) {
+				return
+			}
+		}
+	}
+}
+
+func (s *tinyLFUShard) len() int {
+	return len(s.items)
+}
+
+func (s *tinyLFUShard) bytes() int64 {
+	return s.sizes[tinyLFUWindow] + s.sizes[tinyLFUProbation] + s.sizes[tinyLFUProtected]
+}
+
+// 命中后更新所在区域：窗口和保护区内移到队头，试用区的缓存晋升到保护区
+func (s *tinyLFUShard) hit(elm *list.Element) {
+	item := elm.Value.(*tinyLFUItem)
+	switch item.where {
+	case tinyLFUWindow, tinyLFUProtected:
+		s.lists[item.where].MoveToFront(elm)
+	case tinyLFUProbation:
+		s.move(elm, tinyLFUProtected)
+		// 保护区超出容量时，将最久未访问的缓存降级到试用区
+		for s.sizes[tinyLFUProtected] > s.protectedMax && s.lists[tinyLFUProtected].Len() > 1 {
+			s.move(s.lists[tinyLFUProtected].Back(), tinyLFUProbation)
+		}
+	}
+}
+
+// 窗口超出容量时，从窗口淘汰的候选者与主区域的待淘汰者比较访问频率，频率更高者留下
+func (s *tinyLFUShard) evict() {
+	if s.maxBytes == 0 {
+		return
+	}
+	mainMax := s.maxBytes - s.windowMax
+	for s.sizes[tinyLFUWindow] > s.windowMax && s.lists[tinyLFUWindow].Len() > 0 {
+		candidate := s.move(s.lists[tinyLFUWindow].Back(), tinyLFUProbation)
+		for s.sizes[tinyLFUProbation]+s.sizes[tinyLFUProtected] > mainMax {
+			victim := s.victim(candidate)
+			if victim == nil {
+				s.evictElement(candidate)
+				break
+			}
+			cf := s.sketch.estimate(candidate.Value.(*tinyLFUItem).hash)
+			vf := s.sketch.estimate(victim.Value.(*tinyLFUItem).hash)
+			if cf > vf {
+				s.evictElement(victim)
+			} else {
+				s.evictElement(candidate)
+				break
+			}
+		}
+	}
+	// 更新缓存导致主区域变大时，直接淘汰主区域中最久未访问的缓存
+	for s.sizes[tinyLFUProbation]+s.sizes[tinyLFUProtected] > mainMax {
+		victim := s.victim(nil)
+		if victim == nil {
+			break
+		}
+		s.evictElement(victim)
+	}
+}
+
+// 选出主区域的待淘汰者：优先试用区队尾，试用区为空时选择保护区队尾
+func (s *tinyLFUShard) victim(candidate *list.Element) *list.Element {
+	if elm := s.lists[tinyLFUProbation].Back(); elm != nil && elm != candidate {
+		return elm
+	}
+	return s.lists[tinyLFUProtected].Back()
+}
+
+func (s *tinyLFUShard) evictElement(elm *list.Element) {
+	item := elm.Value.(*tinyLFUItem)
+	s.unlink(elm)
+	delete(s.items, item.entry.key)
+	if s.onEvicted != nil {
+		s.onEvicted(item.entry.key, item.entry.value)
+	}
+}
+
+// 将元素移动到指定区域的队头，返回新的链表节点
+func (s *tinyLFUShard) move(elm *list.Element, where int) *list.Element {
+	item := elm.Value.(*tinyLFUItem)
+	s.unlink(elm)
+	elm = s.push(item, where)
+	s.items[item.entry.key] = elm
+	return elm
+}
+
+func (s *tinyLFUShard) push(item *tinyLFUItem, where int) *list.Element {
+	item.where = where
+	s.sizes[where] += item.size
+	return s.lists[where].PushFront(item)
+}
+
+func (s *tinyLFUShard) unlink(elm *list.Element) {
+	item := elm.Value.(*tinyLFUItem)
+	s.lists[item.where].Remove(elm)
+	s.sizes[item.where] -= item.size
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// 频率草图的行数
+const sketchDepth = 4
+
+// countMinSketch 以固定内存估算key的访问频率，计数达到上限时所有计数减半，使频率随时间衰减
+type countMinSketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int // 自上次衰减以来的计数次数
+	resetAt   int // 触发衰减的计数次数
+}
+
+func newCountMinSketch(width int64) *countMinSketch {
+	// 宽度取不小于width的2的幂，便于用位运算取模
+	w := uint64(16)
+	for w < uint64(width) {
+		w <<= 1
+	}
+	s := &countMinSketch{mask: w - 1, resetAt: int(w) * 10}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+// 每行使用不同的种子从同一个哈希值派生下标
+func (s *countMinSketch) index(h uint64, row int) uint64 {
+	h += uint64(row) * 0x9e3779b97f4a7c15
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return h & s.mask
+}
+
+func (s *countMinSketch) increment(h uint64) {
+	for i := range s.rows {
+		idx := s.index(h, i)
+		// 计数上限为15，与4位计数器的行为一致
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+// 取各行计数的最小值作为估算频率
+func (s *countMinSketch) estimate(h uint64) uint8 {
+	est := uint8(15)
+	for i := range s.rows {
+		est = min(est, s.rows[i][s.index(h, i)])
+	}
+	return est
+}
+
+// 所有计数减半，让过去的热点逐渐失效
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -9,18 +9,54 @@ type Entry struct {
 	updateAt time.Time // 上次访问或修改该值的时间
 }
 
+// 创建新的缓存元数据
+func newEntry(key string, value Value) *Entry {
+	return &Entry{
+		key:      key,
+		value:    value,
+		updateAt: time.Now(),
+	}
+}
+
 // Value 支持的方法
 type Value interface {
 	Len() int // 返回值所占用的内存大小
 }
 
+// Encodable 由能以字节形式保存的值实现，PolicyRing 只能保存这类值
+type Encodable interface {
+	Value
+	// AppendBytes 将值的内容追加到 dst 并返回
+	AppendBytes(dst []byte) []byte
+}
+
+// Decoder 将 Encodable 写入的字节还原为值，data 归调用方所有；expireAt 为写入时值的过期时间，零值表示永不过期
+type Decoder func(data []byte, expireAt time.Time) Value
+
+// Bytes 未设置 Decoder 时 PolicyRing 还原出的值
+type Bytes []byte
+
+func (b Bytes) Len() int { return len(b) }
+
+func (b Bytes) AppendBytes(dst []byte) []byte { return append(dst, b...) }
+
+func decodeBytes(data []byte, _ time.Time) Value { return Bytes(data) }
+
+// Expirable 由自身携带过期时间的值实现，返回零值表示永不过期
+type Expirable interface {
+	ExpireAt() time.Time
+}
+
 // UpdatedTTLTime 更新time to live时间
 func (e *Entry) UpdatedTTLTime() {
 	e.updateAt = time.Now()
 }
 
-// Expired 判断该缓存是否“未过期”
+// Expired 判断该缓存是否已过期：值自身的过期时间已到，或超过 duration 未被访问
 func (e *Entry) Expired(duration time.Duration) bool {
+	if e.valueExpired() {
+		return true
+	}
 	// 未设置过期时间则永不过期
 	if e.updateAt.IsZero() {
 		return false
@@ -29,3 +65,25 @@ func (e *Entry) Expired(duration time.Duration) bool {
 	// 表示这个条目已经过期 (即: 已经过去了TTL分钟)
 	return e.updateAt.Add(duration).Before(time.Now())
 }
+
+// 判断值自身携带的过期时间是否已到
+func (e *Entry) valueExpired() bool {
+	if v, ok := e.value.(Expirable); ok {
+		expireAt := v.ExpireAt()
+		return !expireAt.IsZero() && time.Now().After(expireAt)
+	}
+	return false
+}
+
+// 在锁外遍历缓存快照，跳过值已过期的缓存，fn 返回false时返回false
+func rangeSnapshot(entries []Entry, fn func(key string, value Value) bool) bool {
+	for _, e := range entries {
+		if e.valueExpired() {
+			continue
+		}
+		if !fn(e.key, e.value) {
+			return false
+		}
+	}
+	return true
+}
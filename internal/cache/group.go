@@ -1,8 +1,16 @@
 package cache
 
 import (
+	pb "FishCache/api/groupcachepb"
+	"FishCache/internal/cache/eviction"
+	"context"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 )
@@ -13,30 +21,150 @@ var (
 )
 
 type Group struct {
-	name   string         // 一个 Group 可以认为是一个缓存的命名空间，每个 Group 拥有一个唯一的名称 name
-	cache  *Cache         // 缓存值
-	getter Getter         //缓存未命中时获取源数据的回调(callback)
-	peers  HashPeerPicker // 包含一致性哈希的节点选择器
-	flight *SingleFlight  // 防止瞬时高并发的数据结构
+	name     string              // 一个 Group 可以认为是一个缓存的命名空间，每个 Group 拥有一个唯一的名称 name
+	cache    *Cache              // 缓存值，保存归属本节点的key
+	hot      *Cache              // 热点缓存，保存从远程节点获取的部分key，避免热点key每次都经过gRPC
+	hotConf  hotCacheConfig      // 热点缓存的容量比例和采样率
+	getter   Getter              //缓存未命中时获取源数据的回调(callback)
+	peers    HashPeerPicker      // 包含一致性哈希的节点选择器
+	flight   *SingleFlight       // 防止瞬时高并发的数据结构
+	failure  FailurePolicy       // 远程节点请求失败时的处理策略
+	policy   eviction.PolicyType // 缓存淘汰策略
+	snapshot snapshotConfig      // 快照文件配置
+	diskConf diskConfig          // 磁盘二级缓存配置
+	deleted  tombstones          // 最近删除的key，拒绝迁移来的旧值
+
+	Stats Stats // 访问统计
+}
+
+// FailurePolicy 定义远程节点不可达时的处理策略
+type FailurePolicy struct {
+	Retries       int           // 失败后的重试次数
+	Backoff       time.Duration // 首次重试前的等待时间，之后每次翻倍
+	MaxBackoff    time.Duration // 重试等待时间的上限，为0时不设上限
+	FallbackLocal bool          // 重试仍失败时，读请求是否回退到本地 Getter 加载
+}
+
+// DefaultFailurePolicy 默认重试2次，最终失败时回退到本地加载
+var DefaultFailurePolicy = FailurePolicy{
+	Retries:       2,
+	Backoff:       50 * time.Millisecond,
+	MaxBackoff:    time.Second,
+	FallbackLocal: true,
+}
+
+// 热点缓存的配置，默认关闭
+type hotCacheConfig struct {
+	percent int           // 占 maxBytes 的百分比，为0时关闭热点缓存
+	sample  int           // 每 sample 次远程获取中随机一次写入热点缓存
+	ttl     time.Duration // 热点缓存中的值的最长保存时间
+}
+
+// 热点缓存中的值默认最多保存的时间。归属节点的写入和删除不会通知其他节点的热点缓存，
+// 读取也会刷新空闲过期时间，只能靠该上限让旧值失效
+const defaultHotCacheTTL = 10 * time.Second
+
+// 批量获取时同时加载的key数上限
+const getManyLoadConcurrency = 32
+
+// 在本地加载但不归属本节点的key在本地缓存的最长时间
+const nonOwnerTTL = 5 * time.Second
+
+// GroupOption 用于定制 Group 的可选配置
+type GroupOption func(*Group)
+
+// WithFailurePolicy 设置远程节点请求失败时的处理策略
+func WithFailurePolicy(policy FailurePolicy) GroupOption {
+	return func(g *Group) {
+		g.failure = policy
+	}
+}
+
+// WithEvictionPolicy 设置缓存淘汰策略，默认为LRU
+func WithEvictionPolicy(policy eviction.PolicyType) GroupOption {
+	return func(g *Group) {
+		g.policy = policy
+	}
+}
+
+// 磁盘二级缓存的配置
+type diskConfig struct {
+	dir      string // 日志文件所在目录，为空时不启用
+	maxBytes int64  // 有效数据的字节数上限
 }
 
-func NewGroup(name string, maxBytes int64, getter Getter) *Group {
+// WithDiskTier 启用磁盘二级缓存：从内存中淘汰的缓存写入 dir 下以 Group 名称命名的日志文件，
+// 内存未命中时先查找磁盘，再请求远程节点或 Getter；重启后从日志中恢复
+func WithDiskTier(dir string, maxBytes int64) GroupOption {
+	return func(g *Group) {
+		g.diskConf = diskConfig{dir: dir, maxBytes: maxBytes}
+	}
+}
+
+// WithHotCache 开启热点缓存：占 maxBytes 的 percent%，每 sample 次远程获取中随机写入一次，
+// 值最多保存 ttl，ttl<=0 时使用默认的10秒。热点缓存的值在 ttl 内可能落后于归属节点；
+// percent 限制在 0~99 之间，主缓存至少保留1%，percent<=0 时关闭热点缓存
+func WithHotCache(percent int, sample int, ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		if ttl <= 0 {
+			ttl = defaultHotCacheTTL
+		}
+		g.hotConf = hotCacheConfig{percent: min(max(percent, 0), 99), sample: max(sample, 1), ttl: ttl}
+	}
+}
+
+func NewGroup(name string, maxBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("getter is nil")
 	}
 	mu.Lock()
 	defer mu.Unlock()
 
-	cache, err := NewCache(maxBytes)
+	group := &Group{
+		name:    name,
+		getter:  getter,
+		flight:  NewFlightGroup(5 * time.Second),
+		failure: DefaultFailurePolicy,
+		policy:  eviction.PolicyLRU,
+	}
+	for _, opt := range opts {
+		opt(group)
+	}
+
+	// 热点缓存的容量从 maxBytes 中划出
+	hotBytes := maxBytes * int64(group.hotConf.percent) / 100
+	cache, err := NewCache(maxBytes-hotBytes, group.policy)
 	if err != nil {
 		panic(err)
 	}
-
-	group := &Group{
-		name:   name,
-		getter: getter,
-		cache:  cache,
-		flight: NewFlightGroup(5 * time.Second),
+	group.cache = cache
+	cache.onEvict = func(key string) {
+		group.notify(key, pb.InvalidationKind_INVALIDATION_EVICT)
+	}
+	if group.diskConf.dir != "" {
+		path := filepath.Join(group.diskConf.dir, name+".log")
+		if cache.disk, err = openDiskTier(path, group.diskConf.maxBytes); err != nil {
+			log.Errorf("disk tier of group %s disabled: %v", name, err)
+		}
+	}
+	if hotBytes > 0 {
+		if group.hot, err = NewCache(hotBytes, group.policy); err != nil {
+			panic(err)
+		}
+	}
+	if group.snapshot.path != "" {
+		if err = group.loadSnapshot(); err != nil {
+			log.Warnf("%v", err)
+		}
+		if group.snapshot.interval > 0 {
+			var ctx context.Context
+			ctx, group.snapshot.stop = context.WithCancel(context.Background())
+			go group.snapshotLoop(ctx)
+		}
+	}
+	// 替换同名的 Group 时停止旧 Group 的定时保存
+	if old, ok := GroupManager[name]; ok {
+		old.stopSnapshotLoop()
 	}
 	GroupManager[name] = group
 
@@ -51,6 +179,18 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// 返回按名称排序的所有 Group
+func allGroups() []*Group {
+	mu.RLock()
+	groups := make([]*Group, 0, len(GroupManager))
+	for _, g := range GroupManager {
+		groups = append(groups, g)
+	}
+	mu.RUnlock()
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups
+}
+
 // RegisterPeers 注入哈希环到Group中
 func (g *Group) RegisterPeers(peers HashPeerPicker) {
 	//if g.peers != nil {
@@ -61,34 +201,337 @@ func (g *Group) RegisterPeers(peers HashPeerPicker) {
 
 // Get 从组中获取缓存数据
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 从组中获取缓存数据，ctx 取消或超时后不再等待远程节点和源数据的加载
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is empty")
+		return ByteView{}, ErrEmptyKey
 	}
+	g.Stats.Gets.Add(1)
 	// 从缓存中查找值
-	if v, ok := g.cache.get(key); ok {
+	if v, ok := g.lookupCache(key); ok {
 		return v, nil
 	}
 	// 不存在则该数据还没缓存到该内存服务器，调用load
-	return g.load(key)
+	return g.load(ctx, key)
 }
 
-func (g *Group) load(key string) (ByteView, error) {
+// GetResult 批量获取时单个key的结果
+type GetResult struct {
+	Value ByteView
+	Err   error
+}
+
+// GetMany 批量获取缓存数据，返回每个key各自的值或错误。
+// 未命中本地缓存的key按归属节点分组，每个远程节点只发起一次批量请求并行获取，归属本节点的key通过 Getter 加载。
+func (g *Group) GetMany(keys []string) map[string]GetResult {
+	return g.GetManyContext(context.Background(), keys)
+}
+
+// GetManyContext 与 GetMany 相同，ctx 会传递给远程节点请求和源数据加载
+func (g *Group) GetManyContext(ctx context.Context, keys []string) map[string]GetResult {
+	results := make(map[string]GetResult, len(keys))
+	var local []string                      // 归属本节点且未命中缓存的key
+	remote := make(map[PeerGetter][]string) // 按归属节点分组的key
+	for _, key := range keys {
+		if _, ok := results[key]; ok {
+			continue
+		}
+		if key == "" {
+			results[key] = GetResult{Err: ErrEmptyKey}
+			continue
+		}
+		g.Stats.Gets.Add(1)
+		if v, ok := g.lookupCache(key); ok {
+			results[key] = GetResult{Value: v}
+			continue
+		}
+		// 占位去重，结果在下方并行获取后回填
+		results[key] = GetResult{}
+		if g.peers != nil && !isForwarded(ctx) {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				remote[peer] = append(remote[peer], key)
+				continue
+			}
+		}
+		local = append(local, key)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	// 本地加载和远程失败后的回退加载共用 sem，限制一次批量请求同时加载的key数
+	sem := make(chan struct{}, getManyLoadConcurrency)
+	loadKeys := func(keys []string, store func(key string, res GetResult)) {
+		var lwg sync.WaitGroup
+		for _, key := range keys {
+			sem <- struct{}{}
+			lwg.Add(1)
+			go func(key string) {
+				defer func() {
+					<-sem
+					lwg.Done()
+				}()
+				value, err := g.load(ctx, key)
+				store(key, GetResult{Value: value, Err: err})
+			}(key)
+		}
+		lwg.Wait()
+	}
+	for peer, peerKeys := range remote {
+		wg.Add(1)
+		go func(peer PeerGetter, peerKeys []string) {
+			defer wg.Done()
+			var values map[string]GetResult
+			err := g.callPeer(ctx, peer, "", func() (err error) {
+				values, err = peer.GetMulti(ctx, g.name, peerKeys)
+				return err
+			})
+			var peerErr *PeerError
+			if errors.As(err, &peerErr) && g.failure.FallbackLocal {
+				// 节点已被标记为不健康，逐个key重新加载时会回退到本地
+				log.Warnf("%v, fallback to local getter", err)
+				values, err = make(map[string]GetResult, len(peerKeys)), nil
+				var vmu sync.Mutex
+				loadKeys(peerKeys, func(key string, res GetResult) {
+					vmu.Lock()
+					values[key] = res
+					vmu.Unlock()
+				})
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, key := range peerKeys {
+				if err != nil {
+					results[key] = GetResult{Err: err}
+				} else if res, ok := values[key]; ok {
+					if res.Err == nil {
+						g.Stats.PeerLoads.Add(1)
+						g.populateHotCache(key, res.Value)
+					}
+					results[key] = res
+				} else {
+					results[key] = GetResult{Err: fmt.Errorf("peer returned no result for %s", key)}
+				}
+			}
+		}(peer, peerKeys)
+	}
+	loadKeys(local, func(key string, res GetResult) {
+		mu.Lock()
+		results[key] = res
+		mu.Unlock()
+	})
+	wg.Wait()
+	return results
+}
+
+// Set 写入永不过期的缓存数据，key归属远程节点时转发给归属节点
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL 写入缓存数据并指定过期时长，ttl<=0 表示永不过期
+func (g *Group) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	return g.set(context.Background(), key, newByteView(value, ttl))
+}
+
+func (g *Group) set(ctx context.Context, key string, value ByteView) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	// 其他副本同步的加载结果不覆盖本地的值，也不写入最近删除的key
+	if isFill(ctx) {
+		g.acceptHandoff(key, value)
+		return nil
+	}
+	// 丢弃singleflight中缓存的旧结果
+	defer g.flight.Forget(key)
+
+	// 其他节点转发的写入直接写入本地
+	if g.peers != nil && !isForwarded(ctx) {
+		// 开启多副本时写入所有副本
+		if replicas := g.peers.PickOwners(key); len(replicas) > 1 {
+			return g.writeReplicas(ctx, key, replicas, func() {
+				g.addLocally(key, value)
+			}, func(peer PeerGetter) error {
+				return peer.Set(ctx, g.name, key, value)
+			})
+		}
+		// 由一致性哈希环判断当前key所在的节点
+		if peer, ok := g.peers.PickOwner(key); ok {
+			// 本地可能残留哈希环变化前的旧值或热点缓存，一并清除
+			g.removeLocally(key)
+			return g.callPeer(ctx, peer, key, func() error {
+				return peer.Set(ctx, g.name, key, value)
+			})
+		}
+	}
+
+	g.addLocally(key, value)
+	return nil
+}
+
+// Remove 删除缓存数据，key归属远程节点时转发给归属节点
+func (g *Group) Remove(key string) error {
+	return g.remove(context.Background(), key)
+}
+
+func (g *Group) remove(ctx context.Context, key string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	defer g.flight.Forget(key)
+
+	if g.peers != nil && !isForwarded(ctx) {
+		if replicas := g.peers.PickOwners(key); len(replicas) > 1 {
+			return g.writeReplicas(ctx, key, replicas, func() {
+				g.deleteLocally(key)
+			}, func(peer PeerGetter) error {
+				return peer.Delete(ctx, g.name, key)
+			})
+		}
+		if peer, ok := g.peers.PickOwner(key); ok {
+			g.removeLocally(key)
+			return g.callPeer(ctx, peer, key, func() error {
+				return peer.Delete(ctx, g.name, key)
+			})
+		}
+	}
+
+	g.deleteLocally(key)
+	return nil
+}
+
+// Invalidate 仅使本节点中的缓存数据和热点缓存失效，不转发给归属节点
+func (g *Group) Invalidate(key string) {
+	g.removeLocally(key)
+	g.flight.Forget(key)
+}
+
+// 依次从本地缓存和热点缓存中查找
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	if v, ok := g.cache.get(key); ok {
+		g.Stats.Hits.Add(1)
+		return v, true
+	}
+	if v, ok := g.hot.get(key); ok {
+		g.Stats.HotHits.Add(1)
+		return v, true
+	}
+	g.Stats.Misses.Add(1)
+	return ByteView{}, false
+}
+
+// 保存其他节点迁移过来的缓存，本地已有该key时保留本地的值（可能是迁移开始后的新写入），返回是否保存。
+// 本地的值是重启后从快照或磁盘恢复的旧值时，由迁移来的值覆盖：停机期间的写入只保存在临时的归属节点上
+// 本节点最近删除过的key不再接受，避免删除请求先于迁移到达时旧值重新出现
+func (g *Group) acceptHandoff(key string, value ByteView) bool {
+	if key == "" || value.IsExpired() {
+		return false
+	}
+	if local, ok := g.cache.get(key); ok && !local.restored {
+		return false
+	}
+	// 哈希环变化后已在本节点删除的key，迁移来的是删除前的旧值
+	if g.deleted.contains(key) {
+		return false
+	}
+	g.cache.add(key, value)
+	return true
+}
+
+// 写入本地缓存，并通知订阅方使近端缓存失效
+func (g *Group) addLocally(key string, value ByteView) {
+	g.cache.add(key, value)
+	g.notify(key, pb.InvalidationKind_INVALIDATION_SET)
+}
+
+// 作为归属节点删除key，并记录删除，避免之后迁移来的旧值使其重新出现
+func (g *Group) deleteLocally(key string) {
+	g.deleted.add(key)
+	g.removeLocally(key)
+}
+
+// 删除本地缓存和热点缓存中的数据，并通知订阅方使近端缓存失效
+func (g *Group) removeLocally(key string) {
+	g.cache.remove(key)
+	g.hot.remove(key)
+	g.notify(key, pb.InvalidationKind_INVALIDATION_DELETE)
+}
+
+// Flush 删除本节点上该 Group 的所有缓存，包括热点缓存和磁盘二级缓存，返回删除的key数量。
+// 不转发给其他节点，正在进行的加载完成后仍可能写入缓存
+func (g *Group) Flush() int {
+	keys := make(map[string]struct{})
+	collect := func(key string, _ ByteView) bool {
+		keys[key] = struct{}{}
+		return true
+	}
+	g.cache.rangeEntries(collect)
+	g.hot.rangeEntries(collect)
+	for _, key := range g.cache.disk.keys() {
+		keys[key] = struct{}{}
+	}
+	for key := range keys {
+		g.removeLocally(key)
+		g.flight.Forget(key)
+	}
+	return len(keys)
+}
+
+// 按采样率将从远程节点获取的数据写入热点缓存
+func (g *Group) populateHotCache(key string, value ByteView) {
+	if g.hot == nil || rand.Intn(g.hotConf.sample) != 0 {
+		return
+	}
+	g.hot.add(key, value.withMaxTTL(g.hotConf.ttl))
+}
+
+func (g *Group) load(ctx context.Context, key string) (ByteView, error) {
+	view, err := g.loadOnce(ctx, key)
+	// singleflight 在短时间内复用了已过期的结果，丢弃后重新加载一次
+	if err == nil && view.IsExpired() {
+		g.flight.Forget(key)
+		return g.loadOnce(ctx, key)
+	}
+	return view, err
+}
+
+func (g *Group) loadOnce(ctx context.Context, key string) (ByteView, error) {
 	// flight Do封装获取方法，避免高峰请求，实现类单例功能
-	viewi, err := g.flight.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
+	viewi, err := g.flight.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		g.Stats.Loads.Add(1)
+		// 其他节点转发的请求直接在本地加载，不再转发
+		if g.peers != nil && !isForwarded(ctx) {
+			// 开启多副本时按优先顺序依次尝试各副本
+			if replicas := g.peers.PickReplicas(key); len(replicas) > 1 {
+				return g.loadFromReplicas(ctx, key, replicas)
+			}
 			// 由一致性哈希环判断当前key所在的节点
 			if peer, ok := g.peers.PickPeer(key); ok {
 				// 从远程节点获取
-				if value, err := g.getFromPeer(peer, key); err == nil {
+				var value ByteView
+				err := g.callPeer(ctx, peer, key, func() (err error) {
+					value, err = g.getFromPeer(ctx, peer, key)
+					return err
+				})
+				if err == nil {
 					log.Printf("Load remote key: %s\n", key)
-					return value, err
-				} else {
-					log.Fatalln(err)
+					g.Stats.PeerLoads.Add(1)
+					g.populateHotCache(key, value)
+					return value, nil
+				}
+				// 远程节点的业务错误直接返回，节点故障时按失败策略决定是否回退到本地加载
+				var peerErr *PeerError
+				if !errors.As(err, &peerErr) || !g.failure.FallbackLocal {
+					return nil, err
 				}
+				log.Warnf("%v, fallback to local getter", err)
 			}
 		}
 
-		return g.getLocally(key)
+		return g.getLocally(ctx, key)
 	})
 
 	if err != nil {
@@ -97,24 +540,82 @@ func (g *Group) load(key string) (ByteView, error) {
 	return viewi.(ByteView), nil
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
-	// 调用自定义的get方法
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	// 调用自定义的get方法，实现了 GetterWithContext 时传入 ctx，实现了 GetterWithTTL 时同时获取过期时长
+	var item Item
+	var err error
+	switch getter := g.getter.(type) {
+	case GetterWithContext:
+		item, err = getter.GetContext(ctx, key)
+	case GetterWithTTL:
+		item, err = getter.GetWithTTL(key)
+	default:
+		item.Value, err = g.getter.Get(key)
+	}
 	if err != nil {
 		return ByteView{}, err
 	}
 
-	value := ByteView{b: cloneBytes(bytes)}
-	// 将源数据添加到缓存中
-	g.cache.add(key, value)
+	g.Stats.LocalLoads.Add(1)
+	value := newByteView(item.Value, item.TTL)
+	// 将源数据添加到缓存中。有界负载顺延或归属节点故障时，不归属本节点的key也会在本地加载，
+	// 而写入和删除只发送给归属节点，这类key只短暂缓存，避免长期返回旧值
+	if g.ownsKey(key) {
+		g.cache.add(key, value)
+	} else {
+		g.cache.add(key, value.withMaxTTL(nonOwnerTTL))
+	}
 	return value, nil
 }
 
-// 从远程grpc节点获取缓存
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	bytes, err := peer.Get(g.name, key)
-	if err != nil {
-		return ByteView{}, err
+// 本节点是否负责保存key：未注册节点选择器、本节点是归属节点或副本之一时返回true
+func (g *Group) ownsKey(key string) bool {
+	if g.peers == nil {
+		return true
+	}
+	if replicas := g.peers.PickOwners(key); len(replicas) > 1 {
+		return slices.Contains(replicas, nil)
+	}
+	_, remote := g.peers.PickOwner(key)
+	return !remote
+}
+
+// 按失败策略调用远程节点：节点不可达时按指数退避重试，重试耗尽后标记节点不健康并返回 *PeerError。
+// ctx 取消或超时时立即返回 ctx 的错误，不重试也不标记节点。
+func (g *Group) callPeer(ctx context.Context, peer PeerGetter, key string, fn func() error) error {
+	backoff := g.failure.Backoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		g.Stats.PeerErrors.Add(1)
+		if !errors.Is(err, ErrPeerUnavailable) {
+			return err
+		}
+		if attempt >= g.failure.Retries {
+			break
+		}
+		log.Warnf("call peer %s failed (attempt %d): %v", peer.Addr(), attempt+1, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+		if g.failure.MaxBackoff > 0 {
+			backoff = min(backoff, g.failure.MaxBackoff)
+		}
 	}
-	return ByteView{b: bytes}, nil
+
+	g.peers.MarkUnhealthy(peer)
+	return &PeerError{Peer: peer.Addr(), Group: g.name, Key: key, Err: err}
+}
+
+// 从远程grpc节点获取缓存
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	return peer.Get(ctx, g.name, key)
 }
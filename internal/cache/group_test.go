@@ -1,9 +1,15 @@
 package cache
 
 import (
+	"FishCache/internal/cache/eviction"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // 假定一个数据库
@@ -43,3 +49,484 @@ func TestGroup_basic(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func TestGroup_setRemove(t *testing.T) {
+	mygrp := NewGroup("setRemoveGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+
+	// 写入后应直接从缓存命中
+	if err := mygrp.Set("Tom", []byte("700")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := mygrp.Get("Tom"); err != nil || v.String() != "700" {
+		t.Fatalf("写入后获取'Tom'失败，实际值为 %v，错误 %v", v, err)
+	}
+	// 删除后缓存未命中，回源失败
+	if err := mygrp.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mygrp.Get("Tom"); err == nil {
+		t.Fatal("删除后获取'Tom'应返回错误")
+	}
+}
+
+func TestGroup_keyTTL(t *testing.T) {
+	// PolicyRing 将值编码后保存，过期时间需要随记录一起还原
+	for _, policy := range []eviction.PolicyType{eviction.PolicyLRU, eviction.PolicyRing} {
+		t.Run(string(policy), func(t *testing.T) {
+			loads := 0
+			mygrp := NewGroup("ttlGroup-"+string(policy), 2<<10, GetterWithTTLFunc(func(key string) (Item, error) {
+				loads++
+				return Item{Value: []byte(db[key]), TTL: 50 * time.Millisecond}, nil
+			}), WithEvictionPolicy(policy))
+
+			if v, err := mygrp.Get("Tom"); err != nil || v.ExpireAt().IsZero() {
+				t.Fatalf("获取'Tom'应带有过期时间，实际值为 %v，错误 %v", v, err)
+			}
+			// 未过期时直接命中缓存
+			if v, err := mygrp.Get("Tom"); err != nil || loads != 1 || v.String() != db["Tom"] {
+				t.Fatalf("未过期时不应回源，回源次数 %d，值 %v，错误 %v", loads, v, err)
+			}
+			// 过期后重新回源
+			time.Sleep(60 * time.Millisecond)
+			if _, err := mygrp.Get("Tom"); err != nil || loads != 2 {
+				t.Fatalf("过期后应重新回源，回源次数 %d，错误 %v", loads, err)
+			}
+		})
+	}
+}
+
+// fakePeer 模拟一个远程节点，记录收到的请求
+type fakePeer struct {
+	mu    sync.Mutex
+	data  map[string]string
+	calls int
+}
+
+func (p *fakePeer) Addr() string { return "fake-peer" }
+
+func (p *fakePeer) Get(_ context.Context, _ string, key string) (ByteView, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if v, ok := p.data[key]; ok {
+		return ByteView{b: []byte(v)}, nil
+	}
+	return ByteView{}, fmt.Errorf("%s not exist", key)
+}
+
+func (p *fakePeer) GetMulti(_ context.Context, group string, keys []string) (map[string]GetResult, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+	results := make(map[string]GetResult, len(keys))
+	for _, key := range keys {
+		v, ok := p.data[key]
+		if !ok {
+			results[key] = GetResult{Err: fmt.Errorf("%s not exist", key)}
+			continue
+		}
+		results[key] = GetResult{Value: ByteView{b: []byte(v)}}
+	}
+	return results, nil
+}
+
+func (p *fakePeer) Set(_ context.Context, _ string, key string, value ByteView) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.data == nil {
+		p.data = make(map[string]string)
+	}
+	p.data[key] = value.String()
+	return nil
+}
+
+func (p *fakePeer) Delete(context.Context, string, string) error { return nil }
+
+// deadPeer 模拟一个不可达的远程节点
+type deadPeer struct {
+	calls int
+}
+
+func (p *deadPeer) Addr() string { return "dead-peer" }
+
+func (p *deadPeer) Get(context.Context, string, string) (ByteView, error) {
+	p.calls++
+	return ByteView{}, fmt.Errorf("%w: connection refused", ErrPeerUnavailable)
+}
+
+func (p *deadPeer) GetMulti(context.Context, string, []string) (map[string]GetResult, error) {
+	p.calls++
+	return nil, fmt.Errorf("%w: connection refused", ErrPeerUnavailable)
+}
+
+func (p *deadPeer) Set(context.Context, string, string, ByteView) error {
+	p.calls++
+	return fmt.Errorf("%w: connection refused", ErrPeerUnavailable)
+}
+
+func (p *deadPeer) Delete(context.Context, string, string) error {
+	p.calls++
+	return fmt.Errorf("%w: connection refused", ErrPeerUnavailable)
+}
+
+// fakePicker 将 owned 中的key路由到指定的远程节点，其余key归属本节点；replicas 中的key按给定的副本列表路由；
+// 被标记不健康的节点不再被选择
+type fakePicker struct {
+	mu        sync.Mutex
+	owned     map[string]PeerGetter
+	replicas  map[string][]PeerGetter
+	unhealthy map[PeerGetter]bool
+}
+
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peer, ok := p.owned[key]
+	if ok && p.unhealthy[peer] {
+		return nil, false
+	}
+	return peer, ok
+}
+
+func (p *fakePicker) PickOwner(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peer, ok := p.owned[key]
+	return peer, ok
+}
+
+func (p *fakePicker) PickOwners(key string) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.replicas[key]
+}
+
+func (p *fakePicker) PickReplicas(key string) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var peers []PeerGetter
+	for _, peer := range p.replicas[key] {
+		if peer == nil || !p.unhealthy[peer] {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+func (p *fakePicker) MarkUnhealthy(peer PeerGetter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unhealthy == nil {
+		p.unhealthy = make(map[PeerGetter]bool)
+	}
+	p.unhealthy[peer] = true
+}
+
+func TestGroup_getMany(t *testing.T) {
+	mygrp := NewGroup("getManyGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if value, exists := db[key]; exists {
+			return []byte(value), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+	peer := &fakePeer{data: map[string]string{"Alice": "601", "Bob": "602"}}
+	mygrp.RegisterPeers(&fakePicker{owned: map[string]PeerGetter{"Alice": peer, "Bob": peer, "Eve": peer}})
+
+	results := mygrp.GetMany([]string{"Tom", "Alice", "Bob", "Eve", "Tam", "Tom"})
+	if len(results) != 5 {
+		t.Fatalf("应返回 5 个key的结果，实际为 %d", len(results))
+	}
+	for key, want := range map[string]string{"Tom": "630", "Alice": "601", "Bob": "602"} {
+		if res := results[key]; res.Err != nil || res.Value.String() != want {
+			t.Errorf("获取'%s'失败，实际值为 %v，错误 %v", key, res.Value, res.Err)
+		}
+	}
+	for _, key := range []string{"Eve", "Tam"} {
+		if results[key].Err == nil {
+			t.Errorf("获取不存在的'%s'应返回错误", key)
+		}
+	}
+	// 同一个远程节点上的key只发起一次批量请求
+	if peer.calls != 1 {
+		t.Errorf("远程节点应只收到 1 次请求，实际为 %d", peer.calls)
+	}
+}
+
+// 测试用的快速失败策略
+var testFailurePolicy = FailurePolicy{
+	Retries:       2,
+	Backoff:       time.Millisecond,
+	MaxBackoff:    5 * time.Millisecond,
+	FallbackLocal: true,
+}
+
+func TestGroup_deadPeerFallback(t *testing.T) {
+	mygrp := NewGroup("deadPeerFallbackGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}), WithFailurePolicy(testFailurePolicy))
+	peer := &deadPeer{}
+	picker := &fakePicker{owned: map[string]PeerGetter{"Tom": peer, "Jack": peer}}
+	mygrp.RegisterPeers(picker)
+
+	// 重试耗尽后回退到本地加载
+	if v, err := mygrp.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("节点故障时应回退到本地加载，实际值为 %v，错误 %v", v, err)
+	}
+	if peer.calls != testFailurePolicy.Retries+1 {
+		t.Errorf("应请求远程节点 %d 次，实际为 %d", testFailurePolicy.Retries+1, peer.calls)
+	}
+	if !picker.unhealthy[peer] {
+		t.Error("重试耗尽后应标记节点不健康")
+	}
+	// 节点不健康期间不再请求该节点
+	if v, err := mygrp.Get("Jack"); err != nil || v.String() != "589" {
+		t.Fatalf("获取'Jack'失败，实际值为 %v，错误 %v", v, err)
+	}
+	if peer.calls != testFailurePolicy.Retries+1 {
+		t.Errorf("节点不健康期间不应再被请求，实际请求 %d 次", peer.calls)
+	}
+	// 写入仍发送给不健康的归属节点，失败时返回错误而不是只写入本地
+	var peerErr *PeerError
+	if err := mygrp.Set("Jack", []byte("600")); !errors.As(err, &peerErr) {
+		t.Fatalf("归属节点不健康时写入应返回 *PeerError，实际为 %v", err)
+	}
+	if _, ok := mygrp.cache.get("Jack"); ok {
+		t.Error("写入归属节点失败时不应保存在本地")
+	}
+}
+
+func TestGroup_deadPeerNoFallback(t *testing.T) {
+	policy := testFailurePolicy
+	policy.FallbackLocal = false
+	mygrp := NewGroup("deadPeerNoFallbackGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		t.Errorf("不允许回退时不应从本地加载 %s", key)
+		return nil, nil
+	}), WithFailurePolicy(policy))
+	peer := &deadPeer{}
+	mygrp.RegisterPeers(&fakePicker{owned: map[string]PeerGetter{"Tom": peer}})
+
+	var peerErr *PeerError
+	if _, err := mygrp.Get("Tom"); !errors.As(err, &peerErr) {
+		t.Fatalf("应返回 *PeerError，实际为 %v", err)
+	}
+	if peerErr.Peer != "dead-peer" || peerErr.Key != "Tom" || !errors.Is(peerErr, ErrPeerUnavailable) {
+		t.Errorf("PeerError 内容不正确: %v", peerErr)
+	}
+	// 写请求同样返回 *PeerError
+	mygrp.RegisterPeers(&fakePicker{owned: map[string]PeerGetter{"Sam": peer}})
+	if err := mygrp.Set("Sam", []byte("700")); !errors.As(err, &peerErr) {
+		t.Fatalf("写请求应返回 *PeerError，实际为 %v", err)
+	}
+}
+
+func TestGroup_deadPeerGetMany(t *testing.T) {
+	mygrp := NewGroup("deadPeerGetManyGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}), WithFailurePolicy(testFailurePolicy))
+	peer := &deadPeer{}
+	mygrp.RegisterPeers(&fakePicker{owned: map[string]PeerGetter{"Tom": peer, "Jack": peer}})
+
+	results := mygrp.GetMany([]string{"Tom", "Jack", "Sam"})
+	for key, want := range map[string]string{"Tom": "630", "Jack": "589", "Sam": "567"} {
+		if res := results[key]; res.Err != nil || res.Value.String() != want {
+			t.Errorf("获取'%s'失败，实际值为 %v，错误 %v", key, res.Value, res.Err)
+		}
+	}
+}
+
+func TestGroup_getManyConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	mygrp := NewGroup("getManyConcurrencyGroup", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(time.Millisecond)
+		return []byte(key), nil
+	}), WithFailurePolicy(testFailurePolicy))
+	// 一半的key归属故障节点，回退到本地加载，与本地的key共用并发上限
+	owned := make(map[string]PeerGetter)
+	keys := make([]string, 200)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("k%d", i)
+		if i%2 == 0 {
+			owned[keys[i]] = &deadPeer{}
+		}
+	}
+	mygrp.RegisterPeers(&fakePicker{owned: owned})
+
+	results := mygrp.GetMany(keys)
+	for _, key := range keys {
+		if res := results[key]; res.Err != nil || res.Value.String() != key {
+			t.Fatalf("获取'%s'失败，实际值为 %v，错误 %v", key, res.Value, res.Err)
+		}
+	}
+	if p := peak.Load(); p > getManyLoadConcurrency {
+		t.Errorf("同时加载的key数应不超过 %d，实际为 %d", getManyLoadConcurrency, p)
+	}
+}
+
+func TestGroup_hotCache(t *testing.T) {
+	mygrp := NewGroup("hotCacheGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist", key)
+	}), WithHotCache(20, 1, time.Minute))
+	peer := &fakePeer{data: map[string]string{"Alice": "601"}}
+	mygrp.RegisterPeers(&fakePicker{owned: map[string]PeerGetter{"Alice": peer}})
+
+	// 采样率为1时，远程获取的数据一定写入热点缓存，第二次获取不再请求远程节点
+	for i := 0; i < 2; i++ {
+		if v, err := mygrp.Get("Alice"); err != nil || v.String() != "601" {
+			t.Fatalf("获取'Alice'失败，实际值为 %v，错误 %v", v, err)
+		}
+	}
+	if peer.calls != 1 {
+		t.Errorf("热点缓存命中后不应请求远程节点，实际请求 %d 次", peer.calls)
+	}
+	// 热点缓存中的值最多保存 ttl，之后重新请求远程节点
+	if v, ok := mygrp.hot.get("Alice"); !ok || v.ExpireAt().IsZero() || time.Until(v.ExpireAt()) > time.Minute {
+		t.Errorf("热点缓存的过期时间应不晚于1分钟后，实际为 %v", v.ExpireAt())
+	}
+	// 失效后重新请求远程节点
+	mygrp.Invalidate("Alice")
+	if _, err := mygrp.Get("Alice"); err != nil || peer.calls != 2 {
+		t.Errorf("失效后应重新请求远程节点，实际请求 %d 次，错误 %v", peer.calls, err)
+	}
+}
+
+func TestGroup_hotCachePercent(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	// 超出范围的百分比被限制在 0~99，不会使主缓存容量为0
+	for percent, want := range map[int]int64{-10: 0, 0: 0, 99: 2027, 100: 2027, 200: 2027} {
+		mygrp := NewGroup("hotCachePercentGroup", 2<<10, getter, WithHotCache(percent, 1, 0))
+		var hotBytes int64
+		if mygrp.hot != nil {
+			hotBytes = mygrp.hot.maxBytes
+		}
+		if hotBytes != want || mygrp.cache.maxBytes != 2<<10-want {
+			t.Errorf("percent=%d: 热点缓存 %d 字节，主缓存 %d 字节，期望热点缓存 %d 字节", percent, hotBytes, mygrp.cache.maxBytes, want)
+		}
+	}
+}
+
+func TestGroup_getContext(t *testing.T) {
+	var mu sync.Mutex
+	slow := true
+	mygrp := NewGroup("getContextGroup", 2<<10, GetterWithContextFunc(func(ctx context.Context, key string) (Item, error) {
+		mu.Lock()
+		wait := slow
+		mu.Unlock()
+		if wait {
+			// 模拟缓慢的源站，直到请求被取消
+			<-ctx.Done()
+			return Item{}, ctx.Err()
+		}
+		return Item{Value: []byte(db[key])}, nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := mygrp.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("源站超时应返回 context.DeadlineExceeded，实际为 %v", err)
+	}
+
+	// 被取消的加载结果不应被 singleflight 复用
+	mu.Lock()
+	slow = false
+	mu.Unlock()
+	if v, err := mygrp.Get("Tom"); err != nil || v.String() != "630" {
+		t.Errorf("取消后重新获取'Tom'失败，实际值为 %v，错误 %v", v, err)
+	}
+}
+
+func TestGroup_forwarded(t *testing.T) {
+	mygrp := NewGroup("forwardedGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	peer := &fakePeer{data: map[string]string{"Tom": "remote"}}
+	mygrp.RegisterPeers(&fakePicker{owned: map[string]PeerGetter{"Tom": peer}})
+
+	// 其他节点转发的请求直接在本地加载，不再转发给归属节点
+	if v, err := mygrp.GetContext(withForwarded(context.Background()), "Tom"); err != nil || v.String() != "630" {
+		t.Errorf("转发的请求应在本地加载'Tom'，实际值为 %v，错误 %v", v, err)
+	}
+	if peer.calls != 0 {
+		t.Errorf("转发的请求不应再请求远程节点，实际请求 %d 次", peer.calls)
+	}
+	// 不归属本节点的key只短暂缓存
+	v, ok := mygrp.cache.get("Tom")
+	if !ok || v.ExpireAt().IsZero() || time.Until(v.ExpireAt()) > nonOwnerTTL {
+		t.Errorf("不归属本节点的key应只缓存 %v，实际过期时间为 %v", nonOwnerTTL, v.ExpireAt())
+	}
+}
+
+func TestGroup_replicas(t *testing.T) {
+	var loads int
+	mygrp := NewGroup("replicasGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(db[key]), nil
+	}), WithFailurePolicy(testFailurePolicy))
+	dead := &deadPeer{}
+	alive := &fakePeer{data: map[string]string{"Tom": "remote"}}
+	replica := &fakePeer{}
+	mygrp.RegisterPeers(&fakePicker{replicas: map[string][]PeerGetter{
+		"Tom":  {dead, alive},
+		"Jack": {nil, replica},
+		"Sam":  {nil, dead},
+	}})
+
+	// 归属节点故障时从下一个副本获取，不回源
+	if v, err := mygrp.Get("Tom"); err != nil || v.String() != "remote" || loads != 0 {
+		t.Errorf("应从第二个副本获取'Tom'，实际值为 %v，错误 %v，回源 %d 次", v, err, loads)
+	}
+
+	// 写入同时发送给其他副本
+	if err := mygrp.Set("Jack", []byte("600")); err != nil {
+		t.Fatal(err)
+	}
+	replica.mu.Lock()
+	got := replica.data["Jack"]
+	replica.mu.Unlock()
+	if got != "600" {
+		t.Errorf("写入应同步到副本，副本中的值为 %q", got)
+	}
+	if v, err := mygrp.Get("Jack"); err != nil || v.String() != "600" {
+		t.Errorf("本节点是副本时应写入本地缓存，实际值为 %v，错误 %v", v, err)
+	}
+
+	// 其他副本重试后仍写入失败时返回错误
+	var peerErr *PeerError
+	if err := mygrp.Set("Sam", []byte("601")); !errors.As(err, &peerErr) {
+		t.Errorf("副本写入失败时应返回 *PeerError，实际为 %v", err)
+	}
+}
+
+func TestGroup_replicaFill(t *testing.T) {
+	mygrp := NewGroup("replicaFillGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	ctx := withFill(withForwarded(context.Background()))
+
+	// 同步来的加载结果不覆盖本地的新值，也不写入之后已删除的key
+	if err := mygrp.Set("Tom", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mygrp.Remove("Jack"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		if err := mygrp.set(ctx, key, ByteView{b: []byte("filled")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, _ := mygrp.cache.get("Tom"); v.String() != "new" {
+		t.Errorf("同步不应覆盖本地的新值，实际为 %q", v.String())
+	}
+	if _, ok := mygrp.cache.get("Jack"); ok {
+		t.Error("同步不应写入已删除的key")
+	}
+	if v, _ := mygrp.cache.get("Sam"); v.String() != "filled" {
+		t.Errorf("同步应写入本地没有的key，实际为 %q", v.String())
+	}
+}
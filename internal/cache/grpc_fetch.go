@@ -3,53 +3,213 @@ package cache
 import (
 	pb "FishCache/api/groupcachepb"
 	"context"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"time"
 )
 
 // HashPeerPicker 用于根据传入的 key 选择相应节点。
 type HashPeerPicker interface {
+	// PickPeer 选择处理读请求的节点，可能因负载均衡而不是key的归属节点
 	PickPeer(key string) (peer PeerGetter, ok bool)
+	// PickOwner 返回key的归属节点，写入和删除必须发送给归属节点；不健康的节点同样返回，
+	// 写入不能因节点处于冷却期而只写入本地
+	PickOwner(key string) (peer PeerGetter, ok bool)
+	// PickReplicas 按优先顺序返回保存key的所有副本节点，第一个为归属节点，nil 表示本节点；
+	// 不健康的节点不会被返回，用于读请求。未开启多副本时最多返回一个节点。
+	PickReplicas(key string) []PeerGetter
+	// PickOwners 与 PickReplicas 相同，但不跳过不健康的节点，用于写入和删除
+	PickOwners(key string) []PeerGetter
+	// MarkUnhealthy 标记节点不健康，冷却期内 PickPeer 不再选择该节点
+	MarkUnhealthy(peer PeerGetter)
 }
 
-// PeerGetter 用于从对应 group 查找缓存值。
+// PeerGetter 用于从对应 group 查找、写入或删除缓存值。
+// 网络类错误需包装 ErrPeerUnavailable，以便调用方区分节点故障和业务错误；
+// ctx 取消或超时引起的错误应保留 ctx 的错误，不视为节点故障。
 type PeerGetter interface {
-	Get(group string, key string) ([]byte, error)
+	Addr() string
+	Get(ctx context.Context, group string, key string) (ByteView, error)
+	GetMulti(ctx context.Context, group string, keys []string) (map[string]GetResult, error)
+	Set(ctx context.Context, group string, key string, value ByteView) error
+	Delete(ctx context.Context, group string, key string) error
 }
 
-type grpcGetter struct {
-	addr string
+// 节点间转发的请求携带该元数据，接收方直接在本地处理而不再转发，
+// 避免各节点的节点视图或负载不一致时请求在节点间循环
+const forwardedMetadataKey = "fishcache-forwarded"
+
+type forwardedContextKey struct{}
+
+// 标记请求已由其他节点转发
+func withForwarded(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forwardedContextKey{}, true)
 }
 
-func (g *grpcGetter) Get(group string, key string) ([]byte, error) {
-	// 创建一个带有超时的上下文
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
+// 判断请求是否由其他节点转发而来
+func isForwarded(ctx context.Context) bool {
+	forwarded, _ := ctx.Value(forwardedContextKey{}).(bool)
+	return forwarded
+}
+
+// 副本之间同步加载结果的写入携带该元数据，接收方本地已有该key或最近删除过该key时忽略，
+// 避免异步同步晚于之后的写入或删除到达，覆盖新值或使已删除的key重新出现
+const fillMetadataKey = "fishcache-fill"
+
+type fillContextKey struct{}
+
+// 标记写入只用于同步副本
+func withFill(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fillContextKey{}, true)
+}
+
+// 判断写入是否只用于同步副本
+func isFill(ctx context.Context) bool {
+	fill, _ := ctx.Value(fillContextKey{}).(bool)
+	return fill
+}
+
+// grpcGetter 持有到一个远程节点的长连接，连接在节点加入哈希环时建立、离开时关闭
+type grpcGetter struct {
+	addr    string
+	conn    *grpc.ClientConn
+	client  pb.CacheServiceClient
+	timeout time.Duration // 单次调用的超时时间
+}
 
+// 建立到远程节点的长连接，grpc.NewClient 不会立即拨号，连接在首次调用时建立并自动重连
+func newGrpcGetter(addr string, timeout time.Duration, kp keepalive.ClientParameters, creds credentials.TransportCredentials) (*grpcGetter, error) {
 	// 设置连接选项
 	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()), // 显式使用不安全的凭证
+		grpc.WithTransportCredentials(creds), // 明文或TLS凭证，由 Server 的配置决定
+		grpc.WithKeepaliveParams(kp),         // 空闲时定期探活，及时发现失效连接
+	}
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create client for peer %s: %v", addr, err)
+	}
+	return &grpcGetter{
+		addr:    addr,
+		conn:    conn,
+		client:  pb.NewCacheServiceClient(conn),
+		timeout: timeout,
+	}, nil
+}
+
+// 在调用方 ctx 的基础上为单次调用设置超时时间，并在 fn 中执行实际的 RPC 请求
+func (g *grpcGetter) call(parent context.Context, fn func(ctx context.Context, client pb.CacheServiceClient) error) error {
+	ctx, cancel := context.WithTimeout(parent, g.timeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, forwardedMetadataKey, "1")
+	if isFill(parent) {
+		ctx = metadata.AppendToOutgoingContext(ctx, fillMetadataKey, "1")
+	}
+
+	err := fn(ctx, g.client)
+	// 调用方已取消或超时时返回 ctx 的错误，不归咎于远程节点
+	if err != nil && parent.Err() != nil {
+		return fmt.Errorf("%w: %v", parent.Err(), err)
+	}
+	return g.wrapError(err)
+}
+
+func (g *grpcGetter) Addr() string {
+	return g.addr
+}
+
+// 将RPC错误转换为本地错误，节点不可达或超时的错误包装为 ErrPeerUnavailable
+func (g *grpcGetter) wrapError(err error) error {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return fmt.Errorf("%w: %v", ErrPeerUnavailable, err)
+	case codes.NotFound:
+		// 归属节点上key不存在，保留 ErrNotFound 语义
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	default:
+		return err
+	}
+}
+
+// 关闭到远程节点的连接
+func (g *grpcGetter) close() {
+	if err := g.conn.Close(); err != nil {
+		log.Errorf("grpc connection close error: %s", err.Error())
 	}
-	// 调用 NewClient 创建连接
-	conn, _ := grpc.NewClient(g.addr, opts...)
-	defer func() {
-		err := conn.Close()
+}
+
+func (g *grpcGetter) Get(ctx context.Context, group string, key string) (ByteView, error) {
+	var value ByteView
+	err := g.call(ctx, func(ctx context.Context, client pb.CacheServiceClient) error {
+		resp, err := client.Get(ctx, &pb.GetRequest{
+			Group: group,
+			Key:   key,
+		})
+		if err != nil {
+			return fmt.Errorf("could not get %s/%s from peer %s: %w", group, key, g.addr, err)
+		}
+		value = ByteView{b: resp.Value, expireAt: expireAtFromMillis(resp.ExpireAt)}
+		return nil
+	})
+	return value, err
+}
+
+func (g *grpcGetter) GetMulti(ctx context.Context, group string, keys []string) (map[string]GetResult, error) {
+	results := make(map[string]GetResult, len(keys))
+	err := g.call(ctx, func(ctx context.Context, client pb.CacheServiceClient) error {
+		resp, err := client.GetMulti(ctx, &pb.GetMultiRequest{
+			Group: group,
+			Keys:  keys,
+		})
 		if err != nil {
-			log.Errorf("grpc connection close error: %s", err.Error())
+			return fmt.Errorf("could not get %d keys of %s from peer %s: %w", len(keys), group, g.addr, err)
+		}
+		for _, entry := range resp.Entries {
+			if entry.NotFound {
+				results[entry.Key] = GetResult{Err: fmt.Errorf("%w: %s", ErrNotFound, entry.Error)}
+				continue
+			}
+			if entry.Error != "" {
+				results[entry.Key] = GetResult{Err: errors.New(entry.Error)}
+				continue
+			}
+			results[entry.Key] = GetResult{Value: ByteView{b: entry.Value, expireAt: expireAtFromMillis(entry.ExpireAt)}}
 		}
-	}()
+		return nil
+	})
+	return results, err
+}
 
-	grpcClient := pb.NewCacheServiceClient(conn)
-	resp, err := grpcClient.Get(ctx, &pb.GetRequest{
-		Group: group,
-		Key:   key,
+func (g *grpcGetter) Set(ctx context.Context, group string, key string, value ByteView) error {
+	return g.call(ctx, func(ctx context.Context, client pb.CacheServiceClient) error {
+		_, err := client.Set(ctx, &pb.SetRequest{
+			Group:    group,
+			Key:      key,
+			Value:    value.b,
+			ExpireAt: value.expireAtMillis(),
+		})
+		if err != nil {
+			return fmt.Errorf("could not set %s/%s to peer %s: %w", group, key, g.addr, err)
+		}
+		return nil
 	})
-	if err != nil {
-		return nil, fmt.Errorf("could not get %s/%s from peer %s", group, key, g.addr)
-	}
+}
 
-	return resp.Value, nil
+func (g *grpcGetter) Delete(ctx context.Context, group string, key string) error {
+	return g.call(ctx, func(ctx context.Context, client pb.CacheServiceClient) error {
+		_, err := client.Delete(ctx, &pb.DeleteRequest{
+			Group: group,
+			Key:   key,
+		})
+		if err != nil {
+			return fmt.Errorf("could not delete %s/%s from peer %s: %w", group, key, g.addr, err)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"FishCache/internal/discovery"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestServer_peerConnReuse(t *testing.T) {
+	NewGroup("connReuseGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	s, _ := startTestServer(t)
+	peer, _ := startTestServer(t)
+	s.SetPeers([]discovery.Node{{Addr: peer.address, Weight: 10}})
+
+	// 对同一节点的多次请求共用一个连接
+	var conn *grpc.ClientConn
+	gets := 0
+	for i := 0; i < 100 && gets < 5; i++ {
+		key := "key" + strconv.Itoa(i)
+		getter, ok := s.PickOwner(key)
+		if !ok {
+			continue
+		}
+		g := getter.(*grpcGetter)
+		if conn == nil {
+			conn = g.conn
+		} else if g.conn != conn {
+			t.Fatalf("%s uses another connection to %s", key, g.addr)
+		}
+		if v, err := g.Get(context.Background(), "connReuseGroup", key); err != nil || v.String() != key {
+			t.Fatalf("get %s = %q, %v", key, v.String(), err)
+		}
+		gets++
+	}
+	if gets < 5 {
+		t.Fatalf("only %d keys owned by the peer", gets)
+	}
+
+	// 节点仍在哈希环中时复用原有连接
+	s.SetPeers([]discovery.Node{{Addr: peer.address, Weight: 10}, {Addr: "127.0.0.1:1", Weight: 10}})
+	if s.clients[peer.address].conn != conn {
+		t.Error("connection should be reused while the peer stays in the ring")
+	}
+
+	// 节点离开哈希环后关闭其连接
+	s.SetPeers(nil)
+	if state := conn.GetState(); state != connectivity.Shutdown {
+		t.Errorf("connection state = %v after the peer was removed, want %v", state, connectivity.Shutdown)
+	}
+	if _, ok := s.clients[peer.address]; ok {
+		t.Error("removed peer should have no client")
+	}
+}
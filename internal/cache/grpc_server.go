@@ -2,66 +2,294 @@ package cache
 
 import (
 	pb "FishCache/api/groupcachepb"
-	"FishCache/internal/discovery/etcd"
+	"FishCache/internal/discovery"
+	"FishCache/internal/metrics"
+	"FishCache/internal/tlsutil"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
+	"maps"
 	"net"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
 	defaultRpcAddr           = "127.0.0.1:23333" // 默认地址
 	defaultRpcClientReplicas = 50                // 默认副本数
+	defaultCallTimeout       = 10 * time.Second  // 默认的单次节点间调用超时时间
+	defaultKeepaliveTime     = 30 * time.Second  // 连接空闲多久后发送探活
+	defaultKeepaliveTimeout  = 5 * time.Second   // 探活响应的超时时间
+	defaultUnhealthyCooldown = 10 * time.Second  // 节点被标记不健康后的冷却时间
 )
 
 // Server 服务器为分布式缓存提供基于gRPC的点对点通信。
 type Server struct {
 	pb.UnimplementedCacheServiceServer // 嵌入未实现的 gRPC 服务器接口
 
-	address       string                 // 服务器地址
-	isRunning     bool                   // 服务器运行状态
-	mu            sync.RWMutex           // 读写锁，保护并发访问
-	consistHash   *ConsistentMap         // 一致性哈希映射
-	clients       map[string]*grpcGetter // 每一个远程节点对应一个 client
-	stopChannel   chan error             // 服务器停止时触发的通道
-	updateChannel chan struct{}          // 服务器更新时触发的通道
+	address        string                     // 服务器地址
+	isRunning      bool                       // 服务器运行状态
+	mu             sync.RWMutex               // 读写锁，保护并发访问
+	locator        NodeLocator                // 根据key定位归属节点
+	placement      PlacementType              // 数据分布算法
+	boundedLoad    float64                    // 有界负载的 epsilon，为0时关闭
+	replicas       int                        // 每个key保存的副本数
+	nodes          map[string]int             // 当前所有节点及其权重
+	handoffLimiter *rateLimiter               // 节点变化时迁移缓存的限速，为nil时不迁移
+	handoffCancel  context.CancelFunc         // 取消正在进行的迁移
+	handoffDone    chan struct{}              // 最近一次迁移结束时关闭，未迁移时为nil
+	draining       bool                       // 已调用 Drain，本节点不再加入哈希环
+	registerCancel context.CancelFunc         // 停止注册本节点
+	startedAt      time.Time                  // 服务器的创建时间
+	loads          *loadTracker               // 各节点近期被 PickPeer 选中的次数
+	clients        map[string]*grpcGetter     // 每一个远程节点对应一个 client，连接在节点离开哈希环前一直复用
+	discoverer     discovery.Discoverer       // 服务注册与发现
+	cancel         context.CancelFunc         // 停止服务器时取消注册和节点监听
+	ctx            context.Context            // 服务器运行期间有效，停止时取消
+	weight         int                        // 本节点的权重，注册到 discoverer 并决定本节点负责的key比例
+	callTimeout    time.Duration              // 节点间单次调用的超时时间
+	keepalive      keepalive.ClientParameters // 节点间连接的探活参数
+	unhealthy      map[string]time.Time       // 不健康节点及其冷却结束时间
+	cooldown       time.Duration              // 节点被标记不健康后的冷却时间
+	handlerLatency *metrics.HistogramVec      // gRPC处理耗时，按方法区分
+	tls            *tlsutil.Reloader          // 节点间通信的证书，为nil时使用明文
+	serverTLS      *tls.Config                // 由 tls 生成的服务端配置
 }
 
-func NewRPCServer(address string) (*Server, error) {
+// ServerOption 用于定制 Server 的可选配置
+type ServerOption func(*Server)
+
+// WithCallTimeout 设置节点间单次调用的超时时间
+func WithCallTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		if timeout > 0 {
+			s.callTimeout = timeout
+		}
+	}
+}
+
+// WithTLS 使用TLS加密节点间的gRPC通信：本节点作为服务端时使用 r 中的证书，作为客户端连接其他节点时
+// 用 r 中的CA校验对端证书，并在对端要求时提供本节点的证书（mTLS）。证书文件更新后自动生效。
+// 集群中所有节点必须同时开启或关闭TLS。
+func WithTLS(r *tlsutil.Reloader) ServerOption {
+	return func(s *Server) {
+		s.tls = r
+	}
+}
+
+// WithWeight 设置本节点的权重，默认为 discovery.DefaultWeight，内存更大的节点应设置更大的权重
+func WithWeight(weight int) ServerOption {
+	return func(s *Server) {
+		if weight > 0 {
+			s.weight = weight
+		}
+	}
+}
+
+// WithPlacement 设置key在节点间的分布算法，集群中所有节点必须使用相同的算法，默认为一致性哈希环
+func WithPlacement(placement PlacementType) ServerOption {
+	return func(s *Server) {
+		s.placement = placement
+	}
+}
+
+// WithBoundedLoad 开启有界负载的一致性哈希，节点近期负载超过平均值的 (1+epsilon) 倍时，读请求顺延到下一个节点。
+// 仅一致性哈希环支持。被顺延的节点会从源数据加载并缓存key，归属节点上的写入不会使其失效，直到该缓存过期。
+func WithBoundedLoad(epsilon float64) ServerOption {
+	return func(s *Server) {
+		if epsilon > 0 {
+			s.boundedLoad = epsilon
+		}
+	}
+}
+
+// WithReplicas 设置每个key保存在多少个节点上，默认为1。写入会发送给所有副本，
+// 读取时按优先顺序尝试各副本，某个节点故障时由其他副本提供数据而不必全部回源
+func WithReplicas(n int) ServerOption {
+	return func(s *Server) {
+		if n > 0 {
+			s.replicas = n
+		}
+	}
+}
+
+// WithHandoffRate 设置节点变化时迁移缓存的速率（字节每秒），默认为8MiB/s；rate<=0 时关闭迁移，
+// 不再归属本节点的缓存将留在本地直到被淘汰
+func WithHandoffRate(rate int64) ServerOption {
+	return func(s *Server) {
+		if rate <= 0 {
+			s.handoffLimiter = nil
+			return
+		}
+		s.handoffLimiter = newRateLimiter(rate, rate)
+	}
+}
+
+// WithKeepalive 设置节点间连接的探活间隔和探活超时时间
+func WithKeepalive(interval, timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		if interval > 0 {
+			s.keepalive.Time = interval
+		}
+		if timeout > 0 {
+			s.keepalive.Timeout = timeout
+		}
+	}
+}
+
+// WithUnhealthyCooldown 设置节点被标记不健康后的冷却时间，冷却期内该节点负责的key由本节点加载
+func WithUnhealthyCooldown(cooldown time.Duration) ServerOption {
+	return func(s *Server) {
+		if cooldown > 0 {
+			s.cooldown = cooldown
+		}
+	}
+}
+
+// NewRPCServer 创建服务器，哈希环中的节点由 discoverer 提供
+func NewRPCServer(address string, discoverer discovery.Discoverer, opts ...ServerOption) (*Server, error) {
 	if address == "" {
 		address = defaultRpcAddr
 	}
+	if discoverer == nil {
+		return nil, fmt.Errorf("discoverer is nil")
+	}
 
 	//if !validate.ValidPeerAddr(addr) { // 验证地址格式
 	//	return nil, fmt.Errorf("invalid peer address %s", addr)
 	//}
 
-	return &Server{address: address}, nil
+	s := &Server{
+		address:        address,
+		discoverer:     discoverer,
+		weight:         discovery.DefaultWeight,
+		placement:      PlacementRing,
+		replicas:       1,
+		loads:          newLoadTracker(defaultLoadHalfLife),
+		handoffLimiter: newRateLimiter(defaultHandoffRate, defaultHandoffRate),
+		callTimeout:    defaultCallTimeout,
+		keepalive: keepalive.ClientParameters{
+			Time:                defaultKeepaliveTime,
+			Timeout:             defaultKeepaliveTimeout,
+			PermitWithoutStream: true,
+		},
+		unhealthy:      make(map[string]time.Time),
+		cooldown:       defaultUnhealthyCooldown,
+		handlerLatency: metrics.NewHistogramVec("method", metrics.DefaultLatencyBuckets),
+		startedAt:      time.Now(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	// 提前校验分布算法，避免在更新节点时才发现配置错误
+	locator, err := NewNodeLocator(s.placement)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := locator.(boundedLocator); s.boundedLoad > 0 && !ok {
+		return nil, fmt.Errorf("placement %q does not support bounded load", s.placement)
+	}
+	if s.tls != nil {
+		if s.serverTLS, err = s.tls.ServerConfig(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
 // Get 作为server根据client请求的 group name 和 key 返回对应缓存数据
-func (s *Server) Get(_ context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
 	group := GetGroup(req.Group)
 	if group == nil {
-		return &pb.GetResponse{}, fmt.Errorf("group name is nil")
+		return &pb.GetResponse{}, grpcError(fmt.Errorf("%w: %s", ErrGroupNotFound, req.Group))
 	}
 	// 从缓存组中获取指定key的值
-	view, err := group.Get(req.Key)
+	view, err := group.GetContext(ctx, req.Key)
 	if err != nil {
-		return &pb.GetResponse{}, fmt.Errorf("search %s error: %v", req.Key, err)
+		return &pb.GetResponse{}, grpcError(fmt.Errorf("search %s error: %w", req.Key, err))
 	}
 
 	value := view.ByteSlice()
 	return &pb.GetResponse{
-		Value: value,
+		Value:    value,
+		ExpireAt: view.expireAtMillis(),
 	}, nil
 }
 
-// InitServer 初始化服务器
+// GetMulti 作为server批量返回缓存数据，单个key的错误写入对应条目而不使整个请求失败
+func (s *Server) GetMulti(ctx context.Context, req *pb.GetMultiRequest) (*pb.GetMultiResponse, error) {
+	group := GetGroup(req.Group)
+	if group == nil {
+		return &pb.GetMultiResponse{}, grpcError(fmt.Errorf("%w: %s", ErrGroupNotFound, req.Group))
+	}
+
+	results := group.GetManyContext(ctx, req.Keys)
+	resp := &pb.GetMultiResponse{Entries: make([]*pb.KeyValue, 0, len(results))}
+	for _, key := range req.Keys {
+		res, ok := results[key]
+		if !ok {
+			continue
+		}
+		// 重复的key只返回一次
+		delete(results, key)
+		entry := &pb.KeyValue{Key: key}
+		if res.Err != nil {
+			entry.Error = res.Err.Error()
+			entry.NotFound = errors.Is(res.Err, ErrNotFound)
+		} else {
+			entry.Value = res.Value.ByteSlice()
+			entry.ExpireAt = res.Value.expireAtMillis()
+		}
+		resp.Entries = append(resp.Entries, entry)
+	}
+	return resp, nil
+}
+
+// Set 作为server写入缓存数据，key不归属本节点时由 Group 转发给归属节点
+func (s *Server) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	group := GetGroup(req.Group)
+	if group == nil {
+		return &pb.SetResponse{}, grpcError(fmt.Errorf("%w: %s", ErrGroupNotFound, req.Group))
+	}
+	value := ByteView{b: cloneBytes(req.Value), expireAt: expireAtFromMillis(req.ExpireAt)}
+	if err := group.set(ctx, req.Key, value); err != nil {
+		return &pb.SetResponse{}, grpcError(fmt.Errorf("set %s error: %w", req.Key, err))
+	}
+	return &pb.SetResponse{}, nil
+}
+
+// Delete 作为server删除缓存数据，key不归属本节点时由 Group 转发给归属节点
+func (s *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	group := GetGroup(req.Group)
+	if group == nil {
+		return &pb.DeleteResponse{}, grpcError(fmt.Errorf("%w: %s", ErrGroupNotFound, req.Group))
+	}
+	if err := group.remove(ctx, req.Key); err != nil {
+		return &pb.DeleteResponse{}, grpcError(fmt.Errorf("delete %s error: %w", req.Key, err))
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+// Invalidate 仅使本节点中的缓存数据失效
+func (s *Server) Invalidate(_ context.Context, req *pb.InvalidateRequest) (*pb.InvalidateResponse, error) {
+	group := GetGroup(req.Group)
+	if group == nil {
+		return &pb.InvalidateResponse{}, grpcError(fmt.Errorf("%w: %s", ErrGroupNotFound, req.Group))
+	}
+	group.Invalidate(req.Key)
+	return &pb.InvalidateResponse{}, nil
+}
+
+// InitServer 初始化服务器：从 discoverer 获取节点构建哈希环，并在节点变化时更新
 func (s *Server) InitServer() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -70,34 +298,49 @@ func (s *Server) InitServer() error {
 		return fmt.Errorf("server already running")
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := s.discoverer.Watch(ctx)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("watch peers failed: %w", err)
+	}
 	s.isRunning = true
-	s.stopChannel = make(chan error)
-	s.updateChannel = make(chan struct{})
+	s.ctx, s.cancel = ctx, cancel
+
 	go func() {
+		// 先构建一次哈希环，并从其他节点拉取归属于本节点的缓存，之后每次收到通知时更新
+		s.refreshPeers(ctx)
+		if s.handoffLimiter != nil {
+			s.pullFromPeers(ctx)
+		}
 		for {
 			select {
-			case _ = <-s.updateChannel:
-				// 更新哈希环
-				peersAddr, err := etcd.ListServicePeers()
-				if err != nil {
-					log.Errorf("ListServicePeers error: %v", err)
+			case _, ok := <-updates:
+				if !ok {
+					if ctx.Err() == nil {
+						log.Errorf("peer updates closed unexpectedly, the hash ring will no longer be updated")
+					}
 					return
 				}
-				s.SetPeers(peersAddr)
-			case err := <-s.stopChannel:
-				// 停止grpc服务
-				log.Errorf("handle error: %v", err)
-				if err = s.StopServer(); err != nil {
-					log.Errorf("Failed to stop server: %v", err)
-				}
+				s.refreshPeers(ctx)
+			case <-ctx.Done():
 				return
-			default:
 			}
 		}
 	}()
 	return nil
 }
 
+// 从 discoverer 获取节点并更新哈希环，获取失败时保留当前的哈希环
+func (s *Server) refreshPeers(ctx context.Context) {
+	peersAddr, err := s.discoverer.List(ctx)
+	if err != nil {
+		log.Errorf("list peers error: %v", err)
+		return
+	}
+	s.SetPeers(peersAddr)
+}
+
 // 设置监听器
 func (s *Server) setupListener() (net.Listener, error) {
 	// 从地址中提取端口号
@@ -109,10 +352,41 @@ func (s *Server) setupListener() (net.Listener, error) {
 	return lis, nil
 }
 
+// 连接其他节点时使用的传输凭证
+func (s *Server) clientCredentials() credentials.TransportCredentials {
+	if s.tls == nil {
+		return insecure.NewCredentials()
+	}
+	return s.tls.Credentials()
+}
+
+// 将其他节点转发的请求和副本同步的写入标记到 ctx 中，Group 据此在本地处理
+func forwardedInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if len(md.Get(forwardedMetadataKey)) > 0 {
+			ctx = withForwarded(ctx)
+		}
+		if len(md.Get(fillMetadataKey)) > 0 {
+			ctx = withFill(ctx)
+		}
+	}
+	return handler(ctx, req)
+}
+
 // 设置gRPC服务器
 func (s *Server) setupGRPCServer() *grpc.Server {
-	// 创建新的gRPC服务器
-	grpcServer := grpc.NewServer()
+	// 创建新的gRPC服务器，放宽探活限制以允许其他节点在空闲连接上探活
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             s.keepalive.Time / 2,
+			PermitWithoutStream: true,
+		}),
+		grpc.ChainUnaryInterceptor(s.latencyInterceptor, forwardedInterceptor),
+	}
+	if s.serverTLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.serverTLS)))
+	}
+	grpcServer := grpc.NewServer(opts...)
 	// 注册缓存服务
 	pb.RegisterCacheServiceServer(grpcServer, s)
 	reflection.Register(grpcServer)
@@ -147,38 +421,105 @@ func (s *Server) RunServer() error {
 	return nil
 }
 
+// StopServer 停止服务并注销本节点。锁内只修改状态并取出连接，注销、关闭连接和保存快照在锁外进行，
+// 不阻塞期间的请求路由
 func (s *Server) StopServer() error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.isRunning {
+		s.mu.Unlock()
 		return nil
 	}
-
-	close(s.stopChannel)
+	s.cancel()
 	s.isRunning = false
+	if s.handoffCancel != nil {
+		s.handoffCancel()
+	}
+	clients := s.clients
+	s.clients = nil
+	s.mu.Unlock()
+
+	// 注销本节点，使其他节点尽快将其移出哈希环
+	ctx, cancel := context.WithTimeout(context.Background(), s.callTimeout)
+	defer cancel()
+	if err := s.discoverer.Deregister(ctx, s.address); err != nil {
+		log.Errorf("deregister %s failed: %v", s.address, err)
+	}
+	// 关闭到所有远程节点的连接
+	for _, client := range clients {
+		client.close()
+	}
+	// 停止定时保存并保存快照，重启后从快照恢复缓存
+	StopSnapshots()
 	return nil
 }
 
-// SetPeers 设置客户端节点在哈希环中的位置
-func (s *Server) SetPeers(peers []string) {
+// SetPeers 按节点及其权重重建节点定位器，节点负责的key数量与权重成正比
+func (s *Server) SetPeers(peers []discovery.Node) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if len(peers) == 0 {
-		peers = []string{s.address}
+	// 哈希环加入自身，discoverer 返回的自身权重优先；Drain 后不再加入自身
+	weights := map[string]int{s.address: s.weight}
+	if s.draining {
+		delete(weights, s.address)
+	}
+	for _, peer := range peers {
+		if s.draining && peer.Addr == s.address {
+			continue
+		}
+		weights[peer.Addr] = max(peer.Weight, 1)
 	}
-	nodes := append(peers, s.address) // 哈希环加入自身
 
-	s.consistHash = NewConsistentHash(defaultRpcClientReplicas, nil)
-	s.consistHash.AddNodes(nodes...)
-	s.clients = make(map[string]*grpcGetter, len(peers))
-	for _, peerAddress := range peers {
-		// 根据传入的节点，为每一个node创建一个grpc客户端
-		s.clients[peerAddress] = &grpcGetter{addr: peerAddress}
+	// 构造时已校验过分布算法
+	s.locator, _ = NewNodeLocator(s.placement)
+	s.locator.SetNodes(weights)
+	s.loads.retain(weights)
+	clients := make(map[string]*grpcGetter, len(peers))
+	for peerAddress := range weights {
+		if peerAddress == s.address {
+			continue
+		}
+		// 复用仍在哈希环中的节点连接
+		if client, ok := s.clients[peerAddress]; ok {
+			clients[peerAddress] = client
+			continue
+		}
+		// 为新加入的节点创建一个grpc客户端
+		client, err := newGrpcGetter(peerAddress, s.callTimeout, s.keepalive, s.clientCredentials())
+		if err != nil {
+			log.Errorf("create grpc client for %s failed: %v", peerAddress, err)
+			continue
+		}
+		clients[peerAddress] = client
+	}
+	// 关闭已离开哈希环的节点连接
+	for peerAddress, client := range s.clients {
+		if _, ok := clients[peerAddress]; !ok {
+			client.close()
+			delete(s.unhealthy, peerAddress)
+		}
 	}
-	log.Infof("更新邻居: %s", peers)
+	s.clients = clients
+	s.nodes = weights
+	log.Infof("更新邻居: %v", weights)
 	s.updateGroupsPeers()
+
+	// 将不再归属本节点的缓存迁移给新的归属节点，取消上一次尚未完成的迁移
+	if s.handoffLimiter != nil {
+		if s.handoffCancel != nil {
+			s.handoffCancel()
+		}
+		var ctx context.Context
+		ctx, s.handoffCancel = context.WithCancel(context.Background())
+		done := make(chan struct{})
+		s.handoffDone = done
+		// 在持有锁时取出当前的哈希环和连接，之后的 SetPeers 会替换这些字段
+		locator, owners := s.locator, maps.Clone(clients)
+		go func() {
+			defer close(done)
+			s.handoff(ctx, locator, owners)
+		}()
+	}
 }
 
 func (s *Server) updateGroupsPeers() {
@@ -187,7 +528,8 @@ func (s *Server) updateGroupsPeers() {
 	}
 }
 
-// PickPeer 根据具体的 key，选择节点
+// PickPeer 根据具体的 key，选择处理读请求的节点。开启有界负载时，归属节点近期负载过高会顺延到下一个有容量的节点，
+// 每次选择都计入被选中节点的负载。
 func (s *Server) PickPeer(key string) (PeerGetter, bool) {
 	if key == "" {
 		return nil, false
@@ -196,7 +538,75 @@ func (s *Server) PickPeer(key string) (PeerGetter, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	peer := s.consistHash.GetNode(key)
+	if s.locator == nil {
+		return nil, false
+	}
+	var peer string
+	if s.boundedLoad > 0 {
+		now := time.Now()
+		peer = s.locator.(boundedLocator).GetNodeBounded(key, s.boundedLoad, func(node string) float64 {
+			return s.loads.load(node, now)
+		})
+		if peer != "" {
+			s.loads.add(peer, now)
+		}
+	} else {
+		peer = s.locator.GetNode(key)
+	}
+	return s.peerClient(peer, true)
+}
+
+// PickOwner 返回key的归属节点，不受有界负载和不健康冷却期影响，写入和删除需发送给归属节点
+func (s *Server) PickOwner(key string) (PeerGetter, bool) {
+	if key == "" {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locator == nil {
+		return nil, false
+	}
+	return s.peerClient(s.locator.GetNode(key), false)
+}
+
+// PickReplicas 按优先顺序返回key的副本节点，nil 表示本节点，处于不健康冷却期的节点被跳过
+func (s *Server) PickReplicas(key string) []PeerGetter {
+	return s.pickReplicas(key, true)
+}
+
+// PickOwners 按优先顺序返回key的副本节点，nil 表示本节点，包括处于不健康冷却期的节点
+func (s *Server) PickOwners(key string) []PeerGetter {
+	return s.pickReplicas(key, false)
+}
+
+func (s *Server) pickReplicas(key string, healthyOnly bool) []PeerGetter {
+	if key == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locator == nil {
+		return nil
+	}
+	nodes := s.locator.GetNodes(key, s.replicas)
+	peers := make([]PeerGetter, 0, len(nodes))
+	for _, node := range nodes {
+		if node == s.address {
+			peers = append(peers, nil)
+		} else if client, ok := s.peerClient(node, healthyOnly); ok {
+			peers = append(peers, client)
+		}
+	}
+	return peers
+}
+
+// 返回节点对应的客户端，节点为自身时返回false；healthyOnly 为true时处于不健康冷却期的节点也返回false。
+// 调用方需持有锁
+func (s *Server) peerClient(peer string, healthyOnly bool) (PeerGetter, bool) {
 	if peer == "" {
 		return nil, false
 	}
@@ -205,18 +615,45 @@ func (s *Server) PickPeer(key string) (PeerGetter, bool) {
 	if peer == s.address {
 		return nil, false
 	}
-	return s.clients[peer], true
+	client, ok := s.clients[peer]
+	if !ok {
+		return nil, false
+	}
+	// 冷却期内的不健康节点不参与读请求的选择，由本节点负责加载
+	if until, ok := s.unhealthy[peer]; ok && healthyOnly {
+		if time.Now().Before(until) {
+			return nil, false
+		}
+		delete(s.unhealthy, peer)
+	}
+	return client, true
 }
 
-func (s *Server) RegisterEtcd() {
-	// 先对serviceName这一key开启watch监控
-	go etcd.DynamicServices(s.updateChannel)
-	// 发起服务注册
-	err := etcd.Register(s.stopChannel, s.address, s.updateChannel)
+// MarkUnhealthy 标记节点不健康，冷却期结束后自动恢复
+func (s *Server) MarkUnhealthy(peer PeerGetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if err != nil {
-		s.stopChannel <- err
-		log.Fatalf("%e\n", err)
-		return
+	log.Warnf("mark peer %s unhealthy for %v", peer.Addr(), s.cooldown)
+	s.unhealthy[peer.Addr()] = time.Now().Add(s.cooldown)
+}
+
+// Register 向 discoverer 注册本节点，直到服务器停止或注册失效才返回，需在 InitServer 之后调用
+func (s *Server) Register() error {
+	s.mu.Lock()
+	if s.ctx == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("server not initialized")
 	}
+	if s.draining {
+		s.mu.Unlock()
+		return nil
+	}
+	var ctx context.Context
+	ctx, s.registerCancel = context.WithCancel(s.ctx)
+	s.mu.Unlock()
+	if err := s.discoverer.Register(ctx, discovery.Node{Addr: s.address, Weight: s.weight}); err != nil {
+		return fmt.Errorf("register %s failed: %w", s.address, err)
+	}
+	return nil
 }
@@ -0,0 +1,242 @@
+package cache
+
+import (
+	pb "FishCache/api/groupcachepb"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 默认的迁移限速，单位为字节每秒
+const defaultHandoffRate = 8 << 20
+
+// 删除记录的保留时间。哈希环变化后删除请求发给新的归属节点，
+// 旧归属节点的迁移或新节点的拉取可能在删除之后才到达，期间拒绝这些key
+const tombstoneTTL = 5 * time.Minute
+
+// 最近在本节点删除的key及删除时间，零值可直接使用
+type tombstones struct {
+	mu    sync.Mutex
+	keys  map[string]time.Time
+	swept time.Time // 上次清理过期记录的时间
+}
+
+// 记录key被删除，并顺带清理过期的记录
+func (t *tombstones) add(key string) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.keys == nil {
+		t.keys = make(map[string]time.Time)
+	}
+	t.keys[key] = now
+	if now.Sub(t.swept) < tombstoneTTL {
+		return
+	}
+	for k, at := range t.keys {
+		if now.Sub(at) > tombstoneTTL {
+			delete(t.keys, k)
+		}
+	}
+	t.swept = now
+}
+
+// 返回key在保留时间内是否被删除过
+func (t *tombstones) contains(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	at, ok := t.keys[key]
+	return ok && time.Since(at) <= tombstoneTTL
+}
+
+// 一条待迁移的缓存
+type handoffEntry struct {
+	group *Group
+	key   string
+	value ByteView
+}
+
+func (e handoffEntry) toProto() *pb.HandoffEntry {
+	return &pb.HandoffEntry{
+		Group:    e.group.name,
+		Key:      e.key,
+		Value:    e.value.b,
+		ExpireAt: e.value.expireAtMillis(),
+	}
+}
+
+// 遍历所有 Group 的本地缓存，收集 owned 返回true的缓存
+func collectEntries(owned func(key string) bool) []handoffEntry {
+	var entries []handoffEntry
+	for _, group := range allGroups() {
+		group.cache.rangeEntries(func(key string, value ByteView) bool {
+			if owned(key) {
+				entries = append(entries, handoffEntry{group: group, key: key, value: value})
+			}
+			return true
+		})
+	}
+	return entries
+}
+
+// 保存迁移过来的一条缓存，返回是否保存
+func acceptEntry(entry *pb.HandoffEntry) bool {
+	group := GetGroup(entry.Group)
+	if group == nil {
+		return false
+	}
+	return group.acceptHandoff(entry.Key, ByteView{b: entry.Value, expireAt: expireAtFromMillis(entry.ExpireAt)})
+}
+
+// 节点变化后将本节点不再负责的缓存推送给新的归属节点，推送成功后从本地删除。
+// ctx 在下一次节点变化或服务器停止时取消。
+func (s *Server) handoff(ctx context.Context, locator NodeLocator, clients map[string]*grpcGetter) {
+	moved := make(map[string][]handoffEntry)
+	for _, entry := range collectEntries(func(key string) bool {
+		nodes := locator.GetNodes(key, s.replicas)
+		return len(nodes) > 0 && !slices.Contains(nodes, s.address)
+	}) {
+		owner := locator.GetNode(entry.key)
+		moved[owner] = append(moved[owner], entry)
+	}
+
+	for _, addr := range slices.Sorted(maps.Keys(moved)) {
+		client, ok := clients[addr]
+		if !ok {
+			continue
+		}
+		entries := moved[addr]
+		accepted, err := client.handoff(ctx, entries, s.handoffLimiter)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warnf("handoff %d keys to %s failed: %v", len(entries), addr, err)
+			}
+			continue
+		}
+		for _, entry := range entries {
+			entry.group.cache.remove(entry.key)
+			entry.group.notify(entry.key, pb.InvalidationKind_INVALIDATION_DELETE)
+		}
+		log.Infof("handoff %d keys to %s, %d accepted", len(entries), addr, accepted)
+	}
+}
+
+// 新加入集群时从其他节点拉取归属于本节点的缓存
+func (s *Server) pullFromPeers(ctx context.Context) {
+	s.mu.RLock()
+	clients := maps.Clone(s.clients)
+	req := &pb.PullRequest{Node: s.address}
+	for addr, weight := range s.nodes {
+		req.Nodes = append(req.Nodes, &pb.Node{Addr: addr, Weight: int64(weight)})
+	}
+	s.mu.RUnlock()
+
+	for addr, client := range clients {
+		go func(addr string, client *grpcGetter) {
+			received, accepted, err := client.pull(ctx, req)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Warnf("pull keys from %s failed: %v", addr, err)
+				}
+				return
+			}
+			if received > 0 {
+				log.Infof("pull %d keys from %s, %d accepted", received, addr, accepted)
+			}
+		}(addr, client)
+	}
+}
+
+// Handoff 作为server接收其他节点推送的缓存，本地已有的key保留本地的值
+func (s *Server) Handoff(stream pb.CacheService_HandoffServer) error {
+	var accepted int64
+	for {
+		entry, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&pb.HandoffResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+		if acceptEntry(entry) {
+			accepted++
+		}
+	}
+}
+
+// Pull 作为server按请求方看到的节点视图，返回请求方负责的缓存，发送速率受迁移限速控制
+func (s *Server) Pull(req *pb.PullRequest, stream pb.CacheService_PullServer) error {
+	if s.handoffLimiter == nil {
+		return nil
+	}
+	weights := make(map[string]int, len(req.Nodes))
+	for _, node := range req.Nodes {
+		weights[node.Addr] = int(node.Weight)
+	}
+	locator, err := NewNodeLocator(s.placement)
+	if err != nil {
+		return err
+	}
+	locator.SetNodes(weights)
+
+	for _, entry := range collectEntries(func(key string) bool {
+		return slices.Contains(locator.GetNodes(key, s.replicas), req.Node)
+	}) {
+		if err = s.handoffLimiter.wait(stream.Context(), len(entry.key)+entry.value.Len()); err != nil {
+			return err
+		}
+		if err = stream.Send(entry.toProto()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 以流的方式将缓存推送给远程节点，返回对方实际保存的数量
+func (g *grpcGetter) handoff(ctx context.Context, entries []handoffEntry, limiter *rateLimiter) (int64, error) {
+	stream, err := g.client.Handoff(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("open handoff stream to %s: %w", g.addr, err)
+	}
+	for _, entry := range entries {
+		if err = limiter.wait(ctx, len(entry.key)+entry.value.Len()); err != nil {
+			return 0, err
+		}
+		if err = stream.Send(entry.toProto()); err != nil {
+			return 0, fmt.Errorf("send handoff entry to %s: %w", g.addr, err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return 0, fmt.Errorf("close handoff stream to %s: %w", g.addr, err)
+	}
+	return resp.Accepted, nil
+}
+
+// 从远程节点拉取缓存并保存到本地，返回收到和实际保存的数量
+func (g *grpcGetter) pull(ctx context.Context, req *pb.PullRequest) (received int, accepted int, err error) {
+	stream, err := g.client.Pull(ctx, req)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open pull stream to %s: %w", g.addr, err)
+	}
+	for {
+		entry, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return received, accepted, nil
+		}
+		if err != nil {
+			return received, accepted, fmt.Errorf("receive pull entry from %s: %w", g.addr, err)
+		}
+		received++
+		if acceptEntry(entry) {
+			accepted++
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	pb "FishCache/api/groupcachepb"
+	"FishCache/internal/discovery/static"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// 在本地随机端口上启动 Server，返回连接该 Server 的客户端
+func startTestServer(t *testing.T) (*Server, *grpcGetter) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewRPCServer(lis.Addr().String(), static.New(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := s.setupGRPCServer()
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	client, err := newGrpcGetter(lis.Addr().String(), time.Second, s.keepalive, s.clientCredentials())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.close() })
+	return s, client
+}
+
+func TestServer_handoffAndPull(t *testing.T) {
+	mygrp := NewGroup("handoffGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	s, client := startTestServer(t)
+	ctx := context.Background()
+
+	// 推送的key保存到本地，本地已有、已过期或刚被删除的key被忽略
+	mygrp.cache.add("existing", ByteView{b: []byte("local")})
+	if err := mygrp.Remove("deleted"); err != nil {
+		t.Fatal(err)
+	}
+	entries := []handoffEntry{
+		{group: mygrp, key: "pushed", value: ByteView{b: []byte("remote")}},
+		{group: mygrp, key: "existing", value: ByteView{b: []byte("remote")}},
+		{group: mygrp, key: "expired", value: ByteView{b: []byte("remote"), expireAt: time.Now().Add(-time.Second)}},
+		{group: mygrp, key: "deleted", value: ByteView{b: []byte("remote")}},
+	}
+	accepted, err := client.handoff(ctx, entries, newRateLimiter(1<<20, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted != 1 {
+		t.Fatalf("accepted = %d, want 1", accepted)
+	}
+	if v, ok := mygrp.cache.get("pushed"); !ok || v.String() != "remote" {
+		t.Fatalf("pushed key = %q, %v", v.String(), ok)
+	}
+	if v, _ := mygrp.cache.get("existing"); v.String() != "local" {
+		t.Fatalf("existing key overwritten with %q", v.String())
+	}
+	if _, ok := mygrp.cache.get("deleted"); ok {
+		t.Fatal("deleted key restored by handoff")
+	}
+
+	// 拉取时只返回请求方负责的key
+	nodes := map[string]int{s.address: 10, "joining:1": 10}
+	locator, err := NewNodeLocator(s.placement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locator.SetNodes(nodes)
+	// 其他测试的 Group 也在本进程中，按所有 Group 的本地缓存计算期望值
+	want := len(collectEntries(func(key string) bool { return locator.GetNode(key) == "joining:1" }))
+	req := &pb.PullRequest{Node: "joining:1"}
+	for addr, weight := range nodes {
+		req.Nodes = append(req.Nodes, &pb.Node{Addr: addr, Weight: int64(weight)})
+	}
+	received, _, err := client.pull(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received != want {
+		t.Fatalf("received = %d, want %d", received, want)
+	}
+}
+
+func TestRateLimiter_wait(t *testing.T) {
+	l := newRateLimiter(1000, 100)
+	ctx := context.Background()
+	start := time.Now()
+	// 前100个令牌来自初始的burst，之后的100个需要等待约100ms
+	for i := 0; i < 20; i++ {
+		if err := l.wait(ctx, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("elapsed = %v, want >= 80ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.wait(ctx, 1000); err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HTTP网关中key的路由
+	httpKeyPath = "/v1/groups/{group}/keys/{key...}"
+	// PUT 请求体的最大字节数
+	maxHTTPBodyBytes = 32 << 20
+
+	contentTypeJSON  = "application/json"
+	contentTypeBytes = "application/octet-stream"
+)
+
+// HTTP网关的JSON格式，value 按 base64 编码
+type httpEntry struct {
+	Group    string `json:"group,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Value    []byte `json:"value"`
+	ExpireAt int64  `json:"expire_at,omitempty"` // 过期时间（unix毫秒），0表示永不过期
+	TTL      string `json:"ttl,omitempty"`       // 写入时的过期时长，如 "30s"，优先于 expire_at
+}
+
+// HTTPHandler 返回HTTP网关，与gRPC的 CacheService 使用相同的 Group 方法：
+//
+//	GET    /v1/groups/{group}/keys/{key}  读取，Accept 为 application/json 时返回JSON，否则返回原始字节
+//	PUT    /v1/groups/{group}/keys/{key}  写入，Content-Type 为 application/json 时解析JSON，否则请求体即value；
+//	                                      原始字节的过期时长由 ?ttl=30s 指定
+//	DELETE /v1/groups/{group}/keys/{key}  删除
+//
+// 读取时根据value设置 ETag，并根据剩余的TTL设置 Cache-Control，If-None-Match 匹配时返回304。
+func (s *Server) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+httpKeyPath, s.httpGet)
+	mux.HandleFunc("PUT "+httpKeyPath, s.httpPut)
+	mux.HandleFunc("DELETE "+httpKeyPath, s.httpDelete)
+	return mux
+}
+
+func (s *Server) httpGet(w http.ResponseWriter, r *http.Request) {
+	group, key, ok := httpGroup(w, r)
+	if !ok {
+		return
+	}
+	view, err := group.GetContext(r.Context(), key)
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+
+	etag := httpETag(view)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", httpCacheControl(view))
+	w.Header().Set("Vary", "Accept")
+	if ifNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if acceptsJSON(r) {
+		writeJSON(w, http.StatusOK, httpEntry{
+			Group:    group.name,
+			Key:      key,
+			Value:    view.b,
+			ExpireAt: view.expireAtMillis(),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeBytes)
+	w.Header().Set("Content-Length", strconv.Itoa(view.Len()))
+	_, _ = w.Write(view.b)
+}
+
+func (s *Server) httpPut(w http.ResponseWriter, r *http.Request) {
+	group, key, ok := httpGroup(w, r)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeHTTPStatus(w, r, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		writeHTTPStatus(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	value := ByteView{b: body}
+	ttl := r.URL.Query().Get("ttl")
+	if isJSON(r.Header.Get("Content-Type")) {
+		var entry httpEntry
+		if err = json.Unmarshal(body, &entry); err != nil {
+			writeHTTPStatus(w, r, http.StatusBadRequest, fmt.Sprintf("invalid json: %v", err))
+			return
+		}
+		// 0 表示永不过期，其他值必须晚于当前时间，否则写入的值会立即过期
+		if entry.ExpireAt != 0 && entry.ExpireAt <= time.Now().UnixMilli() {
+			writeHTTPStatus(w, r, http.StatusBadRequest, fmt.Sprintf("expire_at %d is not in the future", entry.ExpireAt))
+			return
+		}
+		value = ByteView{b: entry.Value, expireAt: expireAtFromMillis(entry.ExpireAt)}
+		if entry.TTL != "" {
+			ttl = entry.TTL
+		}
+	}
+	if ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			writeHTTPStatus(w, r, http.StatusBadRequest, fmt.Sprintf("invalid ttl %q", ttl))
+			return
+		}
+		value.expireAt = time.Now().Add(d)
+	}
+
+	if err = group.set(r.Context(), key, value); err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", httpETag(value))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) httpDelete(w http.ResponseWriter, r *http.Request) {
+	group, key, ok := httpGroup(w, r)
+	if !ok {
+		return
+	}
+	if err := group.remove(r.Context(), key); err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 从路径中解析 Group 和key，Group 不存在时写入错误并返回false
+func httpGroup(w http.ResponseWriter, r *http.Request) (*Group, string, bool) {
+	name := r.PathValue("group")
+	group := GetGroup(name)
+	if group == nil {
+		writeHTTPError(w, r, fmt.Errorf("%w: %s", ErrGroupNotFound, name))
+		return nil, "", false
+	}
+	return group, r.PathValue("key"), true
+}
+
+// 根据value的内容计算强校验的 ETag
+func httpETag(v ByteView) string {
+	h := fnv.New64a()
+	_, _ = h.Write(v.b)
+	return fmt.Sprintf(`"%016x"`, h.Sum64())
+}
+
+// 有过期时间时允许缓存到过期为止，否则要求客户端每次通过 ETag 重新校验
+func httpCacheControl(v ByteView) string {
+	if v.expireAt.IsZero() {
+		return "no-cache"
+	}
+	remaining := time.Until(v.expireAt) / time.Second
+	return "max-age=" + strconv.FormatInt(int64(max(remaining, 0)), 10)
+}
+
+// If-None-Match 是否包含 etag
+func ifNoneMatch(r *http.Request, etag string) bool {
+	for _, field := range r.Header.Values("If-None-Match") {
+		for _, candidate := range strings.Split(field, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == contentTypeJSON
+}
+
+// Accept 中是否包含 application/json
+func acceptsJSON(r *http.Request) bool {
+	for _, field := range r.Header.Values("Accept") {
+		for _, candidate := range strings.Split(field, ",") {
+			if isJSON(strings.TrimSpace(candidate)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// 将缓存错误转换为HTTP状态码
+func writeHTTPError(w http.ResponseWriter, r *http.Request, err error) {
+	var peerErr *PeerError
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrGroupNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, ErrEmptyKey):
+		code = http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		code = http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrPeerUnavailable), errors.As(err, &peerErr):
+		code = http.StatusServiceUnavailable
+	}
+	writeHTTPStatus(w, r, code, err.Error())
+}
+
+// 按客户端接受的格式写入错误信息
+func writeHTTPStatus(w http.ResponseWriter, r *http.Request, code int, msg string) {
+	if acceptsJSON(r) || isJSON(r.Header.Get("Content-Type")) {
+		writeJSON(w, code, map[string]string{"error": msg})
+		return
+	}
+	http.Error(w, msg, code)
+}
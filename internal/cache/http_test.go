@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"FishCache/internal/discovery/static"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_httpGateway(t *testing.T) {
+	NewGroup("httpGroup", 2<<10, GetterWithTTLFunc(func(key string) (Item, error) {
+		if v, ok := db[key]; ok {
+			return Item{Value: []byte(v), TTL: time.Minute}, nil
+		}
+		return Item{}, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}))
+	s, err := NewRPCServer("127.0.0.1:0", static.New(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.HTTPHandler())
+	defer srv.Close()
+
+	do := func(method, path string, body string, header map[string]string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	readBody := func(resp *http.Response) string {
+		t.Helper()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	// 原始字节，ETag 和 Cache-Control 由value和TTL决定
+	resp := do("GET", "/v1/groups/httpGroup/keys/Tom", "", nil)
+	if resp.StatusCode != http.StatusOK || readBody(resp) != db["Tom"] {
+		t.Fatalf("GET Tom = %d", resp.StatusCode)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" || !strings.HasPrefix(resp.Header.Get("Cache-Control"), "max-age=") {
+		t.Errorf("headers = %v", resp.Header)
+	}
+	if resp = do("GET", "/v1/groups/httpGroup/keys/Tom", "", map[string]string{"If-None-Match": etag}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match = %d, want 304", resp.StatusCode)
+	}
+
+	// JSON
+	resp = do("GET", "/v1/groups/httpGroup/keys/Tom", "", map[string]string{"Accept": "application/json"})
+	var entry httpEntry
+	if err = json.NewDecoder(resp.Body).Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	if string(entry.Value) != db["Tom"] || entry.Key != "Tom" || entry.ExpireAt == 0 {
+		t.Errorf("json entry = %+v", entry)
+	}
+
+	// 错误映射
+	for path, code := range map[string]int{
+		"/v1/groups/httpGroup/keys/missing": http.StatusNotFound,
+		"/v1/groups/noGroup/keys/Tom":       http.StatusNotFound,
+		"/v1/groups/httpGroup/keys/":        http.StatusBadRequest,
+	} {
+		if resp = do("GET", path, "", nil); resp.StatusCode != code {
+			t.Errorf("GET %s = %d, want %d", path, resp.StatusCode, code)
+		}
+	}
+
+	// 写入原始字节和JSON
+	if resp = do("PUT", "/v1/groups/httpGroup/keys/a/b?ttl=1h", "raw", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT raw = %d", resp.StatusCode)
+	}
+	if resp = do("GET", "/v1/groups/httpGroup/keys/a/b", "", nil); readBody(resp) != "raw" || resp.Header.Get("Cache-Control") == "no-cache" {
+		t.Errorf("GET a/b = %q, %v", readBody(resp), resp.Header)
+	}
+	resp = do("PUT", "/v1/groups/httpGroup/keys/json", `{"value":"anNvbg=="}`, map[string]string{"Content-Type": "application/json"})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT json = %d", resp.StatusCode)
+	}
+	if resp = do("GET", "/v1/groups/httpGroup/keys/json", "", nil); readBody(resp) != "json" || resp.Header.Get("Cache-Control") != "no-cache" {
+		t.Errorf("GET json = %v", resp.Header)
+	}
+	if resp = do("PUT", "/v1/groups/httpGroup/keys/bad?ttl=soon", "raw", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("PUT bad ttl = %d, want 400", resp.StatusCode)
+	}
+	if resp = do("PUT", "/v1/groups/httpGroup/keys/bad", "{", map[string]string{"Content-Type": "application/json"}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("PUT bad json = %d, want 400", resp.StatusCode)
+	}
+	for _, expireAt := range []int64{time.Now().Add(-time.Minute).UnixMilli(), -1} {
+		body := fmt.Sprintf(`{"value":"anNvbg==","expire_at":%d}`, expireAt)
+		if resp = do("PUT", "/v1/groups/httpGroup/keys/past", body, map[string]string{"Content-Type": "application/json"}); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("PUT expire_at %d = %d, want 400", expireAt, resp.StatusCode)
+		}
+	}
+	body := fmt.Sprintf(`{"value":"anNvbg==","expire_at":%d}`, time.Now().Add(time.Minute).UnixMilli())
+	if resp = do("PUT", "/v1/groups/httpGroup/keys/future", body, map[string]string{"Content-Type": "application/json"}); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("PUT future expire_at = %d, want 204", resp.StatusCode)
+	}
+
+	// 删除
+	if resp = do("DELETE", "/v1/groups/httpGroup/keys/json", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", resp.StatusCode)
+	}
+	if resp = do("GET", "/v1/groups/httpGroup/keys/json", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET after DELETE = %d, want 404", resp.StatusCode)
+	}
+}
@@ -1,5 +1,10 @@
 package cache
 
+import (
+	"context"
+	"time"
+)
+
 // Getter 用于加载指定键的数据。
 type Getter interface {
 	Get(key string) ([]byte, error) // Get 方法接受一个字符串类型的键，并返回相应的数据和可能发生的错误
@@ -12,3 +17,51 @@ type GetterFunc func(key string) ([]byte, error) // GetterFunc 是一个函数
 func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key) // 调用 GetterFunc 类型的函数 f，并传入键，返回数据和错误
 }
+
+// Item 表示加载得到的源数据及其过期时长
+type Item struct {
+	Value []byte
+	TTL   time.Duration // 过期时长，<=0 表示永不过期
+}
+
+// GetterWithTTL 在加载数据的同时返回该键的过期时长。
+// Group 在 getter 实现了该接口时优先调用 GetWithTTL。
+type GetterWithTTL interface {
+	Getter
+	GetWithTTL(key string) (Item, error)
+}
+
+// GetterWithTTLFunc 类型通过一个函数实现了 GetterWithTTL 接口
+type GetterWithTTLFunc func(key string) (Item, error)
+
+// Get 实现了 Getter 接口，丢弃过期时长
+func (f GetterWithTTLFunc) Get(key string) ([]byte, error) {
+	item, err := f(key)
+	return item.Value, err
+}
+
+// GetWithTTL 实现了 GetterWithTTL 接口中的函数
+func (f GetterWithTTLFunc) GetWithTTL(key string) (Item, error) {
+	return f(key)
+}
+
+// GetterWithContext 在加载数据时接收调用方的 context，源站可据此响应超时和取消。
+// Group 在 getter 实现了该接口时优先调用 GetContext；只实现 Getter 的旧代码无需修改，但无法被中途取消。
+type GetterWithContext interface {
+	Getter
+	GetContext(ctx context.Context, key string) (Item, error)
+}
+
+// GetterWithContextFunc 类型通过一个函数实现了 GetterWithContext 接口
+type GetterWithContextFunc func(ctx context.Context, key string) (Item, error)
+
+// Get 实现了 Getter 接口，使用不会取消的 context 并丢弃过期时长
+func (f GetterWithContextFunc) Get(key string) ([]byte, error) {
+	item, err := f(context.Background(), key)
+	return item.Value, err
+}
+
+// GetContext 实现了 GetterWithContext 接口中的函数
+func (f GetterWithContextFunc) GetContext(ctx context.Context, key string) (Item, error) {
+	return f(ctx, key)
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	pb "FishCache/api/groupcachepb"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// 保留的失效事件数量，订阅方断开期间产生的事件超过该数量时无法续传
+	defaultInvalidationLogSize = 1 << 16
+	// 单次从日志中取出的最大事件数
+	invalidationBatch = 256
+)
+
+// 本进程中所有 Group 的失效事件
+var invalidations = newInvalidationLog(defaultInvalidationLogSize)
+
+// invalidationLog 按序号保存最近的失效事件，订阅方据此续传。首次订阅前不记录事件，避免无人订阅时的开销
+type invalidationLog struct {
+	active atomic.Bool
+	mu     sync.Mutex
+	epoch  uint64             // 进程启动时随机生成，重启后序号不可续传
+	seq    uint64             // 最新事件的序号
+	events []*pb.Invalidation // 环形缓冲区，序号为 seq 的事件位于 events[seq%len]
+	wake   chan struct{}      // 有新事件时关闭并替换，唤醒等待的订阅方
+}
+
+func newInvalidationLog(size int) *invalidationLog {
+	return &invalidationLog{
+		epoch:  rand.Uint64() | 1,
+		events: make([]*pb.Invalidation, size),
+		wake:   make(chan struct{}),
+	}
+}
+
+// 开始记录事件
+func (l *invalidationLog) activate() {
+	l.active.Store(true)
+}
+
+// 记录一条事件并唤醒订阅方
+func (l *invalidationLog) publish(group, key string, kind pb.InvalidationKind) {
+	if !l.active.Load() {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	l.events[l.seq%uint64(len(l.events))] = &pb.Invalidation{
+		Epoch: l.epoch,
+		Seq:   l.seq,
+		Kind:  kind,
+		Group: group,
+		Key:   key,
+	}
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// 返回纪元和最新序号
+func (l *invalidationLog) position() (epoch, seq uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.epoch, l.seq
+}
+
+// 返回序号在 after 之后的至多 limit 条事件、最新序号，以及有新事件时关闭的通道。
+// after 之后的事件已被覆盖或 after 超过最新序号时，ok 为false
+func (l *invalidationLog) since(after uint64, limit int) (events []*pb.Invalidation, latest uint64, ok bool, wake <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if after > l.seq || l.seq-after > uint64(len(l.events)) {
+		return nil, l.seq, false, l.wake
+	}
+	n := min(l.seq-after, uint64(limit))
+	for seq := after + 1; seq <= after+n; seq++ {
+		events = append(events, l.events[seq%uint64(len(l.events))])
+	}
+	return events, l.seq, true, l.wake
+}
+
+// 记录本 Group 中key的变化
+func (g *Group) notify(key string, kind pb.InvalidationKind) {
+	invalidations.publish(g.name, key, kind)
+}
+
+// Subscribe 推送本节点上缓存的显式写入、删除和淘汰，从 Getter 加载的缓存不产生事件。
+// 请求中的纪元与当前一致且序号仍在日志中时从该序号之后续传，否则先发送一条 RESET。
+// 只订阅部分 Group 时，其他 Group 的事件不发送，收到的序号可能不连续。
+func (s *Server) Subscribe(req *pb.SubscribeRequest, stream pb.CacheService_SubscribeServer) error {
+	invalidations.activate()
+	groups := make(map[string]bool, len(req.Groups))
+	for _, name := range req.Groups {
+		groups[name] = true
+	}
+
+	epoch, after := invalidations.position()
+	if req.Epoch == epoch {
+		after = req.FromSeq
+	} else if err := sendReset(stream, epoch, after); err != nil {
+		return err
+	}
+	for {
+		events, latest, ok, wake := invalidations.since(after, invalidationBatch)
+		if !ok {
+			// 订阅方落后太多，中间的事件已被覆盖
+			if err := sendReset(stream, epoch, latest); err != nil {
+				return err
+			}
+			after = latest
+			continue
+		}
+		for _, event := range events {
+			after = event.Seq
+			if len(groups) != 0 && !groups[event.Group] {
+				continue
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+		if len(events) != 0 {
+			continue
+		}
+		select {
+		case <-wake:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func sendReset(stream pb.CacheService_SubscribeServer, epoch, seq uint64) error {
+	return stream.Send(&pb.Invalidation{Epoch: epoch, Seq: seq, Kind: pb.InvalidationKind_INVALIDATION_RESET})
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	pb "FishCache/api/groupcachepb"
+	"context"
+	"testing"
+)
+
+func TestServer_subscribe(t *testing.T) {
+	mygrp := NewGroup("subscribeGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	other := NewGroup("subscribeOther", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	_, client := startTestServer(t)
+
+	subscribe := func(req *pb.SubscribeRequest) (pb.CacheService_SubscribeClient, context.CancelFunc) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		req.Groups = []string{mygrp.name}
+		stream, err := client.client.Subscribe(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stream, cancel
+	}
+	recv := func(stream pb.CacheService_SubscribeClient, kind pb.InvalidationKind, key string) *pb.Invalidation {
+		t.Helper()
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Kind != kind || event.Key != key {
+			t.Fatalf("received %v, want %v %q", event, kind, key)
+		}
+		return event
+	}
+
+	// 首次订阅先收到 RESET，其中包含纪元和当前序号
+	stream, cancel := subscribe(&pb.SubscribeRequest{})
+	reset := recv(stream, pb.InvalidationKind_INVALIDATION_RESET, "")
+
+	// 从 Getter 加载的缓存不产生事件，未订阅的 Group 的事件不发送
+	if _, err := mygrp.Get("loaded"); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Set("k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mygrp.Set("k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	set := recv(stream, pb.InvalidationKind_INVALIDATION_SET, "k")
+	if set.Epoch != reset.Epoch || set.Seq <= reset.Seq || set.Group != mygrp.name {
+		t.Fatalf("set event %v after reset %v", set, reset)
+	}
+	if err := mygrp.Remove("k"); err != nil {
+		t.Fatal(err)
+	}
+	del := recv(stream, pb.InvalidationKind_INVALIDATION_DELETE, "k")
+	cancel()
+
+	// 断开期间的事件在续传时补发
+	if err := mygrp.Set("k2", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	stream, cancel = subscribe(&pb.SubscribeRequest{Epoch: del.Epoch, FromSeq: del.Seq})
+	recv(stream, pb.InvalidationKind_INVALIDATION_SET, "k2")
+	cancel()
+
+	// 纪元不一致时无法续传
+	stream, cancel = subscribe(&pb.SubscribeRequest{Epoch: del.Epoch + 1, FromSeq: del.Seq})
+	recv(stream, pb.InvalidationKind_INVALIDATION_RESET, "")
+	cancel()
+}
+
+func TestInvalidationLog_since(t *testing.T) {
+	l := newInvalidationLog(4)
+	l.publish("g", "ignored", pb.InvalidationKind_INVALIDATION_SET)
+	if _, seq := l.position(); seq != 0 {
+		t.Fatalf("events recorded before activate, seq = %d", seq)
+	}
+	l.activate()
+	for i := 0; i < 10; i++ {
+		l.publish("g", "k", pb.InvalidationKind_INVALIDATION_SET)
+	}
+
+	// 只保留最近4条事件
+	if _, latest, ok, _ := l.since(5, 100); ok || latest != 10 {
+		t.Fatalf("since(5) = %d, %v, want overwritten", latest, ok)
+	}
+	events, _, ok, _ := l.since(6, 3)
+	if !ok || len(events) != 3 || events[0].Seq != 7 || events[2].Seq != 9 {
+		t.Fatalf("since(6) = %v, %v", events, ok)
+	}
+	if events, _, ok, wake := l.since(10, 100); !ok || len(events) != 0 {
+		t.Fatalf("since(10) = %v, %v", events, ok)
+	} else {
+		l.publish("g", "k", pb.InvalidationKind_INVALIDATION_DELETE)
+		<-wake
+	}
+	if _, _, ok, _ := l.since(12, 100); ok {
+		t.Fatal("since a future seq should not be ok")
+	}
+}
+
+func TestServer_invalidate(t *testing.T) {
+	mygrp := NewGroup("invalidateGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	_, client := startTestServer(t)
+	mygrp.cache.add("k", ByteView{b: []byte("v")})
+
+	if _, err := client.client.Invalidate(context.Background(), &pb.InvalidateRequest{Group: mygrp.name, Key: "k"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mygrp.cache.get("k"); ok {
+		t.Error("k should be invalidated")
+	}
+	if _, err := client.client.Invalidate(context.Background(), &pb.InvalidateRequest{Group: "missing", Key: "k"}); err == nil {
+		t.Error("invalidating an unknown group should fail")
+	}
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"slices"
+	"sync"
+)
+
+// JumpMap 使用 Jump Consistent Hash 将key映射到节点，不占用额外内存且分布非常均匀。
+// 节点按名称排序后编号，只有新增或删除编号最大的节点时才能保证最少的key移动，
+// 新增或删除排在前面的节点会使之后所有节点的编号变化，大部分key换到其他节点，因此只适用于节点固定的集群；
+// 权重通过让节点占用多个连续编号实现。
+type JumpMap struct {
+	mu      sync.RWMutex
+	buckets []string // 每个编号对应的节点
+	nodes   int      // 节点数
+}
+
+func NewJump() *JumpMap {
+	return &JumpMap{}
+}
+
+// SetNodes 按节点及其权重重建编号，权重会先除以所有权重的最大公约数，避免编号过多
+func (m *JumpMap) SetNodes(weights map[string]int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	divisor := 0
+	for _, weight := range weights {
+		divisor = gcd(divisor, max(weight, 1))
+	}
+	m.buckets = nil
+	m.nodes = len(weights)
+	for _, node := range sortedNodes(weights) {
+		for i := 0; i < max(weights[node], 1)/divisor; i++ {
+			m.buckets = append(m.buckets, node)
+		}
+	}
+}
+
+// GetNode 返回key归属的节点
+func (m *JumpMap) GetNode(key string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.buckets) == 0 {
+		return ""
+	}
+	return m.buckets[jumpHash(hash64(key), len(m.buckets))]
+}
+
+// GetNodes 从key对应的编号开始依次向后取 n 个不同的节点
+func (m *JumpMap) GetNodes(key string, n int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.buckets) == 0 {
+		return nil
+	}
+	return distinctFrom(m.buckets, jumpHash(hash64(key), len(m.buckets)), min(n, m.nodes))
+}
+
+// jumpHash 即 Lamping 和 Veach 提出的 Jump Consistent Hash 算法，返回 [0, buckets) 中的编号
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// 从 slots 的 start 下标开始循环向后取 n 个不同的节点，n 不能超过 slots 中的节点数，否则会遍历整个 slots
+func distinctFrom(slots []string, start int, n int) []string {
+	var nodes []string
+	for i := 0; i < len(slots) && len(nodes) < n; i++ {
+		node := slots[(start+i)%len(slots)]
+		if !slices.Contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
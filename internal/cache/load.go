@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"math"
+	"time"
+)
+
+// 默认的负载半衰期，节点的负载每经过一个半衰期减半
+const defaultLoadHalfLife = time.Second
+
+// 一个节点按时间衰减的负载
+type decayedLoad struct {
+	value    float64
+	updateAt time.Time
+}
+
+// loadTracker 记录每个节点最近被选中的次数，旧的选择按半衰期指数衰减，
+// 使负载反映的是近期的请求压力。非并发安全，由调用方加锁。
+type loadTracker struct {
+	halfLife time.Duration
+	loads    map[string]*decayedLoad
+}
+
+func newLoadTracker(halfLife time.Duration) *loadTracker {
+	return &loadTracker{
+		halfLife: halfLife,
+		loads:    make(map[string]*decayedLoad),
+	}
+}
+
+// 记录一次对节点的选择
+func (t *loadTracker) add(node string, now time.Time) {
+	l, ok := t.loads[node]
+	if !ok {
+		l = &decayedLoad{updateAt: now}
+		t.loads[node] = l
+	}
+	t.decay(l, now)
+	l.value++
+}
+
+// 返回节点当前的负载
+func (t *loadTracker) load(node string, now time.Time) float64 {
+	l, ok := t.loads[node]
+	if !ok {
+		return 0
+	}
+	t.decay(l, now)
+	return l.value
+}
+
+// 只保留 nodes 中节点的负载，已离开集群的节点不再计入总负载
+func (t *loadTracker) retain(nodes map[string]int) {
+	for node := range t.loads {
+		if _, ok := nodes[node]; !ok {
+			delete(t.loads, node)
+		}
+	}
+}
+
+func (t *loadTracker) decay(l *decayedLoad, now time.Time) {
+	if elapsed := now.Sub(l.updateAt); elapsed > 0 {
+		l.value *= math.Exp2(-float64(elapsed) / float64(t.halfLife))
+		l.updateAt = now
+	}
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// NodeLocator 根据key定位其归属的节点，不同实现对应不同的数据分布算法
+type NodeLocator interface {
+	// SetNodes 按节点及其权重重建定位器，节点负责的key数量应与权重成正比
+	SetNodes(weights map[string]int)
+	// GetNode 返回key归属的节点，没有节点时返回空字符串
+	GetNode(key string) string
+	// GetNodes 按优先顺序返回key的 n 个不同的节点，第一个与 GetNode 相同；节点不足 n 个时返回所有节点
+	GetNodes(key string, n int) []string
+}
+
+// 支持有界负载查找的节点定位器
+type boundedLocator interface {
+	GetNodeBounded(key string, epsilon float64, load func(node string) float64) string
+}
+
+var _ boundedLocator = (*ConsistentMap)(nil)
+
+// PlacementType 数据分布算法的名称
+type PlacementType string
+
+const (
+	PlacementRing       PlacementType = "ring"       // 带虚拟节点的一致性哈希环
+	PlacementRendezvous PlacementType = "rendezvous" // 最高随机权重哈希（HRW）
+	PlacementJump       PlacementType = "jump"       // Jump Consistent Hash
+	PlacementMaglev     PlacementType = "maglev"     // Maglev 查找表
+)
+
+var (
+	_ NodeLocator = (*ConsistentMap)(nil)
+	_ NodeLocator = (*RendezvousMap)(nil)
+	_ NodeLocator = (*JumpMap)(nil)
+	_ NodeLocator = (*MaglevMap)(nil)
+)
+
+// NewNodeLocator 根据算法名称创建节点定位器，名称为空时使用一致性哈希环
+func NewNodeLocator(kind PlacementType) (NodeLocator, error) {
+	switch kind {
+	case PlacementRing, "":
+		return NewConsistentHash(defaultRpcClientReplicas, nil), nil
+	case PlacementRendezvous:
+		return NewRendezvous(), nil
+	case PlacementJump:
+		return NewJump(), nil
+	case PlacementMaglev:
+		return NewMaglev(defaultMaglevTableSize), nil
+	default:
+		return nil, fmt.Errorf("unknown placement %q", kind)
+	}
+}
+
+// 按名称排序的节点列表，保证所有节点以相同的顺序构建定位器
+func sortedNodes(weights map[string]int) []string {
+	nodes := make([]string, 0, len(weights))
+	for node := range weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// 使用FNV-1a计算64位哈希值
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// 对哈希值再做一次混合，使相近的输入得到分布均匀的输出
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+)
+
+var placements = []PlacementType{PlacementRing, PlacementRendezvous, PlacementJump, PlacementMaglev}
+
+// 生成 n 个默认权重的节点
+func testNodes(n int) map[string]int {
+	weights := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		weights[fmt.Sprintf("10.0.0.%d:23333", i+1)] = 10
+	}
+	return weights
+}
+
+func newTestLocator(t testing.TB, kind PlacementType, weights map[string]int) NodeLocator {
+	locator, err := NewNodeLocator(kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locator.SetNodes(weights)
+	return locator
+}
+
+// 各节点负责的key数量的变异系数（标准差/平均值）
+func loadStddev(locator NodeLocator, weights map[string]int, keys int) float64 {
+	counts := make(map[string]int, len(weights))
+	for i := 0; i < keys; i++ {
+		counts[locator.GetNode("key"+strconv.Itoa(i))]++
+	}
+	mean := float64(keys) / float64(len(weights))
+	var variance float64
+	for node := range weights {
+		d := float64(counts[node]) - mean
+		variance += d * d
+	}
+	return math.Sqrt(variance/float64(len(weights))) / mean
+}
+
+// 节点变化前后归属节点发生变化的key比例
+func keyMovement(before, after NodeLocator, keys int) float64 {
+	moved := 0
+	for i := 0; i < keys; i++ {
+		key := "key" + strconv.Itoa(i)
+		if before.GetNode(key) != after.GetNode(key) {
+			moved++
+		}
+	}
+	return float64(moved) / float64(keys)
+}
+
+func TestNodeLocator_distribution(t *testing.T) {
+	const keys = 100000
+	for _, kind := range placements {
+		t.Run(string(kind), func(t *testing.T) {
+			for _, n := range []int{3, 4, 5} {
+				weights := testNodes(n)
+				locator := newTestLocator(t, kind, weights)
+				stddev := loadStddev(locator, weights, keys)
+
+				// 新增一个编号最大的节点，理想情况下移动 1/(n+1) 的key
+				added := testNodes(n + 1)
+				addMoved := keyMovement(locator, newTestLocator(t, kind, added), keys)
+				// 删除编号最大的节点，理想情况下移动 1/n 的key
+				removed := testNodes(n - 1)
+				removeMoved := keyMovement(locator, newTestLocator(t, kind, removed), keys)
+
+				t.Logf("nodes=%d stddev=%.4f add-moved=%.4f (ideal %.4f) remove-moved=%.4f (ideal %.4f)",
+					n, stddev, addMoved, 1/float64(n+1), removeMoved, 1/float64(n))
+				if stddev > 0.25 {
+					t.Errorf("nodes=%d 负载变异系数过大: %.4f", n, stddev)
+				}
+				if addMoved > 2/float64(n+1) || removeMoved > 2/float64(n) {
+					t.Errorf("nodes=%d 节点变化时移动的key过多: add %.4f, remove %.4f", n, addMoved, removeMoved)
+				}
+			}
+		})
+	}
+}
+
+// 新增或删除名称排在最前的节点，Jump Hash 的编号整体后移，只能用于节点固定的集群，不参与比较
+func TestNodeLocator_firstNodeChange(t *testing.T) {
+	const keys = 100000
+	for _, kind := range placements {
+		if kind == PlacementJump {
+			continue
+		}
+		t.Run(string(kind), func(t *testing.T) {
+			for _, n := range []int{3, 4, 5} {
+				weights := testNodes(n)
+				locator := newTestLocator(t, kind, weights)
+
+				added := testNodes(n)
+				added["10.0.0.0:23333"] = 10
+				addMoved := keyMovement(locator, newTestLocator(t, kind, added), keys)
+				removed := testNodes(n)
+				delete(removed, "10.0.0.1:23333")
+				removeMoved := keyMovement(locator, newTestLocator(t, kind, removed), keys)
+
+				t.Logf("nodes=%d add-moved=%.4f (ideal %.4f) remove-moved=%.4f (ideal %.4f)",
+					n, addMoved, 1/float64(n+1), removeMoved, 1/float64(n))
+				if addMoved > 2/float64(n+1) || removeMoved > 2/float64(n) {
+					t.Errorf("nodes=%d 节点变化时移动的key过多: add %.4f, remove %.4f", n, addMoved, removeMoved)
+				}
+			}
+		})
+	}
+}
+
+func TestNodeLocator_weighted(t *testing.T) {
+	weights := map[string]int{"small:23333": 10, "large:23333": 40}
+	for _, kind := range placements {
+		locator := newTestLocator(t, kind, weights)
+		counts := make(map[string]int)
+		for i := 0; i < 50000; i++ {
+			counts[locator.GetNode("key"+strconv.Itoa(i))]++
+		}
+		if ratio := float64(counts["large:23333"]) / float64(counts["small:23333"]); ratio < 2 || ratio > 8 {
+			t.Errorf("%s: 节点负责的key数量应与权重大致成正比，实际为 %v", kind, counts)
+		}
+	}
+}
+
+// Maglev 中权重不大于0的节点按权重1处理，与权重为1的节点负责的位置数相当
+func TestMaglev_nonPositiveWeight(t *testing.T) {
+	for _, weights := range []map[string]int{
+		{"zero:23333": 0, "negative:23333": -5, "one:23333": 1},
+		{"zero:23333": 0, "negative:23333": -5},
+	} {
+		m := NewMaglev(0)
+		m.SetNodes(weights)
+		counts := make(map[string]int)
+		for _, node := range m.table {
+			counts[node]++
+		}
+		want := int(m.size) / len(weights)
+		for node := range weights {
+			if counts[node] < want-1 || counts[node] > want+1 {
+				t.Errorf("%v: %s 占用 %d 个位置，应为 %d", weights, node, counts[node], want)
+			}
+		}
+	}
+}
+
+func TestNodeLocator_GetNodes(t *testing.T) {
+	weights := testNodes(5)
+	for _, kind := range placements {
+		locator := newTestLocator(t, kind, weights)
+		for i := 0; i < 1000; i++ {
+			key := "key" + strconv.Itoa(i)
+			nodes := locator.GetNodes(key, 3)
+			if len(nodes) != 3 || nodes[0] != locator.GetNode(key) {
+				t.Fatalf("%s: %s 的副本应为3个且第一个为归属节点，实际为 %v", kind, key, nodes)
+			}
+			if nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2] {
+				t.Fatalf("%s: %s 的副本节点重复: %v", kind, key, nodes)
+			}
+		}
+		if nodes := locator.GetNodes("key", 10); len(nodes) != len(weights) {
+			t.Errorf("%s: 节点不足时应返回所有节点，实际为 %v", kind, nodes)
+		}
+	}
+}
+
+func BenchmarkNodeLocator_GetNode(b *testing.B) {
+	for _, kind := range placements {
+		b.Run(string(kind), func(b *testing.B) {
+			locator := newTestLocator(b, kind, testNodes(5))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				locator.GetNode("key" + strconv.Itoa(i))
+			}
+		})
+	}
+}
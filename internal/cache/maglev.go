@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// 默认的 Maglev 查找表大小，需为质数且远大于节点数
+const defaultMaglevTableSize = 65537
+
+// MaglevMap 使用 Google Maglev 论文中的查找表：每个节点按自身的排列顺序轮流填充查找表，
+// 查找时只需一次取模。分布几乎完全均匀，增删节点时只有少量额外的key移动。
+type MaglevMap struct {
+	mu    sync.RWMutex
+	size  uint64   // 查找表大小
+	table []string // 查找表，下标为key哈希值对 size 取模
+	nodes int      // 节点数
+}
+
+// NewMaglev 创建查找表大小为 size 的 MaglevMap，size 应为质数
+func NewMaglev(size uint64) *MaglevMap {
+	if size == 0 {
+		size = defaultMaglevTableSize
+	}
+	return &MaglevMap{size: size}
+}
+
+// SetNodes 按节点及其权重重新填充查找表。每一轮中权重最大的节点都会填充一个位置，
+// 其他节点按权重比例累积额度，额度足够时才填充，使节点占用的位置数与权重成正比。
+func (m *MaglevMap) SetNodes(weights map[string]int) {
+	nodes := sortedNodes(weights)
+	table := make([]string, m.size)
+	if len(nodes) > 0 {
+		m.populate(nodes, weights, table)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.table = table
+	m.nodes = len(nodes)
+}
+
+func (m *MaglevMap) populate(nodes []string, weights map[string]int, table []string) {
+	offsets := make([]uint64, len(nodes))
+	skips := make([]uint64, len(nodes))
+	// 权重不大于0的节点按1处理，额度和最大权重都基于同一组权重计算
+	normalized := make([]int, len(nodes))
+	maxWeight := 1
+	for i, node := range nodes {
+		offsets[i] = hash64(node) % m.size
+		h := fnv.New64()
+		_, _ = h.Write([]byte(node))
+		skips[i] = h.Sum64()%(m.size-1) + 1
+		normalized[i] = max(weights[node], 1)
+		maxWeight = max(maxWeight, normalized[i])
+	}
+
+	next := make([]uint64, len(nodes)) // 每个节点排列中下一个尝试的位置
+	credits := make([]int, len(nodes)) // 每个节点累积的填充额度
+	var filled uint64
+	for filled < m.size {
+		for i, node := range nodes {
+			credits[i] += normalized[i]
+			if credits[i] < maxWeight {
+				continue
+			}
+			credits[i] -= maxWeight
+			// 沿排列找到第一个空位
+			slot := (offsets[i] + next[i]*skips[i]) % m.size
+			for table[slot] != "" {
+				next[i]++
+				slot = (offsets[i] + next[i]*skips[i]) % m.size
+			}
+			table[slot] = node
+			next[i]++
+			if filled++; filled == m.size {
+				return
+			}
+		}
+	}
+}
+
+// GetNode 返回key归属的节点
+func (m *MaglevMap) GetNode(key string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.table) == 0 {
+		return ""
+	}
+	return m.table[mix64(hash64(key))%m.size]
+}
+
+// GetNodes 从key对应的查找表位置开始依次向后取 n 个不同的节点
+func (m *MaglevMap) GetNodes(key string, n int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.table) == 0 {
+		return nil
+	}
+	return distinctFrom(m.table, int(mix64(hash64(key))%m.size), min(n, m.nodes))
+}
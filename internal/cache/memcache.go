@@ -0,0 +1,306 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// memcached协议前端，文本协议和二进制协议共用的部分
+
+const (
+	// key的最大字节数，与memcached一致
+	maxMemcacheKeyLen = 250
+	// value的最大字节数
+	maxMemcacheValueLen = 32 << 20
+	// 超过该秒数的过期时间按unix时间戳解析，与memcached一致
+	memcacheRelativeExpireLimit = 60 * 60 * 24 * 30
+	// 二进制协议请求的第一个字节
+	memcacheBinaryMagic = 0x80
+	// version 命令返回的版本
+	memcacheVersion = "1.6.0-fishcache"
+)
+
+var (
+	errMemcacheBadKey    = errors.New("bad key")
+	errMemcacheTooLarge  = errors.New("object too large for cache")
+	errMemcacheNoGroup   = errors.New("key has no group prefix and no default group is configured")
+	errMemcacheNonNumber = errors.New("cannot increment or decrement non-numeric value")
+)
+
+// 写入命令的语义
+type memcacheStoreMode int
+
+const (
+	memcacheSet     memcacheStoreMode = iota // 无条件写入
+	memcacheAdd                              // 仅在key不存在时写入
+	memcacheReplace                          // 仅在key存在时写入
+	memcacheCAS                              // 仅在key的cas与请求一致时写入
+)
+
+// 命令的执行结果，与协议无关
+type memcacheStatus int
+
+const (
+	memcacheOK        memcacheStatus = iota
+	memcacheNotStored                // add/replace 的条件不满足
+	memcacheExists                   // cas 不一致
+	memcacheNotFound
+)
+
+// memcached协议前端的状态，ServeMemcache 每次调用对应一个
+type memcacheServer struct {
+	s            *Server
+	defaultGroup string
+	start        time.Time
+	currConns    atomic.Int64
+	totalConns   atomic.Int64
+}
+
+// ServeMemcache 在 lis 上提供memcached协议前端，根据每个连接的第一个字节自动识别文本协议或二进制协议。
+// 支持 get、gets、set、add、replace、cas、delete、touch、incr、decr、stats、version 和 quit，
+// 与gRPC和HTTP网关使用相同的 Group 方法，key按 PickPeer 转发给归属节点。
+//
+// key形如 group:key 且 group 是已存在的 Group 时写入该 Group，否则整个key写入 defaultGroup；
+// defaultGroup 为空时key必须带有 Group 前缀。
+//
+// 与memcached的差异：
+//   - 不保存客户端的flags，读取时总是返回0
+//   - cas 值由value的内容计算，value不变时cas不变
+//   - add、replace、cas、touch、incr、decr 先读后写，节点间不是原子操作
+//   - 判断key是否存在时，未命中缓存的key会通过 Getter 加载
+//   - delete 不判断key是否存在，总是返回 DELETED
+//
+// ServeMemcache 阻塞直到 lis 被关闭。
+func (s *Server) ServeMemcache(lis net.Listener, defaultGroup string) error {
+	m := &memcacheServer{s: s, defaultGroup: defaultGroup, start: time.Now()}
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go m.serveConn(conn)
+	}
+}
+
+func (m *memcacheServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	m.currConns.Add(1)
+	m.totalConns.Add(1)
+	defer m.currConns.Add(-1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	first, err := r.Peek(1)
+	if err != nil {
+		return
+	}
+	if first[0] == memcacheBinaryMagic {
+		m.serveBinary(ctx, r, w)
+		return
+	}
+	m.serveText(ctx, r, w)
+}
+
+// 由客户端的key解析出 Group 和 Group 中的key
+func (m *memcacheServer) route(key string) (*Group, string, error) {
+	if key == "" || len(key) > maxMemcacheKeyLen {
+		return nil, "", errMemcacheBadKey
+	}
+	if name, rest, ok := strings.Cut(key, ":"); ok && rest != "" {
+		if g := GetGroup(name); g != nil {
+			return g, rest, nil
+		}
+	}
+	if m.defaultGroup == "" {
+		return nil, "", errMemcacheNoGroup
+	}
+	g := GetGroup(m.defaultGroup)
+	if g == nil {
+		return nil, "", ErrGroupNotFound
+	}
+	return g, key, nil
+}
+
+// 读取key，数据源中不存在时返回false
+func (m *memcacheServer) get(ctx context.Context, key string) (ByteView, bool, error) {
+	g, k, err := m.route(key)
+	if err != nil {
+		return ByteView{}, false, err
+	}
+	view, err := g.GetContext(ctx, k)
+	if errors.Is(err, ErrNotFound) {
+		return ByteView{}, false, nil
+	}
+	return view, err == nil, err
+}
+
+// 批量读取，key按 Group 分组后各自批量获取
+func (m *memcacheServer) getMany(ctx context.Context, keys []string) map[string]GetResult {
+	results := make(map[string]GetResult, len(keys))
+	type groupKeys struct {
+		group *Group
+		keys  []string // Group 中的key
+		orig  []string // 客户端的key
+	}
+	byGroup := make(map[string]*groupKeys)
+	for _, key := range keys {
+		g, k, err := m.route(key)
+		if err != nil {
+			results[key] = GetResult{Err: err}
+			continue
+		}
+		gk := byGroup[g.name]
+		if gk == nil {
+			gk = &groupKeys{group: g}
+			byGroup[g.name] = gk
+		}
+		gk.keys = append(gk.keys, k)
+		gk.orig = append(gk.orig, key)
+	}
+	for _, gk := range byGroup {
+		groupResults := gk.group.GetManyContext(ctx, gk.keys)
+		for i, k := range gk.keys {
+			results[gk.orig[i]] = groupResults[k]
+		}
+	}
+	return results
+}
+
+// 按 mode 写入key，exptime 为memcached格式的过期时间
+func (m *memcacheServer) store(ctx context.Context, mode memcacheStoreMode, key string, value []byte, exptime int64, cas uint64) (memcacheStatus, error) {
+	if len(value) > maxMemcacheValueLen {
+		return 0, errMemcacheTooLarge
+	}
+	g, k, err := m.route(key)
+	if err != nil {
+		return 0, err
+	}
+	if mode != memcacheSet {
+		current, ok, err := m.get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case mode == memcacheAdd && ok:
+			return memcacheNotStored, nil
+		case mode == memcacheReplace && !ok:
+			return memcacheNotStored, nil
+		case mode == memcacheCAS && !ok:
+			return memcacheNotFound, nil
+		case mode == memcacheCAS && memcacheCASValue(current) != cas:
+			return memcacheExists, nil
+		}
+	}
+	expireAt, expired := memcacheExpireAt(exptime)
+	if expired {
+		return memcacheOK, g.remove(ctx, k)
+	}
+	return memcacheOK, g.set(ctx, k, ByteView{b: value, expireAt: expireAt})
+}
+
+func (m *memcacheServer) delete(ctx context.Context, key string) error {
+	g, k, err := m.route(key)
+	if err != nil {
+		return err
+	}
+	return g.remove(ctx, k)
+}
+
+// 修改key的过期时间
+func (m *memcacheServer) touch(ctx context.Context, key string, exptime int64) (ByteView, memcacheStatus, error) {
+	current, ok, err := m.get(ctx, key)
+	if err != nil || !ok {
+		return ByteView{}, memcacheNotFound, err
+	}
+	_, err = m.store(ctx, memcacheSet, key, current.b, exptime, 0)
+	return current, memcacheOK, err
+}
+
+// 将key的十进制数值加上或减去 delta，保留原有的过期时间。与memcached一致，incr 在2^64处回绕，decr 最小为0
+func (m *memcacheServer) incr(ctx context.Context, key string, delta uint64, decr bool) (uint64, memcacheStatus, error) {
+	current, ok, err := m.get(ctx, key)
+	if err != nil || !ok {
+		return 0, memcacheNotFound, err
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(current.String()), 10, 64)
+	if err != nil {
+		return 0, 0, errMemcacheNonNumber
+	}
+	switch {
+	case !decr:
+		n += delta
+	case delta > n:
+		n = 0
+	default:
+		n -= delta
+	}
+	g, k, _ := m.route(key)
+	value := ByteView{b: strconv.AppendUint(nil, n, 10), expireAt: current.expireAt}
+	return n, memcacheOK, g.set(ctx, k, value)
+}
+
+// stats 命令返回的统计，按名称排序输出
+func (m *memcacheServer) stats() [][2]string {
+	var items, bytes, hits, misses, evictions int64
+	for _, g := range allGroups() {
+		stats := g.cache.stats()
+		items += stats.Items
+		bytes += stats.Bytes
+		evictions += stats.Evictions
+		hits += g.Stats.Hits.Load() + g.Stats.HotHits.Load()
+		misses += g.Stats.Misses.Load()
+	}
+	itoa := func(n int64) string { return strconv.FormatInt(n, 10) }
+	return [][2]string{
+		{"uptime", itoa(int64(time.Since(m.start) / time.Second))},
+		{"time", itoa(time.Now().Unix())},
+		{"version", memcacheVersion},
+		{"curr_connections", itoa(m.currConns.Load())},
+		{"total_connections", itoa(m.totalConns.Load())},
+		{"curr_items", itoa(items)},
+		{"bytes", itoa(bytes)},
+		{"get_hits", itoa(hits)},
+		{"get_misses", itoa(misses)},
+		{"evictions", itoa(evictions)},
+	}
+}
+
+// 将memcached格式的过期时间转换为绝对时间：0表示永不过期，超过30天时为unix时间戳，否则为相对秒数。
+// 负数或已经过去的时间戳表示立即过期
+func memcacheExpireAt(exptime int64) (time.Time, bool) {
+	switch {
+	case exptime == 0:
+		return time.Time{}, false
+	case exptime < 0:
+		return time.Time{}, true
+	case exptime > memcacheRelativeExpireLimit:
+		t := time.Unix(exptime, 0)
+		return t, !t.After(time.Now())
+	default:
+		return time.Now().Add(time.Duration(exptime) * time.Second), false
+	}
+}
+
+// 根据value的内容计算 gets 返回的cas值，0保留给“不校验”
+func memcacheCASValue(v ByteView) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(v.b)
+	return max(h.Sum64(), 1)
+}
@@ -0,0 +1,292 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// memcached二进制协议，每个请求和响应由24字节的头部、extras、key和value组成
+
+const (
+	memcacheBinaryHeaderLen = 24
+	memcacheBinaryResponse  = 0x81
+	// incr/decr 的过期时间为该值时，key不存在不会以初始值创建
+	memcacheNoAutoCreate = 0xffffffff
+)
+
+// 二进制协议的操作码
+const (
+	mcOpGet      = 0x00
+	mcOpSet      = 0x01
+	mcOpAdd      = 0x02
+	mcOpReplace  = 0x03
+	mcOpDelete   = 0x04
+	mcOpIncr     = 0x05
+	mcOpDecr     = 0x06
+	mcOpQuit     = 0x07
+	mcOpGetQ     = 0x09
+	mcOpNoop     = 0x0a
+	mcOpVersion  = 0x0b
+	mcOpGetK     = 0x0c
+	mcOpGetKQ    = 0x0d
+	mcOpStat     = 0x10
+	mcOpSetQ     = 0x11
+	mcOpAddQ     = 0x12
+	mcOpReplaceQ = 0x13
+	mcOpDeleteQ  = 0x14
+	mcOpIncrQ    = 0x15
+	mcOpDecrQ    = 0x16
+	mcOpQuitQ    = 0x17
+	mcOpTouch    = 0x1c
+)
+
+// 二进制协议的响应状态
+const (
+	mcStatusOK          = 0x00
+	mcStatusNotFound    = 0x01
+	mcStatusExists      = 0x02
+	mcStatusTooLarge    = 0x03
+	mcStatusInvalidArgs = 0x04
+	mcStatusNotStored   = 0x05
+	mcStatusNonNumeric  = 0x06
+	mcStatusUnknownCmd  = 0x81
+	mcStatusInternal    = 0x84
+	mcStatusTempFailure = 0x86
+)
+
+// 二进制协议的请求
+type memcacheRequest struct {
+	opcode byte
+	opaque uint32
+	cas    uint64
+	extras []byte
+	key    string
+	value  []byte
+}
+
+// 二进制协议的响应
+type memcacheResponse struct {
+	status uint16
+	cas    uint64
+	extras []byte
+	key    string
+	value  []byte
+}
+
+func (m *memcacheServer) serveBinary(ctx context.Context, r *bufio.Reader, w *bufio.Writer) {
+	for {
+		req, err := readMemcacheRequest(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Debugf("memcache binary connection closed: %v", err)
+			}
+			_ = w.Flush()
+			return
+		}
+		quit := m.binaryCommand(ctx, req, w)
+		// 流水线中的命令全部处理后再一次性写出
+		if r.Buffered() == 0 || quit {
+			if w.Flush() != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+func readMemcacheRequest(r *bufio.Reader) (*memcacheRequest, error) {
+	var header [memcacheBinaryHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != memcacheBinaryMagic {
+		return nil, errors.New("invalid magic")
+	}
+	keyLen := int(binary.BigEndian.Uint16(header[2:]))
+	extrasLen := int(header[4])
+	bodyLen := int(binary.BigEndian.Uint32(header[8:]))
+	if bodyLen < keyLen+extrasLen || bodyLen > maxMemcacheValueLen+maxMemcacheKeyLen+64 {
+		return nil, errors.New("invalid body length")
+	}
+	body := make([]byte, bodyLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &memcacheRequest{
+		opcode: header[1],
+		opaque: binary.BigEndian.Uint32(header[12:]),
+		cas:    binary.BigEndian.Uint64(header[16:]),
+		extras: body[:extrasLen],
+		key:    string(body[extrasLen : extrasLen+keyLen]),
+		value:  body[extrasLen+keyLen:],
+	}, nil
+}
+
+func writeMemcacheResponse(w *bufio.Writer, req *memcacheRequest, resp memcacheResponse) {
+	var header [memcacheBinaryHeaderLen]byte
+	header[0] = memcacheBinaryResponse
+	header[1] = req.opcode
+	binary.BigEndian.PutUint16(header[2:], uint16(len(resp.key)))
+	header[4] = byte(len(resp.extras))
+	binary.BigEndian.PutUint16(header[6:], resp.status)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(resp.extras)+len(resp.key)+len(resp.value)))
+	binary.BigEndian.PutUint32(header[12:], req.opaque)
+	binary.BigEndian.PutUint64(header[16:], resp.cas)
+	w.Write(header[:])
+	w.Write(resp.extras)
+	w.WriteString(resp.key)
+	w.Write(resp.value)
+}
+
+// 处理一个请求，返回是否关闭连接。安静模式（...Q）的请求只在出错时响应，GetQ/GetKQ 未命中时不响应
+func (m *memcacheServer) binaryCommand(ctx context.Context, req *memcacheRequest, w *bufio.Writer) bool {
+	quiet := false
+	reply := func(resp memcacheResponse) {
+		if !quiet || resp.status != mcStatusOK {
+			writeMemcacheResponse(w, req, resp)
+		}
+	}
+
+	switch req.opcode {
+	case mcOpGet, mcOpGetQ, mcOpGetK, mcOpGetKQ:
+		view, ok, err := m.get(ctx, req.key)
+		switch {
+		case err != nil:
+			reply(memcacheBinaryError(err))
+		case !ok:
+			if req.opcode == mcOpGet || req.opcode == mcOpGetK {
+				reply(memcacheResponse{status: mcStatusNotFound, value: []byte("Not found")})
+			}
+		default:
+			resp := memcacheResponse{cas: memcacheCASValue(view), extras: make([]byte, 4), value: view.b}
+			if req.opcode == mcOpGetK || req.opcode == mcOpGetKQ {
+				resp.key = req.key
+			}
+			reply(resp)
+		}
+	case mcOpSet, mcOpSetQ, mcOpAdd, mcOpAddQ, mcOpReplace, mcOpReplaceQ:
+		quiet = req.opcode == mcOpSetQ || req.opcode == mcOpAddQ || req.opcode == mcOpReplaceQ
+		if len(req.extras) != 8 {
+			reply(memcacheResponse{status: mcStatusInvalidArgs, value: []byte("Invalid arguments")})
+			break
+		}
+		mode := memcacheSet
+		switch {
+		case req.opcode == mcOpAdd || req.opcode == mcOpAddQ:
+			mode = memcacheAdd
+		case req.cas != 0:
+			mode = memcacheCAS
+		case req.opcode == mcOpReplace || req.opcode == mcOpReplaceQ:
+			mode = memcacheReplace
+		}
+		exptime := int64(binary.BigEndian.Uint32(req.extras[4:]))
+		status, err := m.store(ctx, mode, req.key, req.value, exptime, req.cas)
+		reply(memcacheStoreResponse(status, err, req.value))
+	case mcOpDelete, mcOpDeleteQ:
+		quiet = req.opcode == mcOpDeleteQ
+		if err := m.delete(ctx, req.key); err != nil {
+			reply(memcacheBinaryError(err))
+			break
+		}
+		reply(memcacheResponse{})
+	case mcOpIncr, mcOpIncrQ, mcOpDecr, mcOpDecrQ:
+		quiet = req.opcode == mcOpIncrQ || req.opcode == mcOpDecrQ
+		reply(m.binaryIncr(ctx, req))
+	case mcOpTouch:
+		if len(req.extras) != 4 {
+			reply(memcacheResponse{status: mcStatusInvalidArgs, value: []byte("Invalid arguments")})
+			break
+		}
+		view, status, err := m.touch(ctx, req.key, int64(binary.BigEndian.Uint32(req.extras)))
+		switch {
+		case err != nil:
+			reply(memcacheBinaryError(err))
+		case status == memcacheNotFound:
+			reply(memcacheResponse{status: mcStatusNotFound, value: []byte("Not found")})
+		default:
+			reply(memcacheResponse{cas: memcacheCASValue(view)})
+		}
+	case mcOpStat:
+		if req.key != "" {
+			reply(memcacheResponse{status: mcStatusNotFound, value: []byte("Not found")})
+			break
+		}
+		for _, stat := range m.stats() {
+			reply(memcacheResponse{key: stat[0], value: []byte(stat[1])})
+		}
+		reply(memcacheResponse{})
+	case mcOpNoop:
+		reply(memcacheResponse{})
+	case mcOpVersion:
+		reply(memcacheResponse{value: []byte(memcacheVersion)})
+	case mcOpQuit:
+		reply(memcacheResponse{})
+		return true
+	case mcOpQuitQ:
+		return true
+	default:
+		reply(memcacheResponse{status: mcStatusUnknownCmd, value: []byte("Unknown command")})
+	}
+	return false
+}
+
+// incr/decr 的extras依次为8字节的delta、8字节的初始值和4字节的过期时间，key不存在时以初始值创建
+func (m *memcacheServer) binaryIncr(ctx context.Context, req *memcacheRequest) memcacheResponse {
+	if len(req.extras) != 20 {
+		return memcacheResponse{status: mcStatusInvalidArgs, value: []byte("Invalid arguments")}
+	}
+	delta := binary.BigEndian.Uint64(req.extras)
+	initial := binary.BigEndian.Uint64(req.extras[8:])
+	exptime := binary.BigEndian.Uint32(req.extras[16:])
+
+	n, status, err := m.incr(ctx, req.key, delta, req.opcode == mcOpDecr || req.opcode == mcOpDecrQ)
+	if err == nil && status == memcacheNotFound {
+		if exptime == memcacheNoAutoCreate {
+			return memcacheResponse{status: mcStatusNotFound, value: []byte("Not found")}
+		}
+		n = initial
+		_, err = m.store(ctx, memcacheSet, req.key, strconv.AppendUint(nil, n, 10), int64(exptime), 0)
+	}
+	if err != nil {
+		return memcacheBinaryError(err)
+	}
+	value := binary.BigEndian.AppendUint64(nil, n)
+	return memcacheResponse{cas: memcacheCASValue(ByteView{b: strconv.AppendUint(nil, n, 10)}), value: value}
+}
+
+func memcacheStoreResponse(status memcacheStatus, err error, value []byte) memcacheResponse {
+	switch {
+	case err != nil:
+		return memcacheBinaryError(err)
+	case status == memcacheNotStored:
+		return memcacheResponse{status: mcStatusNotStored, value: []byte("Not stored")}
+	case status == memcacheExists:
+		return memcacheResponse{status: mcStatusExists, value: []byte("Data exists for key")}
+	case status == memcacheNotFound:
+		return memcacheResponse{status: mcStatusNotFound, value: []byte("Not found")}
+	default:
+		return memcacheResponse{cas: memcacheCASValue(ByteView{b: value})}
+	}
+}
+
+// 将错误转换为二进制协议的响应状态，value为错误信息
+func memcacheBinaryError(err error) memcacheResponse {
+	var peerErr *PeerError
+	status := uint16(mcStatusInternal)
+	switch {
+	case errors.Is(err, errMemcacheBadKey), errors.Is(err, errMemcacheNoGroup):
+		status = mcStatusInvalidArgs
+	case errors.Is(err, errMemcacheTooLarge):
+		status = mcStatusTooLarge
+	case errors.Is(err, errMemcacheNonNumber):
+		status = mcStatusNonNumeric
+	case errors.Is(err, ErrPeerUnavailable), errors.As(err, &peerErr):
+		status = mcStatusTempFailure
+	}
+	return memcacheResponse{status: status, value: []byte(err.Error())}
+}
@@ -0,0 +1,232 @@
+package cache
+
+import (
+	"FishCache/internal/discovery/static"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startMemcache(t *testing.T, defaultGroup string) net.Conn {
+	t.Helper()
+	s, err := NewRPCServer("127.0.0.1:0", static.New(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeMemcache(lis, defaultGroup)
+	t.Cleanup(func() { lis.Close() })
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestServer_serveMemcacheText(t *testing.T) {
+	NewGroup("mcGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}))
+	NewGroup("mcOther", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}))
+	conn := startMemcache(t, "mcGroup")
+	r := bufio.NewReader(conn)
+	do := func(cmd, want string) {
+		t.Helper()
+		if _, err := conn.Write([]byte(cmd)); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatalf("%q: read reply: %v", cmd, err)
+		}
+		if string(got) != want {
+			t.Fatalf("%q = %q, want %q", cmd, got, want)
+		}
+	}
+
+	// 未命中缓存时通过 Getter 加载，数据源中不存在的key不返回
+	do("get Tom missing\r\n", "VALUE Tom 0 3\r\n630\r\nEND\r\n")
+	do("set k 5 0 2\r\nv1\r\n", "STORED\r\n")
+	do("add k 0 0 2\r\nv2\r\n", "NOT_STORED\r\n")
+	do("replace missing 0 0 2\r\nv2\r\n", "NOT_STORED\r\n")
+	do("replace k 0 100 2\r\nv2\r\n", "STORED\r\n")
+	if v, ok := GetGroup("mcGroup").cache.get("k"); !ok || v.ExpireAt().IsZero() {
+		t.Fatalf("replace with exptime did not set ttl: %v", v)
+	}
+	cas := memcacheCASValue(ByteView{b: []byte("v2")})
+	do("gets k\r\n", fmt.Sprintf("VALUE k 0 2 %d\r\nv2\r\nEND\r\n", cas))
+	do(fmt.Sprintf("cas k 0 0 2 %d\r\nv3\r\n", cas+1), "EXISTS\r\n")
+	do(fmt.Sprintf("cas k 0 0 2 %d\r\nv3\r\n", cas), "STORED\r\n")
+	do("touch k 10\r\n", "TOUCHED\r\n")
+	do("touch missing 10\r\n", "NOT_FOUND\r\n")
+
+	// incr/decr
+	do("set n 0 0 2\r\n10\r\n", "STORED\r\n")
+	do("incr n 5\r\n", "15\r\n")
+	do("decr n 100\r\n", "0\r\n")
+	do("incr k 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+	do("incr missing 1\r\n", "NOT_FOUND\r\n")
+
+	// group:key 前缀写入对应的 Group，未知前缀属于默认 Group 的key
+	do("set mcOther:k 0 0 1\r\no\r\n", "STORED\r\n")
+	do("set nogroup:k 0 0 1\r\nd\r\n", "STORED\r\n")
+	do("get mcOther:k k nogroup:k\r\n", "VALUE mcOther:k 0 1\r\no\r\nVALUE k 0 2\r\nv3\r\nVALUE nogroup:k 0 1\r\nd\r\nEND\r\n")
+	if _, ok := GetGroup("mcOther").cache.get("k"); !ok {
+		t.Fatal("mcOther:k not stored in group mcOther")
+	}
+
+	do("delete k\r\n", "DELETED\r\n")
+	do("set k 0 0 1 noreply\r\na\r\nget k\r\n", "VALUE k 0 1\r\na\r\nEND\r\n")
+	do("set k 0 -1 1\r\na\r\nget k\r\n", "STORED\r\nEND\r\n")
+	do(fmt.Sprintf("get %s\r\n", strings.Repeat("x", maxMemcacheKeyLen+1)), "CLIENT_ERROR bad key\r\n")
+	do("bogus\r\n", "ERROR\r\n")
+	do("version\r\n", "VERSION "+memcacheVersion+"\r\n")
+	do("stats\r\n", "STAT uptime ")
+	if line, err := r.ReadString('\n'); err != nil || line == "" {
+		t.Fatal(line, err)
+	}
+
+	if _, err := conn.Write([]byte("quit\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if rest, err := io.ReadAll(r); err != nil || !strings.HasSuffix(string(rest), "END\r\n") {
+		t.Fatalf("connection not closed after quit: %q, %v", rest, err)
+	}
+}
+
+func TestServer_serveMemcacheBinary(t *testing.T) {
+	NewGroup("mcBinGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}))
+	conn := startMemcache(t, "mcBinGroup")
+	r := bufio.NewReader(conn)
+
+	send := func(opcode byte, cas uint64, extras []byte, key, value string) {
+		t.Helper()
+		header := make([]byte, memcacheBinaryHeaderLen)
+		header[0] = memcacheBinaryMagic
+		header[1] = opcode
+		binary.BigEndian.PutUint16(header[2:], uint16(len(key)))
+		header[4] = byte(len(extras))
+		binary.BigEndian.PutUint32(header[8:], uint32(len(extras)+len(key)+len(value)))
+		binary.BigEndian.PutUint32(header[12:], uint32(opcode)+100)
+		binary.BigEndian.PutUint64(header[16:], cas)
+		msg := append(append(append(header, extras...), key...), value...)
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	type response struct {
+		opcode byte
+		status uint16
+		cas    uint64
+		key    string
+		value  string
+	}
+	recv := func() response {
+		t.Helper()
+		header := make([]byte, memcacheBinaryHeaderLen)
+		if _, err := io.ReadFull(r, header); err != nil {
+			t.Fatal(err)
+		}
+		if header[0] != memcacheBinaryResponse || binary.BigEndian.Uint32(header[12:]) != uint32(header[1])+100 {
+			t.Fatalf("bad response header %x", header)
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[8:]))
+		if _, err := io.ReadFull(r, body); err != nil {
+			t.Fatal(err)
+		}
+		keyLen, extrasLen := int(binary.BigEndian.Uint16(header[2:])), int(header[4])
+		return response{
+			opcode: header[1],
+			status: binary.BigEndian.Uint16(header[6:]),
+			cas:    binary.BigEndian.Uint64(header[16:]),
+			key:    string(body[extrasLen : extrasLen+keyLen]),
+			value:  string(body[extrasLen+keyLen:]),
+		}
+	}
+	setExtras := func(exptime uint32) []byte {
+		return binary.BigEndian.AppendUint32(make([]byte, 4), exptime)
+	}
+
+	send(mcOpSet, 0, setExtras(0), "k", "v1")
+	set := recv()
+	if set.status != mcStatusOK || set.cas == 0 {
+		t.Fatalf("set = %+v", set)
+	}
+	send(mcOpGet, 0, nil, "k", "")
+	if got := recv(); got.status != mcStatusOK || got.value != "v1" || got.cas != set.cas {
+		t.Fatalf("get = %+v", got)
+	}
+	send(mcOpSet, set.cas+1, setExtras(0), "k", "v2")
+	if got := recv(); got.status != mcStatusExists {
+		t.Fatalf("set with stale cas = %+v", got)
+	}
+	send(mcOpAdd, 0, setExtras(0), "k", "v2")
+	if got := recv(); got.status != mcStatusNotStored {
+		t.Fatalf("add existing = %+v", got)
+	}
+
+	// 安静模式：GetKQ 未命中和 SetQ 成功时不响应，由 Noop 标记批量请求结束
+	send(mcOpSetQ, 0, setExtras(0), "q", "quiet")
+	send(mcOpGetKQ, 0, nil, "missing", "")
+	send(mcOpGetKQ, 0, nil, "q", "")
+	send(mcOpNoop, 0, nil, "", "")
+	if got := recv(); got.opcode != mcOpGetKQ || got.key != "q" || got.value != "quiet" {
+		t.Fatalf("getkq = %+v", got)
+	}
+	if got := recv(); got.opcode != mcOpNoop {
+		t.Fatalf("noop = %+v", got)
+	}
+
+	// incr 在key不存在时以初始值创建
+	incrExtras := binary.BigEndian.AppendUint64(binary.BigEndian.AppendUint64(nil, 5), 10)
+	send(mcOpIncr, 0, binary.BigEndian.AppendUint32(incrExtras, 0), "n", "")
+	if got := recv(); got.status != mcStatusOK || binary.BigEndian.Uint64([]byte(got.value)) != 10 {
+		t.Fatalf("incr create = %+v", got)
+	}
+	send(mcOpIncr, 0, binary.BigEndian.AppendUint32(incrExtras, 0), "n", "")
+	if got := recv(); got.status != mcStatusOK || binary.BigEndian.Uint64([]byte(got.value)) != 15 {
+		t.Fatalf("incr = %+v", got)
+	}
+	send(mcOpDecr, 0, binary.BigEndian.AppendUint32(incrExtras, memcacheNoAutoCreate), "missing", "")
+	if got := recv(); got.status != mcStatusNotFound {
+		t.Fatalf("decr missing = %+v", got)
+	}
+
+	send(mcOpDelete, 0, nil, "k", "")
+	if got := recv(); got.status != mcStatusOK {
+		t.Fatalf("delete = %+v", got)
+	}
+	send(mcOpGet, 0, nil, "k", "")
+	if got := recv(); got.status != mcStatusNotFound {
+		t.Fatalf("get deleted = %+v", got)
+	}
+	send(0x3f, 0, nil, "", "")
+	if got := recv(); got.status != mcStatusUnknownCmd {
+		t.Fatalf("unknown = %+v", got)
+	}
+	send(mcOpQuit, 0, nil, "", "")
+	if got := recv(); got.opcode != mcOpQuit {
+		t.Fatalf("quit = %+v", got)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Fatalf("connection not closed after quit: %v", err)
+	}
+}
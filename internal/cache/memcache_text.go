@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// memcached文本协议，每条命令一行，写入命令后跟数据块
+
+const memcacheBadFormat = "CLIENT_ERROR bad command line format"
+
+func (m *memcacheServer) serveText(ctx context.Context, r *bufio.Reader, w *bufio.Writer) {
+	for {
+		line, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			w.WriteString("CLIENT_ERROR line too long\r\n")
+			_ = w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(string(bytes.TrimRight(line, "\r\n")))
+		quit := false
+		if len(fields) == 0 {
+			w.WriteString("ERROR\r\n")
+		} else if quit, err = m.textCommand(ctx, fields, r, w); err != nil {
+			// 数据块读取失败，连接上的后续数据已无法解析
+			_ = w.Flush()
+			log.Debugf("memcache text connection closed: %v", err)
+			return
+		}
+		// 流水线中的命令全部处理后再一次性写出
+		if r.Buffered() == 0 || quit {
+			if w.Flush() != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// 处理一条命令，返回是否关闭连接。仅在数据块无法读取时返回错误
+func (m *memcacheServer) textCommand(ctx context.Context, fields []string, r *bufio.Reader, w *bufio.Writer) (bool, error) {
+	cmd, args := fields[0], fields[1:]
+	noreply := len(args) > 0 && args[len(args)-1] == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+	}
+	reply := func(s string) {
+		if !noreply {
+			w.WriteString(s)
+			w.WriteString("\r\n")
+		}
+	}
+
+	switch cmd {
+	case "get", "gets":
+		if len(args) == 0 {
+			w.WriteString("ERROR\r\n")
+			return false, nil
+		}
+		m.textGet(ctx, args, cmd == "gets", w)
+	case "set", "add", "replace", "cas":
+		return false, m.textStore(ctx, cmd, args, r, reply)
+	case "delete":
+		if len(args) != 1 {
+			reply(memcacheBadFormat)
+			return false, nil
+		}
+		if err := m.delete(ctx, args[0]); err != nil {
+			reply(memcacheTextError(err))
+			return false, nil
+		}
+		reply("DELETED")
+	case "touch":
+		if len(args) != 2 {
+			reply(memcacheBadFormat)
+			return false, nil
+		}
+		exptime, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			reply(memcacheBadFormat)
+			return false, nil
+		}
+		_, status, err := m.touch(ctx, args[0], exptime)
+		switch {
+		case err != nil:
+			reply(memcacheTextError(err))
+		case status == memcacheNotFound:
+			reply("NOT_FOUND")
+		default:
+			reply("TOUCHED")
+		}
+	case "incr", "decr":
+		if len(args) != 2 {
+			reply(memcacheBadFormat)
+			return false, nil
+		}
+		delta, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			reply("CLIENT_ERROR invalid numeric delta argument")
+			return false, nil
+		}
+		n, status, err := m.incr(ctx, args[0], delta, cmd == "decr")
+		switch {
+		case err != nil:
+			reply(memcacheTextError(err))
+		case status == memcacheNotFound:
+			reply("NOT_FOUND")
+		default:
+			reply(strconv.FormatUint(n, 10))
+		}
+	case "stats":
+		if len(args) != 0 {
+			w.WriteString("ERROR\r\n")
+			return false, nil
+		}
+		for _, stat := range m.stats() {
+			w.WriteString("STAT " + stat[0] + " " + stat[1] + "\r\n")
+		}
+		w.WriteString("END\r\n")
+	case "version":
+		w.WriteString("VERSION " + memcacheVersion + "\r\n")
+	case "quit":
+		return true, nil
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return false, nil
+}
+
+// get/gets <key>*，未命中的key不返回；任一key出错时只返回错误
+func (m *memcacheServer) textGet(ctx context.Context, keys []string, withCAS bool, w *bufio.Writer) {
+	results := m.getMany(ctx, keys)
+	for _, key := range keys {
+		if err := results[key].Err; err != nil && !errors.Is(err, ErrNotFound) {
+			w.WriteString(memcacheTextError(err) + "\r\n")
+			return
+		}
+	}
+	for _, key := range keys {
+		result := results[key]
+		if result.Err != nil {
+			continue
+		}
+		w.WriteString("VALUE " + key + " 0 " + strconv.Itoa(result.Value.Len()))
+		if withCAS {
+			w.WriteString(" " + strconv.FormatUint(memcacheCASValue(result.Value), 10))
+		}
+		w.WriteString("\r\n")
+		w.Write(result.Value.b)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+// <cmd> <key> <flags> <exptime> <bytes> [<cas>] [noreply]，随后是 <bytes> 字节的数据块
+func (m *memcacheServer) textStore(ctx context.Context, cmd string, args []string, r *bufio.Reader, reply func(string)) error {
+	want := 4
+	if cmd == "cas" {
+		want = 5
+	}
+	if len(args) != want {
+		reply(memcacheBadFormat)
+		return nil
+	}
+	_, flagsErr := strconv.ParseUint(args[1], 10, 32)
+	exptime, expErr := strconv.ParseInt(args[2], 10, 64)
+	n, lenErr := strconv.Atoi(args[3])
+	if flagsErr != nil || expErr != nil || lenErr != nil || n < 0 {
+		reply(memcacheBadFormat)
+		return nil
+	}
+	var cas uint64
+	if cmd == "cas" {
+		var err error
+		if cas, err = strconv.ParseUint(args[4], 10, 64); err != nil {
+			reply(memcacheBadFormat)
+			return nil
+		}
+	}
+	// 过大的value丢弃其数据块，连接可以继续使用
+	if n > maxMemcacheValueLen {
+		if _, err := r.Discard(n + 2); err != nil {
+			return err
+		}
+		reply(memcacheTextError(errMemcacheTooLarge))
+		return nil
+	}
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		reply("CLIENT_ERROR bad data chunk")
+		return errors.New("bad data chunk")
+	}
+
+	mode := map[string]memcacheStoreMode{"set": memcacheSet, "add": memcacheAdd, "replace": memcacheReplace, "cas": memcacheCAS}[cmd]
+	status, err := m.store(ctx, mode, args[0], data[:n], exptime, cas)
+	switch {
+	case err != nil:
+		reply(memcacheTextError(err))
+	case status == memcacheNotStored:
+		reply("NOT_STORED")
+	case status == memcacheExists:
+		reply("EXISTS")
+	case status == memcacheNotFound:
+		reply("NOT_FOUND")
+	default:
+		reply("STORED")
+	}
+	return nil
+}
+
+// 客户端的错误返回 CLIENT_ERROR，其他错误返回 SERVER_ERROR
+func memcacheTextError(err error) string {
+	switch {
+	case errors.Is(err, errMemcacheBadKey), errors.Is(err, errMemcacheNoGroup), errors.Is(err, errMemcacheNonNumber):
+		return "CLIENT_ERROR " + err.Error()
+	default:
+		return "SERVER_ERROR " + err.Error()
+	}
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"FishCache/internal/metrics"
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Stats Group 的访问统计，所有字段均为累计值
+type Stats struct {
+	Gets       atomic.Int64 // 请求的key数量
+	Hits       atomic.Int64 // 命中本地缓存的次数
+	HotHits    atomic.Int64 // 命中热点缓存的次数
+	Misses     atomic.Int64 // 未命中任何缓存的次数
+	Loads      atomic.Int64 // 经过 singleflight 合并后实际执行加载的次数
+	LocalLoads atomic.Int64 // 通过 Getter 加载成功的次数
+	PeerLoads  atomic.Int64 // 从远程节点加载成功的次数
+	PeerErrors atomic.Int64 // 请求远程节点失败的次数，包括每次重试
+}
+
+// 单个计数指标的描述
+type counterDesc struct {
+	name  string
+	help  string
+	value func(g *Group) int64
+}
+
+var groupCounters = []counterDesc{
+	{"fishcache_group_gets_total", "Keys requested from the group.", func(g *Group) int64 { return g.Stats.Gets.Load() }},
+	{"fishcache_group_hits_total", "Requests served from the main cache.", func(g *Group) int64 { return g.Stats.Hits.Load() }},
+	{"fishcache_group_hot_hits_total", "Requests served from the hot cache.", func(g *Group) int64 { return g.Stats.HotHits.Load() }},
+	{"fishcache_group_misses_total", "Requests that missed both caches.", func(g *Group) int64 { return g.Stats.Misses.Load() }},
+	{"fishcache_group_loads_total", "Loads executed after singleflight deduplication.", func(g *Group) int64 { return g.Stats.Loads.Load() }},
+	{"fishcache_group_local_loads_total", "Successful loads through the getter.", func(g *Group) int64 { return g.Stats.LocalLoads.Load() }},
+	{"fishcache_group_peer_loads_total", "Successful loads from remote peers.", func(g *Group) int64 { return g.Stats.PeerLoads.Load() }},
+	{"fishcache_group_peer_errors_total", "Failed calls to remote peers, including retries.", func(g *Group) int64 { return g.Stats.PeerErrors.Load() }},
+	{"fishcache_group_singleflight_dedups_total", "Loads merged into an in-flight or recently finished call.", func(g *Group) int64 { return g.flight.Dedups() }},
+}
+
+// 缓存容量指标的描述
+type cacheStatDesc struct {
+	name  string
+	help  string
+	typ   string
+	value func(s CacheStats) int64
+}
+
+var cacheStatDescs = []cacheStatDesc{
+	{"fishcache_cache_items", "Entries currently held in the cache.", metrics.TypeGauge, func(s CacheStats) int64 { return s.Items }},
+	{"fishcache_cache_bytes", "Bytes of keys and values currently held in the cache.", metrics.TypeGauge, func(s CacheStats) int64 { return s.Bytes }},
+	{"fishcache_cache_evictions_total", "Entries evicted for capacity or expiration.", metrics.TypeCounter, func(s CacheStats) int64 { return s.Evictions }},
+}
+
+// WriteMetrics 以 Prometheus 文本格式写入所有 Group 的统计指标
+func WriteMetrics(w io.Writer) {
+	groups := allGroups()
+
+	for _, desc := range groupCounters {
+		metrics.WriteHeader(w, desc.name, desc.help, metrics.TypeCounter)
+		for _, g := range groups {
+			metrics.WriteSample(w, desc.name, []metrics.Label{{Name: "group", Value: g.name}}, float64(desc.value(g)))
+		}
+	}
+
+	stats := make(map[*Group][3]CacheStats, len(groups))
+	for _, g := range groups {
+		stats[g] = [3]CacheStats{g.cache.stats(), g.hot.stats(), g.cache.disk.stats()}
+	}
+	for _, desc := range cacheStatDescs {
+		metrics.WriteHeader(w, desc.name, desc.help, desc.typ)
+		for _, g := range groups {
+			for i, kind := range []string{"main", "hot", "disk"} {
+				labels := []metrics.Label{{Name: "group", Value: g.name}, {Name: "cache", Value: kind}}
+				metrics.WriteSample(w, desc.name, labels, float64(desc.value(stats[g][i])))
+			}
+		}
+	}
+}
+
+const handlerLatencyMetric = "fishcache_grpc_handler_duration_seconds"
+
+// 记录gRPC处理耗时的拦截器
+func (s *Server) latencyInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	s.handlerLatency.With(info.FullMethod).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// MetricsHandler 返回以 Prometheus 文本格式输出指标的 HTTP 处理器，通常挂载在 /metrics
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteMetrics(w)
+		metrics.WriteHeader(w, handlerLatencyMetric, "Latency of gRPC handlers in seconds.", metrics.TypeHistogram)
+		s.handlerLatency.Write(w, handlerLatencyMetric)
+	})
+}
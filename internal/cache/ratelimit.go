@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter 令牌桶限速器，令牌按固定速率产生，最多累积 burst 个
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒产生的令牌数
+	burst  float64 // 最多累积的令牌数
+	tokens float64 // 当前的令牌数，透支时为负数
+	last   time.Time
+}
+
+func newRateLimiter(rate int64, burst int64) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// 取出 n 个令牌，令牌不足时等待直到补足，ctx 取消时返回 ctx 的错误。
+// n 可以大于 burst，此时透支之后产生的令牌
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// RendezvousMap 最高随机权重哈希（HRW）：对每个节点计算 key 与节点组合的得分，得分最高的节点负责该key。
+// 增删节点时只有归属于该节点的key会移动，且不需要虚拟节点就能得到均匀的分布，代价是每次查找需遍历所有节点。
+type RendezvousMap struct {
+	mu      sync.RWMutex
+	nodes   []string
+	hashes  []uint64  // 节点名称的哈希值
+	weights []float64 // 节点权重
+}
+
+func NewRendezvous() *RendezvousMap {
+	return &RendezvousMap{}
+}
+
+// SetNodes 按节点及其权重重建节点列表
+func (m *RendezvousMap) SetNodes(weights map[string]int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nodes = sortedNodes(weights)
+	m.hashes = make([]uint64, len(m.nodes))
+	m.weights = make([]float64, len(m.nodes))
+	for i, node := range m.nodes {
+		m.hashes[i] = hash64(node)
+		m.weights[i] = float64(max(weights[node], 1))
+	}
+}
+
+// GetNode 返回得分最高的节点
+func (m *RendezvousMap) GetNode(key string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keyHash := hash64(key)
+	best, bestScore := -1, math.Inf(-1)
+	for i := range m.nodes {
+		if score := m.score(keyHash, i); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return m.nodes[best]
+}
+
+// GetNodes 按得分从高到低返回 n 个节点
+func (m *RendezvousMap) GetNodes(key string, n int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keyHash := hash64(key)
+	scores := make([]float64, len(m.nodes))
+	order := make([]int, len(m.nodes))
+	for i := range m.nodes {
+		scores[i] = m.score(keyHash, i)
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	nodes := make([]string, 0, min(max(n, 0), len(order)))
+	for _, i := range order[:cap(nodes)] {
+		nodes = append(nodes, m.nodes[i])
+	}
+	return nodes
+}
+
+// 计算key与第i个节点的得分。带权重时得分为 -weight/ln(u)，u 为key与节点哈希得到的(0,1)区间的均匀值，
+// 此时每个节点被选中的概率与权重成正比。
+func (m *RendezvousMap) score(keyHash uint64, i int) float64 {
+	// 取高53位作为浮点数尾数，+0.5 保证 u 不会为0或1
+	u := (float64(mix64(keyHash^m.hashes[i])>>11) + 0.5) / (1 << 53)
+	return -m.weights[i] / math.Log(u)
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 写入所有副本：先同步写入优先级最高的副本，失败时直接返回；其余副本并行写入，按失败策略重试后仍失败时返回错误。
+// 本节点是副本时调用 local，不是副本时清除本地可能残留的旧值。
+func (g *Group) writeReplicas(ctx context.Context, key string, replicas []PeerGetter, local func(), remote func(peer PeerGetter) error) error {
+	if !slices.Contains(replicas, nil) {
+		g.removeLocally(key)
+	}
+
+	write := func(peer PeerGetter) error {
+		if peer == nil {
+			local()
+			return nil
+		}
+		return g.callPeer(ctx, peer, key, func() error {
+			return remote(peer)
+		})
+	}
+	if err := write(replicas[0]); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(replicas)-1)
+	for i, peer := range replicas[1:] {
+		wg.Add(1)
+		go func(i int, peer PeerGetter) {
+			defer wg.Done()
+			errs[i] = write(peer)
+		}(i, peer)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("write replicas of %s/%s: %w", g.name, key, err)
+	}
+	return nil
+}
+
+// 按优先顺序从副本加载：本节点是当前副本时通过 Getter 加载并同步给其他副本；
+// 远程副本故障时尝试下一个副本，业务错误直接返回；所有副本都故障时按失败策略决定是否回退到本地加载。
+func (g *Group) loadFromReplicas(ctx context.Context, key string, replicas []PeerGetter) (ByteView, error) {
+	isReplica := slices.Contains(replicas, nil)
+	var lastErr error
+	for _, peer := range replicas {
+		if peer == nil {
+			value, err := g.getLocally(ctx, key)
+			if err == nil {
+				g.replicate(key, value, replicas)
+			}
+			return value, err
+		}
+
+		var value ByteView
+		err := g.callPeer(ctx, peer, key, func() (err error) {
+			value, err = g.getFromPeer(ctx, peer, key)
+			return err
+		})
+		if err == nil {
+			log.Printf("Load remote key: %s\n", key)
+			g.Stats.PeerLoads.Add(1)
+			// 本节点也是副本时保存到本地缓存，否则按采样率写入热点缓存
+			if isReplica {
+				g.cache.add(key, value)
+			} else {
+				g.populateHotCache(key, value)
+			}
+			return value, nil
+		}
+		var peerErr *PeerError
+		if !errors.As(err, &peerErr) {
+			return ByteView{}, err
+		}
+		log.Warnf("%v, try next replica", err)
+		lastErr = err
+	}
+
+	if !g.failure.FallbackLocal {
+		return ByteView{}, lastErr
+	}
+	log.Warnf("%v, fallback to local getter", lastErr)
+	return g.getLocally(ctx, key)
+}
+
+// 将本节点加载的源数据异步写入其他副本，避免某个副本故障时其他副本全部回源。
+// 以同步副本的方式写入，副本上已有的新值和之后的删除不会被覆盖
+func (g *Group) replicate(key string, value ByteView, replicas []PeerGetter) {
+	for _, peer := range replicas {
+		if peer == nil {
+			continue
+		}
+		go func(peer PeerGetter) {
+			ctx := withFill(context.Background())
+			err := g.callPeer(ctx, peer, key, func() error {
+				return peer.Set(ctx, g.name, key, value)
+			})
+			if err != nil {
+				log.Warnf("replicate %s/%s to %s failed: %v", g.name, key, peer.Addr(), err)
+			}
+		}(peer)
+	}
+}
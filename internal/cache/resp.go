@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// RESP协议的编解码，支持RESP2和RESP3中客户端常用的部分
+
+const (
+	// 单个参数允许的最大字节数
+	maxRESPBulkLen = 64 << 20
+	// 单条命令允许的最大参数个数
+	maxRESPArgs = 1 << 20
+	// 单条命令所有参数合计允许的最大字节数，为值之外的key和选项留出余量
+	maxRESPCommandLen = maxRESPBulkLen + 1<<20
+	// 读取参数时每次分配的最大字节数，按实际收到的数据增长，不按声明的长度一次性分配
+	respReadChunk = 64 << 10
+)
+
+// 客户端发送的协议错误，回复错误后关闭连接
+var errRESPProtocol = errors.New("protocol error")
+
+// 读取客户端命令，支持数组格式和以空格分隔的内联格式
+type respReader struct {
+	r *bufio.Reader
+}
+
+func newRESPReader(r io.Reader) *respReader {
+	return &respReader{r: bufio.NewReader(r)}
+}
+
+// 读取一条命令，空行被忽略
+func (rr *respReader) readCommand() ([][]byte, error) {
+	for {
+		line, err := rr.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != '*' {
+			// line 指向 bufio 的内部缓冲区，读取下一条命令时会被覆盖，参数需要复制
+			args := bytes.Fields(line)
+			for i := range args {
+				args[i] = bytes.Clone(args[i])
+			}
+			return args, nil
+		}
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n > maxRESPArgs {
+			return nil, fmt.Errorf("%w: invalid multibulk length", errRESPProtocol)
+		}
+		if n <= 0 {
+			continue
+		}
+		args := make([][]byte, 0, min(n, 1024))
+		remaining := maxRESPCommandLen
+		for i := 0; i < n; i++ {
+			arg, err := rr.readBulk(remaining)
+			if err != nil {
+				return nil, err
+			}
+			remaining -= len(arg)
+			args = append(args, arg)
+		}
+		return args, nil
+	}
+}
+
+// 读取一个 $<len>\r\n<data>\r\n 格式的参数，limit 为本条命令剩余可用的字节数
+func (rr *respReader) readBulk(limit int) ([]byte, error) {
+	line, err := rr.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, fmt.Errorf("%w: expected '$', got '%s'", errRESPProtocol, line)
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > maxRESPBulkLen {
+		return nil, fmt.Errorf("%w: invalid bulk length", errRESPProtocol)
+	}
+	if n > limit {
+		return nil, fmt.Errorf("%w: command too large", errRESPProtocol)
+	}
+	// 声明的长度不可信，分块读取，内存随实际收到的数据增长
+	buf := make([]byte, 0, min(n, respReadChunk))
+	for len(buf) < n {
+		chunk := min(n-len(buf), respReadChunk)
+		buf = slices.Grow(buf, chunk)
+		read, err := io.ReadFull(rr.r, buf[len(buf):len(buf)+chunk])
+		buf = buf[:len(buf)+read]
+		if err != nil {
+			return nil, err
+		}
+	}
+	var crlf [2]byte
+	if _, err = io.ReadFull(rr.r, crlf[:]); err != nil {
+		return nil, err
+	}
+	if crlf[0] != '\r' || crlf[1] != '\n' {
+		return nil, fmt.Errorf("%w: bulk not terminated by CRLF", errRESPProtocol)
+	}
+	return buf, nil
+}
+
+// 读取一行并去掉结尾的 \r\n
+func (rr *respReader) readLine() ([]byte, error) {
+	line, err := rr.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("%w: line too long", errRESPProtocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// 是否还有已读取但未处理的数据，用于在流水线请求处理完后再刷新输出
+func (rr *respReader) buffered() bool {
+	return rr.r.Buffered() > 0
+}
+
+// 按连接协商的协议版本写入回复
+type respWriter struct {
+	w     *bufio.Writer
+	proto int // 2 或 3
+}
+
+func newRESPWriter(w io.Writer) *respWriter {
+	return &respWriter{w: bufio.NewWriter(w), proto: 2}
+}
+
+func (rw *respWriter) simple(s string) {
+	rw.w.WriteByte('+')
+	rw.w.WriteString(s)
+	rw.w.WriteString("\r\n")
+}
+
+func (rw *respWriter) error(msg string) {
+	rw.w.WriteByte('-')
+	rw.w.WriteString(msg)
+	rw.w.WriteString("\r\n")
+}
+
+func (rw *respWriter) integer(n int64) {
+	rw.w.WriteByte(':')
+	rw.w.WriteString(strconv.FormatInt(n, 10))
+	rw.w.WriteString("\r\n")
+}
+
+func (rw *respWriter) bulk(b []byte) {
+	rw.w.WriteByte('$')
+	rw.w.WriteString(strconv.Itoa(len(b)))
+	rw.w.WriteString("\r\n")
+	rw.w.Write(b)
+	rw.w.WriteString("\r\n")
+}
+
+func (rw *respWriter) bulkString(s string) {
+	rw.bulk([]byte(s))
+}
+
+// RESP2 中用长度为-1的bulk表示空值，RESP3 中有专门的空值类型
+func (rw *respWriter) null() {
+	if rw.proto >= 3 {
+		rw.w.WriteString("_\r\n")
+		return
+	}
+	rw.w.WriteString("$-1\r\n")
+}
+
+func (rw *respWriter) array(n int) {
+	rw.w.WriteByte('*')
+	rw.w.WriteString(strconv.Itoa(n))
+	rw.w.WriteString("\r\n")
+}
+
+// RESP2 中 map 以键值交替的数组表示
+func (rw *respWriter) mapHeader(n int) {
+	if rw.proto >= 3 {
+		rw.w.WriteByte('%')
+		rw.w.WriteString(strconv.Itoa(n))
+		rw.w.WriteString("\r\n")
+		return
+	}
+	rw.array(2 * n)
+}
+
+func (rw *respWriter) flush() error {
+	return rw.w.Flush()
+}
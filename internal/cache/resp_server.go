@@ -0,0 +1,401 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 在INFO和HELLO中报告的Redis版本，部分客户端据此判断可用的命令
+const respRedisVersion = "7.0.0"
+
+// RESP连接的编号，CLIENT ID 返回
+var respConnID atomic.Int64
+
+// 单个RESP连接的状态
+type respConn struct {
+	s     *Server
+	id    int64
+	ctx   context.Context // 连接关闭时取消
+	group *Group          // SELECT 选择的 Group
+	w     *respWriter
+	quit  bool // 收到QUIT，回复后关闭连接
+}
+
+// 一条RESP命令的参数个数限制（包括命令名）和处理函数，maxArgs<0表示不限
+type respCommand struct {
+	minArgs   int
+	maxArgs   int
+	needGroup bool // 是否需要已选择的 Group
+	fn        func(c *respConn, args [][]byte)
+}
+
+var respCommands map[string]respCommand
+
+func init() {
+	respCommands = map[string]respCommand{
+		"PING":    {1, 2, false, (*respConn).ping},
+		"ECHO":    {2, 2, false, (*respConn).echo},
+		"QUIT":    {1, 1, false, (*respConn).quitCmd},
+		"HELLO":   {1, -1, false, (*respConn).hello},
+		"CLIENT":  {2, -1, false, (*respConn).client},
+		"COMMAND": {1, -1, false, (*respConn).command},
+		"SELECT":  {2, 2, false, (*respConn).selectGroup},
+		"INFO":    {1, -1, false, (*respConn).info},
+		"GET":     {2, 2, true, (*respConn).get},
+		"MGET":    {2, -1, true, (*respConn).mget},
+		"SET":     {3, -1, true, (*respConn).set},
+		"DEL":     {2, -1, true, (*respConn).del},
+		"EXISTS":  {2, -1, true, (*respConn).exists},
+		"TTL":     {2, 2, true, (*respConn).ttl},
+		"PTTL":    {2, 2, true, (*respConn).ttl},
+	}
+}
+
+// ServeRESP 在 lis 上提供兼容Redis的RESP2/RESP3协议前端，使 redis-cli 和 go-redis 等客户端可以直接访问缓存。
+// 支持 GET、SET（EX/PX）、DEL、MGET、EXISTS、TTL、PTTL、PING、ECHO、INFO、SELECT、HELLO 和 QUIT，
+// 与gRPC和HTTP网关使用相同的 Group 方法，key按 PickPeer 转发给归属节点。
+//
+// SELECT 选择 Group 而不是数据库：参数为数字时表示按名称排序后的第几个 Group，也可以直接使用 Group 名称，
+// 新连接默认使用排序后的第一个 Group。GET、EXISTS 和 TTL 未命中缓存时会通过 Getter 加载，
+// key在数据源中不存在（ErrNotFound）时视为key不存在。
+//
+// ServeRESP 阻塞直到 lis 被关闭，开启TLS时由调用方传入 tls.NewListener 包装后的 lis。
+func (s *Server) ServeRESP(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go s.serveRESPConn(conn)
+	}
+}
+
+func (s *Server) serveRESPConn(conn net.Conn) {
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &respConn{s: s, id: respConnID.Add(1), ctx: ctx, w: newRESPWriter(conn)}
+	if groups := allGroups(); len(groups) > 0 {
+		c.group = groups[0]
+	}
+	r := newRESPReader(conn)
+	for !c.quit {
+		args, err := r.readCommand()
+		if err != nil {
+			if errors.Is(err, errRESPProtocol) {
+				c.w.error("ERR " + err.Error())
+				_ = c.w.flush()
+				log.Warnf("resp client %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		c.dispatch(args)
+		// 流水线中的命令全部处理后再一次性写出
+		if !r.buffered() || c.quit {
+			if err = c.w.flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *respConn) dispatch(args [][]byte) {
+	name := strings.ToUpper(string(args[0]))
+	cmd, ok := respCommands[name]
+	if !ok {
+		var rest []string
+		for _, arg := range args[1:] {
+			rest = append(rest, "'"+string(arg)+"'")
+		}
+		c.w.error(fmt.Sprintf("ERR unknown command '%s', with args beginning with: %s", args[0], strings.Join(rest, " ")))
+		return
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		c.w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+		return
+	}
+	if cmd.needGroup && c.group == nil {
+		c.w.error("ERR no group selected")
+		return
+	}
+	cmd.fn(c, args)
+}
+
+// 将缓存错误写为RESP错误
+func (c *respConn) writeError(err error) {
+	var peerErr *PeerError
+	switch {
+	case errors.Is(err, ErrPeerUnavailable), errors.As(err, &peerErr):
+		c.w.error("TRYAGAIN " + err.Error())
+	default:
+		c.w.error("ERR " + err.Error())
+	}
+}
+
+func (c *respConn) ping(args [][]byte) {
+	if len(args) == 2 {
+		c.w.bulk(args[1])
+		return
+	}
+	c.w.simple("PONG")
+}
+
+func (c *respConn) echo(args [][]byte) {
+	c.w.bulk(args[1])
+}
+
+func (c *respConn) quitCmd([][]byte) {
+	c.w.simple("OK")
+	c.quit = true
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]，切换协议版本并返回服务端信息
+func (c *respConn) hello(args [][]byte) {
+	if len(args) >= 2 {
+		proto, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			c.w.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if proto != 2 && proto != 3 {
+			c.w.error("NOPROTO unsupported protocol version")
+			return
+		}
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(string(args[i])) {
+			case "AUTH":
+				i += 2
+			case "SETNAME":
+				i++
+			default:
+				c.w.error(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", args[i]))
+				return
+			}
+			if i >= len(args) {
+				c.w.error("ERR syntax error")
+				return
+			}
+		}
+		c.w.proto = proto
+	}
+
+	c.w.mapHeader(7)
+	c.w.bulkString("server")
+	c.w.bulkString("fishcache")
+	c.w.bulkString("version")
+	c.w.bulkString(respRedisVersion)
+	c.w.bulkString("proto")
+	c.w.integer(int64(c.w.proto))
+	c.w.bulkString("id")
+	c.w.integer(c.id)
+	c.w.bulkString("mode")
+	c.w.bulkString("standalone")
+	c.w.bulkString("role")
+	c.w.bulkString("master")
+	c.w.bulkString("modules")
+	c.w.array(0)
+}
+
+// 客户端连接时发送的 CLIENT SETNAME/SETINFO 等命令，只做应答
+func (c *respConn) client(args [][]byte) {
+	switch strings.ToUpper(string(args[1])) {
+	case "SETNAME", "SETINFO":
+		c.w.simple("OK")
+	case "GETNAME":
+		c.w.null()
+	case "ID":
+		c.w.integer(c.id)
+	default:
+		c.w.error(fmt.Sprintf("ERR unknown subcommand '%s'", args[1]))
+	}
+}
+
+// redis-cli 启动时通过 COMMAND DOCS 获取命令提示，返回空数组即可
+func (c *respConn) command([][]byte) {
+	c.w.array(0)
+}
+
+// SELECT <index|name>，index 为按名称排序后的 Group 序号
+func (c *respConn) selectGroup(args [][]byte) {
+	groups := allGroups()
+	arg := string(args[1])
+	if i, err := strconv.Atoi(arg); err == nil {
+		if i < 0 || i >= len(groups) {
+			c.w.error("ERR DB index is out of range")
+			return
+		}
+		c.group = groups[i]
+		c.w.simple("OK")
+		return
+	}
+	group := GetGroup(arg)
+	if group == nil {
+		c.w.error(fmt.Sprintf("ERR %v: %s", ErrGroupNotFound, arg))
+		return
+	}
+	c.group = group
+	c.w.simple("OK")
+}
+
+// INFO 返回服务端信息和各 Group 的统计，每个 Group 以 db<序号> 的形式出现在 Keyspace 中
+func (c *respConn) info([][]byte) {
+	var b strings.Builder
+	b.WriteString("# Server\r\n")
+	fmt.Fprintf(&b, "redis_version:%s\r\n", respRedisVersion)
+	b.WriteString("redis_mode:standalone\r\n")
+	fmt.Fprintf(&b, "fishcache_address:%s\r\n", c.s.address)
+	if c.group != nil {
+		fmt.Fprintf(&b, "fishcache_group:%s\r\n", c.group.name)
+	}
+
+	groups := allGroups()
+	var hits, misses, evictions int64
+	for _, g := range groups {
+		hits += g.Stats.Hits.Load() + g.Stats.HotHits.Load()
+		misses += g.Stats.Misses.Load()
+		evictions += g.cache.stats().Evictions
+	}
+	b.WriteString("\r\n# Stats\r\n")
+	fmt.Fprintf(&b, "keyspace_hits:%d\r\n", hits)
+	fmt.Fprintf(&b, "keyspace_misses:%d\r\n", misses)
+	fmt.Fprintf(&b, "evicted_keys:%d\r\n", evictions)
+
+	b.WriteString("\r\n# Keyspace\r\n")
+	for i, g := range groups {
+		stats := g.cache.stats()
+		fmt.Fprintf(&b, "db%d:keys=%d,expires=0,avg_ttl=0,group=%s,bytes=%d\r\n", i, stats.Items, g.name, stats.Bytes)
+	}
+	c.w.bulkString(b.String())
+}
+
+func (c *respConn) get(args [][]byte) {
+	view, err := c.group.GetContext(c.ctx, string(args[1]))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.w.null()
+	case err != nil:
+		c.writeError(err)
+	default:
+		c.w.bulk(view.b)
+	}
+}
+
+func (c *respConn) mget(args [][]byte) {
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		keys[i] = string(arg)
+	}
+	results := c.group.GetManyContext(c.ctx, keys)
+	// 与Redis一致，单个key的错误不影响其他key，均以空值返回
+	c.w.array(len(keys))
+	for _, key := range keys {
+		if result := results[key]; result.Err == nil {
+			c.w.bulk(result.Value.b)
+			continue
+		}
+		c.w.null()
+	}
+}
+
+// SET key value [EX seconds|PX milliseconds]
+func (c *respConn) set(args [][]byte) {
+	value := ByteView{b: args[2]}
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		if (opt != "EX" && opt != "PX") || i+1 >= len(args) || !value.expireAt.IsZero() {
+			c.w.error("ERR syntax error")
+			return
+		}
+		i++
+		n, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil {
+			c.w.error("ERR value is not an integer or out of range")
+			return
+		}
+		if n <= 0 {
+			c.w.error("ERR invalid expire time in 'set' command")
+			return
+		}
+		unit := time.Second
+		if opt == "PX" {
+			unit = time.Millisecond
+		}
+		value.expireAt = time.Now().Add(time.Duration(n) * unit)
+	}
+	if err := c.group.set(c.ctx, string(args[1]), value); err != nil {
+		c.writeError(err)
+		return
+	}
+	c.w.simple("OK")
+}
+
+// DEL 返回成功删除的key数量。key可能归属远程节点，为避免额外的查询不判断key是否存在，
+// 因此与Redis不同，不存在的key也计入返回值
+func (c *respConn) del(args [][]byte) {
+	var n int64
+	for _, arg := range args[1:] {
+		if err := c.group.remove(c.ctx, string(arg)); err != nil {
+			c.writeError(err)
+			return
+		}
+		n++
+	}
+	c.w.integer(n)
+}
+
+func (c *respConn) exists(args [][]byte) {
+	var n int64
+	for _, arg := range args[1:] {
+		_, err := c.group.GetContext(c.ctx, string(arg))
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			c.writeError(err)
+			return
+		default:
+			n++
+		}
+	}
+	c.w.integer(n)
+}
+
+// TTL/PTTL 返回剩余的过期时长，key不存在时返回-2，永不过期时返回-1
+func (c *respConn) ttl(args [][]byte) {
+	view, err := c.group.GetContext(c.ctx, string(args[1]))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.w.integer(-2)
+		return
+	case err != nil:
+		c.writeError(err)
+		return
+	}
+	expireAt := view.ExpireAt()
+	if expireAt.IsZero() {
+		c.w.integer(-1)
+		return
+	}
+	remaining := max(time.Until(expireAt), 0)
+	if strings.EqualFold(string(args[0]), "PTTL") {
+		c.w.integer(remaining.Milliseconds())
+		return
+	}
+	c.w.integer(int64((remaining + time.Second/2) / time.Second))
+}
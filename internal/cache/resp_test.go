@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"FishCache/internal/discovery/static"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_serveRESP(t *testing.T) {
+	NewGroup("respGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}))
+	s, err := NewRPCServer("127.0.0.1:0", static.New(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.ServeRESP(lis) }()
+	defer func() {
+		lis.Close()
+		if err := <-done; err != nil {
+			t.Errorf("ServeRESP() = %v", err)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	// 以数组格式发送命令，并按字节比较回复
+	do := func(want string, args ...string) {
+		t.Helper()
+		cmd := fmt.Sprintf("*%d\r\n", len(args))
+		for _, arg := range args {
+			cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+		}
+		if _, err := conn.Write([]byte(cmd)); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatalf("%v: read reply: %v", args, err)
+		}
+		if string(got) != want {
+			t.Fatalf("%v = %q, want %q", args, got, want)
+		}
+	}
+
+	do("+PONG\r\n", "PING")
+	do("+OK\r\n", "SELECT", "respGroup")
+	do("-ERR DB index is out of range\r\n", "SELECT", "1000")
+	// 未命中缓存时通过 Getter 加载，数据源中不存在的key返回空值
+	do("$3\r\n630\r\n", "GET", "Tom")
+	do("$-1\r\n", "GET", "missing")
+	do("+OK\r\n", "SET", "k", "v", "EX", "100")
+	do(":100\r\n", "TTL", "k")
+	do(":-1\r\n", "TTL", "Tom")
+	do(":-2\r\n", "TTL", "missing")
+	do("-ERR syntax error\r\n", "SET", "k", "v", "EX", "1", "PX", "1")
+	do("-ERR invalid expire time in 'set' command\r\n", "SET", "k", "v", "PX", "0")
+	do("*3\r\n$1\r\nv\r\n$-1\r\n$3\r\n630\r\n", "MGET", "k", "missing", "Tom")
+	do(":2\r\n", "EXISTS", "k", "missing", "Tom")
+	do(":1\r\n", "DEL", "k")
+	do("$-1\r\n", "GET", "k")
+	do("-ERR wrong number of arguments for 'get' command\r\n", "GET")
+	do("-ERR unknown command 'FLUSHALL', with args beginning with: \r\n", "FLUSHALL")
+
+	// 切换到RESP3后空值使用专门的类型
+	hello := fmt.Sprintf("%%7\r\n$6\r\nserver\r\n$9\r\nfishcache\r\n$7\r\nversion\r\n$5\r\n%s\r\n$5\r\nproto\r\n:3\r\n", respRedisVersion)
+	do(hello, "HELLO", "3")
+	for i := 0; i < 14; i++ { // 跳过 id、mode、role、modules 四个字段
+		if _, err := r.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+	do("_\r\n", "GET", "missing")
+
+	// 流水线和内联命令
+	if _, err := conn.Write([]byte("PING\r\nECHO hi\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"+PONG\r\n", "$2\r\n", "hi\r\n"} {
+		if line, err := r.ReadString('\n'); err != nil || line != want {
+			t.Fatalf("pipelined reply = %q, %v, want %q", line, err, want)
+		}
+	}
+
+	// 内联命令的参数在读取下一条命令后仍然有效
+	for _, cmd := range []string{"SET k1 AAAAAAAA\r\n", "SET k2 ZZZZZZZZ\r\n"} {
+		if _, err := conn.Write([]byte(cmd)); err != nil {
+			t.Fatal(err)
+		}
+		if line, err := r.ReadString('\n'); err != nil || line != "+OK\r\n" {
+			t.Fatalf("%q = %q, %v", cmd, line, err)
+		}
+	}
+	do("$8\r\nAAAAAAAA\r\n", "GET", "k1")
+
+	do("+OK\r\n", "QUIT")
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Fatalf("connection not closed after QUIT: %v", err)
+	}
+}
+
+func TestRESPReader_bulkLimit(t *testing.T) {
+	// 声明的长度很大但实际只发送少量数据时，不按声明的长度分配内存
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	rr := newRESPReader(strings.NewReader(fmt.Sprintf("*1\r\n$%d\r\nshort", maxRESPBulkLen)))
+	if _, err := rr.readCommand(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("readCommand() = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+		t.Errorf("allocated %d bytes for a truncated bulk", alloc)
+	}
+
+	// 超出本条命令剩余字节数的参数被拒绝
+	rr = newRESPReader(strings.NewReader("$6\r\nfoobar\r\n"))
+	if _, err := rr.readBulk(5); !errors.Is(err, errRESPProtocol) {
+		t.Errorf("readBulk() = %v, want %v", err, errRESPProtocol)
+	}
+	rr = newRESPReader(strings.NewReader("$6\r\nfoobar\r\n"))
+	if arg, err := rr.readBulk(6); err != nil || string(arg) != "foobar" {
+		t.Errorf("readBulk() = %q, %v", arg, err)
+	}
+	// 跨越多个分块的参数完整读取
+	large := strings.Repeat("v", 3*respReadChunk+1)
+	rr = newRESPReader(strings.NewReader(fmt.Sprintf("$%d\r\n%s\r\n", len(large), large)))
+	if arg, err := rr.readBulk(maxRESPCommandLen); err != nil || string(arg) != large {
+		t.Errorf("readBulk() = %d bytes, %v", len(arg), err)
+	}
+}
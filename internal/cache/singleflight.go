@@ -1,7 +1,10 @@
 package cache
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,6 +32,8 @@ type SingleFlight struct {
 	calls map[string]*call      // 正在进行的调用集合
 	cache map[string]cacheEntry // 缓存条目集合
 	ttl   time.Duration         // 缓存有效期
+
+	dedups atomic.Int64 // 被合并（复用缓存结果或等待已有调用）的调用次数
 }
 
 // NewFlightGroup 创建一个新的SingleFlight实例
@@ -48,19 +53,47 @@ func NewFlightGroup(ttl time.Duration) *SingleFlight {
 // Do 执行并返回给定key对应的结果
 // 如果缓存有效则直接返回，否则合并并发请求并执行fn获取结果
 func (sf *SingleFlight) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
-	// 1. 首先检查有效缓存
-	if value, ok := sf.getCache(key); ok {
-		return value.Value, value.Err
-	}
+	return sf.DoContext(context.Background(), key, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+}
 
-	// 2. 获取或创建调用对象
-	c, created := sf.getCall(key)
-	if !created {
-		<-c.done // 等待已有调用完成
+// DoContext 与 Do 相同，但等待已有调用时会响应 ctx 的取消，fn 使用发起调用的请求的 ctx 执行。
+// 因 ctx 取消或超时失败的结果不会被缓存；发起调用的请求被取消时，仍在等待的请求会重新发起调用。
+func (sf *SingleFlight) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// 1. 首先检查有效缓存
+		if value, ok := sf.getCache(key); ok {
+			sf.dedups.Add(1)
+			return value.Value, value.Err
+		}
+
+		// 2. 获取或创建调用对象
+		c, created := sf.getCall(key)
+		if created {
+			return sf.execute(ctx, key, c, fn)
+		}
+
+		sf.dedups.Add(1)
+		// 等待已有调用完成
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if isContextError(c.res.Err) {
+			continue
+		}
 		return c.res.Value, c.res.Err
 	}
+}
 
-	// 3. 当前goroutine负责执行函数并设置结果
+// execute 由当前goroutine负责执行函数并设置结果
+func (sf *SingleFlight) execute(ctx context.Context, key string, c *call, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
 	defer func() {
 		sf.mu.Lock()
 		delete(sf.calls, key) // 调用完成后移除call记录
@@ -69,15 +102,17 @@ func (sf *SingleFlight) Do(key string, fn func() (interface{}, error)) (interfac
 	}()
 
 	// 执行实际函数
-	value, err := fn()
+	value, err := fn(ctx)
 
-	// 4. 更新缓存（加写锁保证原子性）
-	sf.mu.Lock()
-	sf.cache[key] = cacheEntry{
-		result:  result{Value: value, Err: err},
-		expires: time.Now().Add(sf.ttl),
+	// 4. 更新缓存（加写锁保证原子性），被取消的调用不缓存
+	if !isContextError(err) {
+		sf.mu.Lock()
+		sf.cache[key] = cacheEntry{
+			result:  result{Value: value, Err: err},
+			expires: time.Now().Add(sf.ttl),
+		}
+		sf.mu.Unlock()
 	}
-	sf.mu.Unlock()
 
 	// 5. 设置调用结果并返回
 	c.res.Value = value
@@ -85,6 +120,18 @@ func (sf *SingleFlight) Do(key string, fn func() (interface{}, error)) (interfac
 	return value, err
 }
 
+// Dedups 返回被合并的调用次数
+func (sf *SingleFlight) Dedups() int64 {
+	return sf.dedups.Load()
+}
+
+// Forget 丢弃给定key已缓存的调用结果，保证写入或删除后的下一次Do重新执行
+func (sf *SingleFlight) Forget(key string) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	delete(sf.cache, key)
+}
+
 // getCache 获取有效缓存（自动清理过期缓存）
 func (sf *SingleFlight) getCache(key string) (result, bool) {
 	sf.mu.RLock()
@@ -130,3 +177,8 @@ func (sf *SingleFlight) getCall(key string) (*call, bool) {
 	sf.calls[key] = c
 	return c, true
 }
+
+// 判断错误是否由 ctx 取消或超时引起
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
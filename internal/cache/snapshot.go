@@ -0,0 +1,321 @@
+package cache
+
+import (
+	"FishCache/internal/cache/eviction"
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 快照文件格式（整数均为大端序，变长整数为 encoding/binary 的 varint）：
+//
+//	magic "FISHSNAP" | version uint16
+//	{ 1 | keyLen uvarint | key | valueLen uvarint | value | expireAt varint | idle uvarint }*
+//	0 | count uvarint | crc32c uint32
+//
+// expireAt 为值的过期时间（unix毫秒，0表示永不过期），节点停机的时间同样计入TTL；
+// idle 为保存时距上次访问的毫秒数。crc32c 校验之前的所有字节，校验失败时整个快照被丢弃。
+const (
+	snapshotMagic   = "FISHSNAP"
+	snapshotVersion = 1
+	// 单个key或value允许的最大长度，避免损坏的文件导致过大的内存分配
+	maxSnapshotField = 1 << 30
+)
+
+var (
+	crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+	// ErrSnapshotCorrupt 快照文件格式错误或校验失败
+	ErrSnapshotCorrupt = errors.New("snapshot corrupt")
+)
+
+// 快照相关配置
+type snapshotConfig struct {
+	path     string             // 快照文件路径，为空时不保存快照
+	interval time.Duration      // 定时保存的间隔，为0时只在服务器停止时保存
+	stop     context.CancelFunc // 停止定时保存，未定时保存时为nil
+}
+
+// WithSnapshot 设置快照文件路径：NewGroup 时若文件存在则从中恢复缓存，服务器停止时保存快照，
+// interval 大于0时还会按该间隔定时保存
+func WithSnapshot(path string, interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.snapshot = snapshotConfig{path: path, interval: interval}
+	}
+}
+
+// SaveSnapshot 将本地缓存写入快照文件，先写入临时文件再重命名，保存失败不会破坏已有的快照
+func (g *Group) SaveSnapshot() error {
+	if g.snapshot.path == "" {
+		return nil
+	}
+	start := time.Now()
+	entries := g.cache.snapshot()
+
+	dir := filepath.Dir(g.snapshot.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(g.snapshot.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create snapshot of group %s: %w", g.name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = writeSnapshot(tmp, entries); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write snapshot of group %s: %w", g.name, err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync snapshot of group %s: %w", g.name, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("close snapshot of group %s: %w", g.name, err)
+	}
+	if err = os.Rename(tmp.Name(), g.snapshot.path); err != nil {
+		return fmt.Errorf("rename snapshot of group %s: %w", g.name, err)
+	}
+	log.Infof("saved snapshot of group %s: %d keys in %v", g.name, len(entries), time.Since(start))
+	return nil
+}
+
+// 从快照文件恢复缓存，文件不存在时直接返回
+func (g *Group) loadSnapshot() error {
+	f, err := os.Open(g.snapshot.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open snapshot of group %s: %w", g.name, err)
+	}
+	defer f.Close()
+
+	entries, err := readSnapshot(f)
+	if err != nil {
+		return fmt.Errorf("read snapshot of group %s: %w", g.name, err)
+	}
+	g.cache.restore(entries)
+	log.Infof("restored snapshot of group %s: %d keys", g.name, len(entries))
+	return nil
+}
+
+// 定时保存快照，直到 ctx 取消
+func (g *Group) snapshotLoop(ctx context.Context) {
+	ticker := time.NewTicker(g.snapshot.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := g.SaveSnapshot(); err != nil {
+				log.Warnf("%v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 停止定时保存快照
+func (g *Group) stopSnapshotLoop() {
+	if g.snapshot.stop != nil {
+		g.snapshot.stop()
+	}
+}
+
+// StopSnapshots 停止所有 Group 的定时保存，并保存最后一次快照
+func StopSnapshots() {
+	for _, g := range allGroups() {
+		g.stopSnapshotLoop()
+	}
+	SaveSnapshots()
+}
+
+// SaveSnapshots 保存所有配置了快照的 Group
+func SaveSnapshots() {
+	for _, g := range allGroups() {
+		if err := g.SaveSnapshot(); err != nil {
+			log.Warnf("%v", err)
+		}
+	}
+}
+
+// 按快照格式写入缓存，跳过不是 ByteView 或已过期的值
+func writeSnapshot(w io.Writer, entries []eviction.SnapshotEntry) error {
+	crc := crc32.New(crc32c)
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	buf := make([]byte, 0, 3*binary.MaxVarintLen64)
+
+	bw.WriteString(snapshotMagic)
+	buf = binary.BigEndian.AppendUint16(buf[:0], snapshotVersion)
+	bw.Write(buf)
+
+	var count uint64
+	for _, e := range entries {
+		v, ok := e.Value.(ByteView)
+		if !ok || v.IsExpired() {
+			continue
+		}
+		bw.WriteByte(1)
+		bw.Write(binary.AppendUvarint(buf[:0], uint64(len(e.Key))))
+		bw.WriteString(e.Key)
+		bw.Write(binary.AppendUvarint(buf[:0], uint64(len(v.b))))
+		bw.Write(v.b)
+		buf = binary.AppendVarint(buf[:0], v.expireAtMillis())
+		buf = binary.AppendUvarint(buf, uint64(max(e.Idle, 0).Milliseconds()))
+		bw.Write(buf)
+		count++
+	}
+	bw.WriteByte(0)
+	bw.Write(binary.AppendUvarint(buf[:0], count))
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	// 校验和本身不参与计算，直接写入底层 writer
+	_, err := w.Write(binary.BigEndian.AppendUint32(buf[:0], crc.Sum32()))
+	return err
+}
+
+// 读取并校验快照，只有整个文件校验通过时才返回数据
+func readSnapshot(r io.Reader) ([]eviction.SnapshotEntry, error) {
+	crc := crc32.New(crc32c)
+	br := bufio.NewReader(r)
+	sr := &snapshotReader{r: br, crc: crc}
+
+	header := sr.bytes(len(snapshotMagic) + 2)
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrSnapshotCorrupt)
+	}
+	if version := binary.BigEndian.Uint16(header[len(snapshotMagic):]); version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	var entries []eviction.SnapshotEntry
+	for sr.byte() == 1 {
+		key := sr.bytes(sr.length())
+		value := sr.bytes(sr.length())
+		expireAt := sr.varint()
+		idle := sr.uvarint()
+		if sr.err != nil {
+			break
+		}
+		entries = append(entries, eviction.SnapshotEntry{
+			Key:   string(key),
+			Value: ByteView{b: value, expireAt: expireAtFromMillis(expireAt), restored: true},
+			Idle:  time.Duration(idle) * time.Millisecond,
+		})
+	}
+	count := sr.uvarint()
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if count != uint64(len(entries)) {
+		return nil, fmt.Errorf("%w: %d entries, trailer says %d", ErrSnapshotCorrupt, len(entries), count)
+	}
+
+	sum := crc.Sum32()
+	var trailer [4]byte
+	if _, err := io.ReadFull(br, trailer[:]); err != nil {
+		return nil, fmt.Errorf("%w: missing checksum", ErrSnapshotCorrupt)
+	}
+	if binary.BigEndian.Uint32(trailer[:]) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+	return entries, nil
+}
+
+// 读取快照字段并累计校验和，遇到第一个错误后后续读取均返回零值
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	err error
+}
+
+func (sr *snapshotReader) fail(err error) {
+	if sr.err != nil {
+		return
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("%w: unexpected end of file", ErrSnapshotCorrupt)
+	}
+	sr.err = err
+}
+
+func (sr *snapshotReader) byte() byte {
+	if sr.err != nil {
+		return 0
+	}
+	b, err := sr.r.ReadByte()
+	if err != nil {
+		sr.fail(err)
+		return 0
+	}
+	sr.crc.Write([]byte{b})
+	return b
+}
+
+func (sr *snapshotReader) bytes(n int) []byte {
+	if sr.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, b); err != nil {
+		sr.fail(err)
+		return nil
+	}
+	sr.crc.Write(b)
+	return b
+}
+
+// 读取一个变长整数，ReadUvarint/ReadVarint 逐字节读取，经由 byteReader 计入校验和
+func (sr *snapshotReader) uvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(byteReader{sr})
+	if err != nil {
+		sr.fail(err)
+	}
+	return v
+}
+
+func (sr *snapshotReader) varint() int64 {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(byteReader{sr})
+	if err != nil {
+		sr.fail(err)
+	}
+	return v
+}
+
+// 读取key或value的长度
+func (sr *snapshotReader) length() int {
+	n := sr.uvarint()
+	if n > maxSnapshotField {
+		sr.fail(fmt.Errorf("%w: field length %d", ErrSnapshotCorrupt, n))
+		return 0
+	}
+	return int(n)
+}
+
+type byteReader struct{ sr *snapshotReader }
+
+func (b byteReader) ReadByte() (byte, error) {
+	c := b.sr.byte()
+	if b.sr.err != nil {
+		return 0, b.sr.err
+	}
+	return c, nil
+}
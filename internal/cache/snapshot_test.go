@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGroup_snapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	mygrp := NewGroup("snapshotGroup", 2<<10, getter, WithSnapshot(path, 0))
+	mygrp.cache.add("a", ByteView{b: []byte("1")})
+	expireAt := time.Now().Add(time.Hour)
+	mygrp.cache.add("ttl", ByteView{b: []byte("2"), expireAt: expireAt})
+	mygrp.cache.add("expired", ByteView{b: []byte("3"), expireAt: time.Now().Add(-time.Second)})
+	if err := mygrp.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewGroup("snapshotGroup", 2<<10, getter, WithSnapshot(path, 0))
+	if v, ok := restored.cache.get("a"); !ok || v.String() != "1" {
+		t.Errorf("a = %q, %v", v.String(), ok)
+	}
+	if v, ok := restored.cache.get("ttl"); !ok || v.ExpireAt().UnixMilli() != expireAt.UnixMilli() {
+		t.Errorf("ttl = %q, %v, expireAt %v", v.String(), ok, v.ExpireAt())
+	}
+	if _, ok := restored.cache.get("expired"); ok {
+		t.Error("expired key should not be restored")
+	}
+
+	// 恢复的旧值被迁移来的值覆盖，迁移来的值不再被覆盖
+	if !restored.acceptHandoff("a", ByteView{b: []byte("new")}) {
+		t.Error("handoff should replace a restored value")
+	}
+	if restored.acceptHandoff("a", ByteView{b: []byte("newer")}) {
+		t.Error("handoff should not replace a value written after restore")
+	}
+	if v, _ := restored.cache.get("a"); v.String() != "new" {
+		t.Errorf("a = %q after handoff", v.String())
+	}
+}
+
+func TestGroup_snapshotLoopStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+	mygrp := NewGroup("snapshotLoopGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithSnapshot(path, 5*time.Millisecond))
+	mygrp.cache.add("a", ByteView{b: []byte("1")})
+	time.Sleep(20 * time.Millisecond)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("snapshot should be saved periodically: %v", err)
+	}
+
+	mygrp.stopSnapshotLoop()
+	time.Sleep(10 * time.Millisecond)
+	os.Remove(path)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("snapshot saved after the loop stopped: %v", err)
+	}
+}
+
+func TestReadSnapshot_corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+	mygrp := NewGroup("snapshotCorruptGroup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithSnapshot(path, 0))
+	mygrp.cache.add("key", ByteView{b: []byte("value")})
+	if err := mygrp.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)-6] ^= 0xff
+	for name, b := range map[string][]byte{
+		"truncated": data[:len(data)-3],
+		"flipped":   flipped,
+		"magic":     append([]byte("NOTSNAP!"), data[8:]...),
+	} {
+		f := filepath.Join(t.TempDir(), name)
+		if err = os.WriteFile(f, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		r, _ := os.Open(f)
+		_, err = readSnapshot(r)
+		r.Close()
+		if !errors.Is(err, ErrSnapshotCorrupt) {
+			t.Errorf("%s: err = %v, want ErrSnapshotCorrupt", name, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package discovery
+
+import "context"
+
+// DefaultWeight 节点的默认权重，未指定权重的节点均使用该值
+const DefaultWeight = 10
+
+// Node 一个缓存节点，Weight 与节点容量成正比，哈希环按权重分配虚拟节点
+type Node struct {
+	Addr   string
+	Weight int
+}
+
+// Nodes 使用默认权重将地址列表转换为节点列表
+func Nodes(addrs []string) []Node {
+	nodes := make([]Node, len(addrs))
+	for i, addr := range addrs {
+		nodes[i] = Node{Addr: addr, Weight: DefaultWeight}
+	}
+	return nodes
+}
+
+// Discoverer 服务注册与发现，Server 通过该接口获取哈希环中的节点，而不依赖具体的注册中心
+type Discoverer interface {
+	// Register 注册本节点及其权重并保持注册状态，直到 ctx 取消或注册失效才返回
+	Register(ctx context.Context, node Node) error
+	// Deregister 注销本节点
+	Deregister(ctx context.Context, addr string) error
+	// Watch 节点列表可能发生变化时向返回的通道发送通知，连续的变化可能合并为一次通知；ctx 取消后通道关闭
+	Watch(ctx context.Context) (<-chan struct{}, error)
+	// List 返回当前所有节点，无法获知权重的节点使用 DefaultWeight
+	List(ctx context.Context) ([]Node, error)
+}
+
+// Notify 非阻塞地发送一次变化通知，通道中已有未处理的通知时丢弃本次通知
+func Notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -2,77 +2,172 @@ package etcd
 
 import (
 	"FishCache/consistent"
+	"FishCache/internal/discovery"
 	"context"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/naming/endpoints"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// ListServicePeers 根据服务名称从服务注册中心获取可用服务节点列表
-func ListServicePeers() ([]string, error) {
+// Etcd 基于 etcd 的服务注册与发现，节点以 {service}/{addr} 为键注册，并与租约绑定
+type Etcd struct {
+	conf    consistent.Etcd
+	cli     *clientv3.Client
+	manager endpoints.Manager
+}
+
+var _ discovery.Discoverer = (*Etcd)(nil)
+
+// New 根据配置连接 etcd
+func New(conf consistent.Etcd) (*Etcd, error) {
+	if conf.ServiceName == "" {
+		conf.ServiceName = consistent.DefaultServiceName
+	}
 	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   consistent.Conf.Etcd.Address,
-		DialTimeout: consistent.Conf.Etcd.Timeout,
+		Endpoints:   conf.Address,
+		DialTimeout: conf.Timeout,
+		TLS:         conf.TLS,
 	})
 	if err != nil {
-		log.Errorf("连接etcd失败，错误: %v", err)
-		return []string{}, err
+		return nil, fmt.Errorf("连接etcd失败，错误: %w", err)
 	}
 
 	// Endpoints 实际上是 ip:port 的组合，也可以视为 Unix 中的 socket。
-	endpointsManager, err := endpoints.NewManager(cli, consistent.Conf.Etcd.ServiceName)
+	manager, err := endpoints.NewManager(cli, conf.ServiceName)
 	if err != nil {
-		log.Errorf("创建端点管理器失败，%v", err)
-		return []string{}, err
+		_ = cli.Close()
+		return nil, fmt.Errorf("创建端点管理器失败，%w", err)
 	}
+	return &Etcd{conf: conf, cli: cli, manager: manager}, nil
+}
+
+// Close 关闭 etcd 连接
+func (e *Etcd) Close() error {
+	return e.cli.Close()
+}
 
+// List 根据服务名称从服务注册中心获取可用服务节点列表，节点权重从端点元数据中解析
+func (e *Etcd) List(ctx context.Context) ([]discovery.Node, error) {
 	// List 返回当前服务的所有端点，形式为一个映射
-	ctx, cancel := context.WithTimeout(context.Background(), consistent.Conf.Etcd.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, e.conf.Timeout)
 	defer cancel()
 
-	Key2EndpointMap, err := endpointsManager.List(ctx)
+	Key2EndpointMap, err := e.manager.List(ctx)
 	if err != nil {
 		log.Errorf("获取目标服务的端点节点列表失败，错误: %s", err.Error())
-		return []string{}, err
+		return nil, err
 	}
 
-	var peersAddr []string
-	for _, endpoint := range Key2EndpointMap {
-		peersAddr = append(peersAddr, endpoint.Addr) // Addr 是将要建立连接的服务器地址
-		//log.Infof("找到端点地址: %s (%s):(%v)", key, endpoint.Addr, endpoint.Metadata)
+	var peers []discovery.Node
+	for key, endpoint := range Key2EndpointMap {
+		// Addr 是将要建立连接的服务器地址
+		weight, err := parseWeight(endpoint.Metadata)
+		if err != nil {
+			log.Warnf("端点 %s 的元数据 %v 无效，使用默认权重: %v", key, endpoint.Metadata, err)
+			weight = discovery.DefaultWeight
+		}
+		peers = append(peers, discovery.Node{Addr: endpoint.Addr, Weight: weight})
 	}
 
-	return peersAddr, nil
+	return peers, nil
 }
 
-// DynamicServices 提供动态构建全局哈希视图的能力
-// 便于缓存系统的二级视图收敛
-func DynamicServices(update chan struct{}) {
-	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   consistent.Conf.Etcd.Address,
-		DialTimeout: consistent.Conf.Etcd.Timeout,
-	})
-	if err != nil {
-		log.Errorf("连接etcd失败，错误: %v", err)
-		return
+// 端点元数据的形式为 "weight:10;version:v1.0.0"，没有 weight 字段时使用默认权重
+func parseWeight(metadata interface{}) (int, error) {
+	str, ok := metadata.(string)
+	if !ok {
+		return discovery.DefaultWeight, nil
+	}
+	for _, field := range strings.Split(str, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(field), ":")
+		if !found || name != "weight" {
+			continue
+		}
+		weight, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid weight %q: %w", value, err)
+		}
+		if weight <= 0 {
+			return 0, fmt.Errorf("weight must be positive, got %d", weight)
+		}
+		return weight, nil
 	}
-	defer cli.Close()
-	watchChan := cli.Watch(context.Background(), consistent.Conf.Etcd.ServiceName, clientv3.WithPrefix())
+	return discovery.DefaultWeight, nil
+}
+
+// 生成端点元数据
+func formatMetadata(weight int) string {
+	return fmt.Sprintf("weight:%d;version:v1.0.0", weight)
+}
+
+// 重新建立 watch 前的等待时间，每次失败后翻倍直到上限
+const (
+	minWatchBackoff = 100 * time.Millisecond
+	maxWatchBackoff = 10 * time.Second
+)
 
-	// 每当用户向指定服务添加或删除实例地址时，watchChan 后台守护进程
-	// 可以通过 WithPrefix() 扫描实例数量的变化，并将其作为 watchResp.Events 事件返回
-	for watchResp := range watchChan {
-		for _, event := range watchResp.Events {
-			switch event.Type {
-			case clientv3.EventTypePut:
-				// 处理添加或更新事件
-				//log.Warnf("Put: %s %s\n", string(event.Kv.Key), string(event.Kv.Value))
-				update <- struct{}{}
-			case clientv3.EventTypeDelete:
-				// 处理删除事件
-				//log.Warnf("Delete: %s\n", string(event.Kv.Key))
-				update <- struct{}{}
+// Watch 提供动态构建全局哈希视图的能力
+// 便于缓存系统的二级视图收敛。etcd 关闭 watch 通道后（如连接的成员失去leader）从上次处理的版本之后重新建立，
+// 直到 ctx 取消才关闭返回的通道
+func (e *Etcd) Watch(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+	go e.watchLoop(ctx, ch, func(ctx context.Context, rev int64) clientv3.WatchChan {
+		opts := []clientv3.OpOption{clientv3.WithPrefix()}
+		if rev > 0 {
+			opts = append(opts, clientv3.WithRev(rev))
+		}
+		// 要求连接的成员有leader，否则分区中的成员会让 watch 静默地不再收到事件
+		return e.cli.Watch(clientv3.WithRequireLeader(ctx), e.conf.ServiceName, opts...)
+	})
+	return ch, nil
+}
+
+// 反复建立 watch 并转发变化通知，watch 从 rev 开始，rev 为0时从最新版本开始
+func (e *Etcd) watchLoop(ctx context.Context, ch chan struct{}, watch func(ctx context.Context, rev int64) clientv3.WatchChan) {
+	defer close(ch)
+	var next int64 // 重新建立 watch 时的起始版本
+	backoff := minWatchBackoff
+	for {
+		// 每当用户向指定服务添加或删除实例地址时，watchChan 后台守护进程
+		// 可以通过 WithPrefix() 扫描实例数量的变化，并将其作为 watchResp.Events 事件返回
+		for watchResp := range watch(ctx, next) {
+			if watchResp.CompactRevision > 0 {
+				// 需要的版本已被压缩，期间的变化无法获知，从最新版本重新开始并刷新节点列表
+				log.Warnf("watch service %s: revision %d compacted, restart from the latest revision", e.conf.ServiceName, next)
+				next = 0
+				discovery.Notify(ch)
+				continue
+			}
+			if err := watchResp.Err(); err != nil {
+				log.Errorf("watch service %s error: %v", e.conf.ServiceName, err)
+				continue
+			}
+			backoff = minWatchBackoff
+			if watchResp.Header.Revision > 0 {
+				next = watchResp.Header.Revision + 1
+			}
+			// 添加、更新和删除事件都需要重新获取节点列表
+			if len(watchResp.Events) > 0 {
+				discovery.Notify(ch)
 			}
 		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warnf("watch service %s closed by etcd, re-establish from revision %d in %v", e.conf.ServiceName, next, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxWatchBackoff)
+		// 未处理过任何响应时无法得知断开期间是否有变化，重新获取一次节点列表
+		if next == 0 {
+			discovery.Notify(ch)
+		}
 	}
 }
@@ -0,0 +1,92 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"FishCache/consistent"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestParseWeight(t *testing.T) {
+	cases := []struct {
+		metadata interface{}
+		want     int
+		wantErr  bool
+	}{
+		{formatMetadata(80), 80, false},
+		{"version:v1.0.0", 10, false},
+		{nil, 10, false},
+		{"weight:abc;version:v1.0.0", 0, true},
+		{"weight:0", 0, true},
+	}
+	for _, c := range cases {
+		got, err := parseWeight(c.metadata)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("parseWeight(%v) = %d, %v，期望 %d", c.metadata, got, err, c.want)
+		}
+	}
+}
+
+func TestWatchLoop_reestablish(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	revs := make(chan int64, 4)
+	streams := make(chan chan clientv3.WatchResponse, 4)
+	watch := func(ctx context.Context, rev int64) clientv3.WatchChan {
+		revs <- rev
+		return <-streams
+	}
+	e := &Etcd{conf: consistent.Etcd{ServiceName: "fishcache"}}
+	ch := make(chan struct{}, 1)
+	go e.watchLoop(ctx, ch, watch)
+
+	// 第一次 watch 从最新版本开始，收到事件后发送通知
+	first := make(chan clientv3.WatchResponse, 1)
+	streams <- first
+	if rev := <-revs; rev != 0 {
+		t.Fatalf("first watch from revision %d, want 0", rev)
+	}
+	first <- clientv3.WatchResponse{
+		Header: etcdserverpb.ResponseHeader{Revision: 7},
+		Events: []*clientv3.Event{{}},
+	}
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("no notification for the event")
+	}
+
+	// etcd 关闭通道后从下一个版本重新建立，通知通道保持打开
+	close(first)
+	second := make(chan clientv3.WatchResponse)
+	streams <- second
+	select {
+	case rev := <-revs:
+		if rev != 8 {
+			t.Fatalf("re-established watch from revision %d, want 8", rev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch was not re-established")
+	}
+	select {
+	case _, ok := <-ch:
+		t.Fatalf("unexpected notification, open=%v", ok)
+	default:
+	}
+
+	// ctx 取消后关闭通知通道
+	cancel()
+	close(second)
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("unexpected notification after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("notification channel not closed after cancel")
+	}
+}
@@ -0,0 +1,155 @@
+package file
+
+import (
+	"FishCache/internal/discovery"
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 默认检查文件变化的间隔
+const defaultPollInterval = time.Second
+
+// File 从 JSON 或 YAML 文件中读取节点列表，文件内容变化时通知 Watch 的调用方，无需重启即可增删节点。
+// 文件格式由扩展名决定（.json、.yaml 或 .yml），内容为 {"peers": ["ip:port", ...], "weights": {"ip:port": 20}}，
+// weights 可选，未列出的节点使用默认权重。
+type File struct {
+	path     string
+	interval time.Duration
+}
+
+var _ discovery.Discoverer = (*File)(nil)
+
+// 节点文件的内容
+type peersFile struct {
+	Peers   []string       `json:"peers" yaml:"peers"`
+	Weights map[string]int `json:"weights" yaml:"weights"`
+}
+
+// New 创建读取 path 的节点列表，每隔 interval 检查一次文件是否变化，interval<=0 时使用默认的1秒
+func New(path string, interval time.Duration) (*File, error) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	f := &File{path: path, interval: interval}
+	// 提前校验文件能否解析，避免启动后才发现配置错误
+	if _, err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Register 节点文件由外部维护，等待 ctx 取消后返回
+func (f *File) Register(ctx context.Context, _ discovery.Node) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Deregister 节点文件由外部维护，无需注销
+func (f *File) Deregister(context.Context, string) error {
+	return nil
+}
+
+// Watch 定期检查文件的修改时间和大小，文件变化且解析出的节点列表不同时发送通知。
+// 文件暂时无法解析时保留上一次的节点列表，不发送通知。
+func (f *File) Watch(ctx context.Context) (<-chan struct{}, error) {
+	last, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("stat peers file %s failed: %w", f.path, err)
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+
+		modTime, size := info.ModTime(), info.Size()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(f.path)
+			if err != nil {
+				log.Warnf("stat peers file %s failed: %v", f.path, err)
+				continue
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+			peers, err := f.load()
+			if err != nil {
+				log.Warnf("reload peers file failed, keep previous peers: %v", err)
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+			if !slices.Equal(peers, last) {
+				log.Infof("peers file %s changed: %v", f.path, peers)
+				last = peers
+				discovery.Notify(ch)
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// List 读取文件中的节点列表及其权重
+func (f *File) List(context.Context) ([]discovery.Node, error) {
+	return f.load()
+}
+
+// 读取并解析节点文件，返回按地址排序去重后的节点列表
+func (f *File) load() ([]discovery.Node, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("read peers file %s failed: %w", f.path, err)
+	}
+
+	var conf peersFile
+	switch ext := strings.ToLower(filepath.Ext(f.path)); ext {
+	case ".json":
+		err = json.Unmarshal(data, &conf)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &conf)
+	default:
+		return nil, fmt.Errorf("unsupported peers file format %q, want .json, .yaml or .yml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse peers file %s failed: %w", f.path, err)
+	}
+
+	peers := make([]string, 0, len(conf.Peers))
+	for _, peer := range conf.Peers {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	slices.Sort(peers)
+	peers = slices.Compact(peers)
+
+	nodes := discovery.Nodes(peers)
+	for i := range nodes {
+		weight, ok := conf.Weights[nodes[i].Addr]
+		if !ok {
+			continue
+		}
+		if weight <= 0 {
+			return nil, fmt.Errorf("weight of %s in peers file %s must be positive, got %d", nodes[i].Addr, f.path, weight)
+		}
+		nodes[i].Weight = weight
+	}
+	return nodes, nil
+}
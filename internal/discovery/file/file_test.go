@@ -0,0 +1,89 @@
+package file
+
+import (
+	"FishCache/internal/discovery"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFile_List(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"peers.json": `{"peers": ["127.0.0.1:23335", "127.0.0.1:23333", "127.0.0.1:23333"]}`,
+		"peers.yaml": "peers:\n  - 127.0.0.1:23335\n  - 127.0.0.1:23333\n",
+	}
+	want := discovery.Nodes([]string{"127.0.0.1:23333", "127.0.0.1:23335"})
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := New(path, 0)
+		if err != nil {
+			t.Fatalf("解析 %s 失败: %v", name, err)
+		}
+		if peers, _ := f.List(context.Background()); !slices.Equal(peers, want) {
+			t.Errorf("%s 中的节点应为 %v，实际为 %v", name, want, peers)
+		}
+	}
+
+	if _, err := New(filepath.Join(dir, "peers.txt"), 0); err == nil {
+		t.Errorf("不支持的文件格式应返回错误")
+	}
+	// 文件中指定的权重优先，未指定的节点使用默认权重
+	path := filepath.Join(dir, "weighted.yaml")
+	content := "peers:\n  - 127.0.0.1:23333\n  - 127.0.0.1:23335\nweights:\n  127.0.0.1:23335: 40\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := New(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []discovery.Node{{Addr: "127.0.0.1:23333", Weight: discovery.DefaultWeight}, {Addr: "127.0.0.1:23335", Weight: 40}}
+	if peers, _ := f.List(context.Background()); !slices.Equal(peers, want) {
+		t.Errorf("带权重的节点应为 %v，实际为 %v", want, peers)
+	}
+	if err = os.WriteFile(path, []byte(content+"  127.0.0.1:23333: 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New(path, 0); err == nil {
+		t.Errorf("非正数的权重应返回错误")
+	}
+}
+
+func TestFile_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	if err := os.WriteFile(path, []byte(`{"peers": ["127.0.0.1:23333"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := New(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := f.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(path, []byte(`{"peers": ["127.0.0.1:23333", "127.0.0.1:23334"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-updates:
+	case <-time.After(time.Second):
+		t.Fatalf("文件变化后应收到通知")
+	}
+	if peers, _ := f.List(ctx); len(peers) != 2 {
+		t.Errorf("重新加载后应有 2 个节点，实际为 %v", peers)
+	}
+
+	cancel()
+	for range updates {
+	}
+}
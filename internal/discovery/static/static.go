@@ -0,0 +1,44 @@
+package static
+
+import (
+	"FishCache/internal/discovery"
+	"context"
+)
+
+// Static 使用固定的节点列表，节点不会变化，注册和注销均无需操作
+type Static struct {
+	peers []discovery.Node
+}
+
+var _ discovery.Discoverer = (*Static)(nil)
+
+// New 使用给定的节点地址创建静态节点列表，所有节点使用默认权重
+func New(peers []string) *Static {
+	return &Static{peers: discovery.Nodes(peers)}
+}
+
+// Register 静态列表无需注册，等待 ctx 取消后返回
+func (s *Static) Register(ctx context.Context, _ discovery.Node) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Deregister 静态列表无需注销
+func (s *Static) Deregister(context.Context, string) error {
+	return nil
+}
+
+// Watch 静态列表不会变化，返回的通道只在 ctx 取消后关闭
+func (s *Static) Watch(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// List 返回固定的节点列表
+func (s *Static) List(context.Context) ([]discovery.Node, error) {
+	return append([]discovery.Node(nil), s.peers...), nil
+}
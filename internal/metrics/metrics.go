@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 指标类型，对应 Prometheus 文本格式中 # TYPE 的取值
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefaultLatencyBuckets 默认的延迟直方图桶边界，单位为秒
+var DefaultLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Label 指标的一个标签
+type Label struct {
+	Name  string
+	Value string
+}
+
+// WriteHeader 写入指标的 # HELP 和 # TYPE 行，同名指标只需写入一次
+func WriteHeader(w io.Writer, name, help, typ string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	_, _ = fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// WriteSample 写入一条指标样本
+func WriteSample(w io.Writer, name string, labels []Label, value float64) {
+	_, _ = fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+// Histogram 累积分布直方图，并发安全
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64 // 各桶的上边界，升序
+	counts  []uint64  // 落入各桶的次数（非累积）
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram 使用给定的桶边界创建直方图
+func NewHistogram(buckets []float64) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Histogram{
+		buckets: b,
+		counts:  make([]uint64, len(b)),
+	}
+}
+
+// Observe 记录一次观测值
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// Write 写入直方图的 _bucket、_sum 和 _count 样本
+func (h *Histogram) Write(w io.Writer, name string, labels []Label) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += h.counts[i]
+		WriteSample(w, name+"_bucket", append(labels, Label{"le", formatValue(upper)}), float64(cumulative))
+	}
+	WriteSample(w, name+"_bucket", append(labels, Label{"le", "+Inf"}), float64(h.count))
+	WriteSample(w, name+"_sum", labels, h.sum)
+	WriteSample(w, name+"_count", labels, float64(h.count))
+}
+
+// HistogramVec 按一个标签的取值区分的一组直方图
+type HistogramVec struct {
+	mu         sync.RWMutex
+	labelName  string
+	buckets    []float64
+	histograms map[string]*Histogram
+}
+
+// NewHistogramVec 创建按 labelName 区分的直方图集合
+func NewHistogramVec(labelName string, buckets []float64) *HistogramVec {
+	return &HistogramVec{
+		labelName:  labelName,
+		buckets:    buckets,
+		histograms: make(map[string]*Histogram),
+	}
+}
+
+// With 返回标签取值对应的直方图，不存在时创建
+func (v *HistogramVec) With(value string) *Histogram {
+	v.mu.RLock()
+	h, ok := v.histograms[value]
+	v.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if h, ok = v.histograms[value]; !ok {
+		h = NewHistogram(v.buckets)
+		v.histograms[value] = h
+	}
+	return h
+}
+
+// Write 按标签取值的顺序写入所有直方图，调用方需先写入 # HELP 和 # TYPE
+func (v *HistogramVec) Write(w io.Writer, name string) {
+	v.mu.RLock()
+	values := make([]string, 0, len(v.histograms))
+	for value := range v.histograms {
+		values = append(values, value)
+	}
+	v.mu.RUnlock()
+	sort.Strings(values)
+
+	for _, value := range values {
+		v.With(value).Write(w, name, []Label{{v.labelName, value}})
+	}
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = fmt.Sprintf(`%s="%s"`, l.Name, escapeLabel(l.Value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// 标签值中的反斜杠、双引号和换行需要转义
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// 帮助文本中的反斜杠和换行需要转义
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistogram_Write(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	var b strings.Builder
+	WriteHeader(&b, "latency_seconds", "Request latency.", TypeHistogram)
+	h.Write(&b, "latency_seconds", []Label{{"method", `/a"b`}})
+
+	want := `# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="/a\"b",le="0.1"} 1
+latency_seconds_bucket{method="/a\"b",le="1"} 2
+latency_seconds_bucket{method="/a\"b",le="+Inf"} 3
+latency_seconds_sum{method="/a\"b"} 3.55
+latency_seconds_count{method="/a\"b"} 3
+`
+	if b.String() != want {
+		t.Errorf("直方图输出不正确:\n%s\n期望:\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,246 @@
+// Package tlsutil 从证书文件构造 TLS 配置，证书文件更新后自动重新加载
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/credentials"
+)
+
+// 默认检查证书文件是否更新的最小间隔
+const DefaultReloadInterval = 10 * time.Second
+
+// Config 证书文件路径，均为PEM格式
+type Config struct {
+	CertFile string // 本节点的证书，作为服务端时必须设置，作为客户端时设置后用于mTLS
+	KeyFile  string // 证书对应的私钥
+	CAFile   string // 校验对端证书的CA，为空时使用系统根证书
+	// ClientAuth 作为服务端时要求客户端提供由 CAFile 签发的证书（mTLS）
+	ClientAuth bool
+	// ServerName 作为客户端时校验的服务端名称。为空时 Credentials 使用连接地址中的主机名或IP，
+	// ClientConfig 使用SNI中的主机名，按IP连接时必须设置
+	ServerName string
+	// ReloadInterval 检查证书文件是否更新的最小间隔，默认为 DefaultReloadInterval
+	ReloadInterval time.Duration
+}
+
+// Enabled 是否设置了任意证书文件
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.CAFile != ""
+}
+
+// Reloader 持有当前的证书和CA。每次TLS握手时若距离上次检查超过 ReloadInterval，
+// 就比较证书文件的修改时间和大小，有变化时重新加载；加载失败时继续使用旧的证书。
+type Reloader struct {
+	conf Config
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	stamps    map[string]fileStamp
+	checkedAt time.Time
+}
+
+// 用于判断文件是否更新
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader 加载证书文件，文件缺失或格式错误时返回错误
+func NewReloader(conf Config) (*Reloader, error) {
+	if (conf.CertFile == "") != (conf.KeyFile == "") {
+		return nil, errors.New("tls cert and key must be set together")
+	}
+	if conf.ClientAuth && conf.CAFile == "" {
+		return nil, errors.New("tls client auth requires a CA file")
+	}
+	if conf.ReloadInterval <= 0 {
+		conf.ReloadInterval = DefaultReloadInterval
+	}
+	r := &Reloader{conf: conf}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.checkedAt = time.Now()
+	return r, nil
+}
+
+// ServerConfig 返回服务端的TLS配置，conf.CertFile 必须设置
+func (r *Reloader) ServerConfig() (*tls.Config, error) {
+	if r.conf.CertFile == "" {
+		return nil, errors.New("tls server requires a cert file")
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// 每次握手时生成配置，使证书和CA的更新对新连接生效
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			conf := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+			}
+			if r.conf.ClientAuth {
+				conf.ClientAuth = tls.RequireAndVerifyClientCert
+				conf.ClientCAs = pool
+			}
+			return conf, nil
+		},
+	}, nil
+}
+
+// ClientConfig 返回客户端的TLS配置，用于无法使用 Credentials 的场景（如etcd客户端）。
+// 标准库的 RootCAs 在握手前就已固定，为了让CA的更新生效，关闭内置校验并在 VerifyConnection 中用当前的CA校验服务端证书。
+// 握手状态中只有通过SNI发送的主机名，按IP连接时为空，此时使用配置的 ServerName；两者都为空时拒绝连接，
+// 否则同一CA签发的任意证书都会被接受。
+func (r *Reloader) ClientConfig() *tls.Config {
+	conf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         r.conf.ServerName,
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			_, pool := r.current()
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("tls: server presented no certificate")
+			}
+			name := cs.ServerName
+			if name == "" {
+				name = r.conf.ServerName
+			}
+			if name == "" {
+				return errors.New("tls: no server name to verify the server certificate against, set one when connecting by IP")
+			}
+			opts := x509.VerifyOptions{
+				DNSName:       name,
+				Roots:         pool,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+	if r.conf.CertFile != "" {
+		conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		}
+	}
+	return conf
+}
+
+// Credentials 返回gRPC客户端的传输凭证。每次握手时用当前的证书和CA生成配置，由标准库校验服务端证书，
+// 未配置 ServerName 时使用连接地址中的主机名或IP，按IP连接时校验证书中的IP
+func (r *Reloader) Credentials() credentials.TransportCredentials {
+	return &reloadingCredentials{TransportCredentials: credentials.NewTLS(r.handshakeConfig()), r: r}
+}
+
+// 每次客户端握手时重新生成配置的传输凭证，其余方法使用创建时的配置
+type reloadingCredentials struct {
+	credentials.TransportCredentials
+	r *Reloader
+}
+
+func (c *reloadingCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return credentials.NewTLS(c.r.handshakeConfig()).ClientHandshake(ctx, authority, conn)
+}
+
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	return &reloadingCredentials{TransportCredentials: c.TransportCredentials.Clone(), r: c.r}
+}
+
+// 用当前的证书和CA生成一次握手使用的客户端配置
+func (r *Reloader) handshakeConfig() *tls.Config {
+	cert, pool := r.current()
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: r.conf.ServerName,
+		RootCAs:    pool,
+	}
+	if r.conf.CertFile != "" {
+		conf.Certificates = []tls.Certificate{*cert}
+	}
+	return conf
+}
+
+// 返回当前的证书和CA，必要时先检查文件是否更新
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= r.conf.ReloadInterval {
+		r.checkedAt = time.Now()
+		if r.changed() {
+			if err := r.load(); err != nil {
+				log.Errorf("reload tls certificates failed, keep using the old ones: %v", err)
+			} else {
+				log.Infof("reloaded tls certificates")
+			}
+		}
+	}
+	return r.cert, r.pool
+}
+
+// 证书文件的修改时间或大小是否有变化
+func (r *Reloader) changed() bool {
+	for path, stamp := range r.stamps {
+		info, err := os.Stat(path)
+		if err != nil {
+			// 轮换过程中文件可能暂时不存在，下次再检查
+			continue
+		}
+		if !info.ModTime().Equal(stamp.modTime) || info.Size() != stamp.size {
+			return true
+		}
+	}
+	return false
+}
+
+// 加载所有证书文件，全部成功后才替换当前的证书和CA
+func (r *Reloader) load() error {
+	stamps := make(map[string]fileStamp)
+	for _, path := range []string{r.conf.CertFile, r.conf.KeyFile, r.conf.CAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("stat %s: %w", path, err)
+		}
+		stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	var cert *tls.Certificate
+	if r.conf.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load tls key pair: %w", err)
+		}
+		cert = &c
+	}
+	var pool *x509.CertPool
+	if r.conf.CAFile != "" {
+		pem, err := os.ReadFile(r.conf.CAFile)
+		if err != nil {
+			return fmt.Errorf("read tls CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.conf.CAFile)
+		}
+	}
+
+	r.cert, r.pool, r.stamps = cert, pool, stamps
+	return nil
+}
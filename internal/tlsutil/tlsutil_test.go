@@ -0,0 +1,305 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 测试用的CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// 签发同时可用于服务端和客户端的证书，返回PEM格式的证书和私钥
+func (ca *testCA) issue(t *testing.T, serial int64) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "fishcache"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// 将CA和新签发的证书写入 dir，modTime 用于确保文件被识别为已更新
+func writeFiles(t *testing.T, dir string, ca *testCA, serial int64, modTime time.Time) Config {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, serial)
+	conf := Config{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+	for path, data := range map[string][]byte{conf.CertFile: certPEM, conf.KeyFile: keyPEM, conf.CAFile: ca.pem} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conf
+}
+
+// 在本地启动TLS服务端，接受连接并完成握手
+func serveTLS(t *testing.T, conf *tls.Config) string {
+	t.Helper()
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	return lis.Addr().String()
+}
+
+// 客户端握手，TLS 1.3 中服务端对客户端证书的拒绝在首次读取时才返回
+func dial(addr string, conf *tls.Config) error {
+	conn, err := tls.Dial("tcp", addr, conf)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+func TestReloader_mutualTLS(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	conf := writeFiles(t, t.TempDir(), ca, 2, time.Now())
+	conf.ClientAuth = true
+	server, err := NewReloader(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConf, err := server.ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, serverConf)
+
+	// 按IP连接时SNI中没有主机名，需要配置 ServerName
+	clientConf := writeFiles(t, t.TempDir(), ca, 3, time.Now())
+	clientConf.ServerName = "127.0.0.1"
+	client, err := NewReloader(clientConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dial(addr, client.ClientConfig()); err != nil {
+		t.Fatalf("mTLS handshake failed: %v", err)
+	}
+
+	// 不提供证书的客户端被拒绝
+	noCert, err := NewReloader(Config{CAFile: conf.CAFile, ServerName: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dial(addr, noCert.ClientConfig()); err == nil {
+		t.Error("client without certificate should be rejected")
+	}
+
+	// 其他CA签发的服务端证书不被信任
+	otherConf := writeFiles(t, t.TempDir(), newTestCA(t, "other"), 4, time.Now())
+	otherConf.ServerName = "127.0.0.1"
+	other, err := NewReloader(otherConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dial(addr, other.ClientConfig()); err == nil {
+		t.Error("server certificate from another CA should be rejected")
+	}
+}
+
+func TestReloader_serverName(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	server, err := NewReloader(writeFiles(t, t.TempDir(), ca, 2, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConf, err := server.ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, serverConf)
+	clientConf := writeFiles(t, t.TempDir(), ca, 3, time.Now())
+
+	// 证书中不包含的服务端名称被拒绝
+	clientConf.ServerName = "other.example"
+	mismatched, err := NewReloader(clientConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dial(addr, mismatched.ClientConfig()); err == nil {
+		t.Error("server certificate for another hostname should be rejected")
+	}
+
+	// 没有服务端名称时无法校验证书，拒绝连接
+	clientConf.ServerName = ""
+	client, err := NewReloader(clientConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = tls.Client(conn, client.ClientConfig()).Handshake(); err == nil {
+		t.Error("handshake without a server name should be rejected")
+	}
+
+	// gRPC凭证按连接地址校验：证书中只有 127.0.0.1，没有 localhost。gRPC客户端要求协商出h2
+	h2Conf := serverConf.Clone()
+	h2Conf.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		conf, err := serverConf.GetConfigForClient(hello)
+		if err == nil {
+			conf.NextProtos = []string{"h2"}
+		}
+		return conf, err
+	}
+	addr = serveTLS(t, h2Conf)
+	_, port, _ := net.SplitHostPort(addr)
+	creds := client.Credentials()
+	for authority, valid := range map[string]bool{addr: true, net.JoinHostPort("localhost", port): false} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = creds.ClientHandshake(context.Background(), authority, conn)
+		conn.Close()
+		if (err == nil) != valid {
+			t.Errorf("handshake with authority %s: %v, want valid=%v", authority, err, valid)
+		}
+	}
+}
+
+func TestReloader_reload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	conf := writeFiles(t, dir, ca, 2, time.Now().Add(-time.Minute))
+	conf.ReloadInterval = time.Millisecond
+	r, err := NewReloader(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := func() int64 {
+		cert, _ := r.current()
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+	if got := serial(); got != 2 {
+		t.Fatalf("serial = %d, want 2", got)
+	}
+
+	// 证书轮换后重新加载
+	rotated := newTestCA(t, "rotated")
+	writeFiles(t, dir, rotated, 5, time.Now())
+	time.Sleep(2 * time.Millisecond)
+	if got := serial(); got != 5 {
+		t.Fatalf("serial = %d after rotation, want 5", got)
+	}
+	if _, pool := r.current(); !pool.Equal(certPool(rotated)) {
+		t.Error("CA should be reloaded")
+	}
+
+	// 文件损坏时继续使用旧的证书
+	if err = os.WriteFile(conf.KeyFile, []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if got := serial(); got != 5 {
+		t.Fatalf("serial = %d after broken rotation, want 5", got)
+	}
+}
+
+func certPool(ca *testCA) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func TestNewReloader_invalid(t *testing.T) {
+	for name, conf := range map[string]Config{
+		"cert without key":       {CertFile: "cert.pem"},
+		"client auth without CA": {CertFile: "cert.pem", KeyFile: "key.pem", ClientAuth: true},
+		"missing files":          {CertFile: "missing.pem", KeyFile: "missing.pem"},
+	} {
+		if _, err := NewReloader(conf); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -3,13 +3,24 @@ package main
 import (
 	"FishCache/consistent"
 	"FishCache/internal/cache"
+	"FishCache/internal/cache/eviction"
+	"FishCache/internal/discovery"
+	"FishCache/internal/discovery/etcd"
+	"FishCache/internal/discovery/file"
+	"FishCache/internal/discovery/static"
+	"FishCache/internal/tlsutil"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -20,7 +31,14 @@ var testDB = map[string]string{
 	"Sam":  "567",
 }
 
-func createScoresGroup() {
+func createScoresGroup(policy eviction.PolicyType, snapshotDir string, snapshotInterval time.Duration, diskDir string, diskBytes int64) {
+	opts := []cache.GroupOption{cache.WithEvictionPolicy(policy)}
+	if snapshotDir != "" {
+		opts = append(opts, cache.WithSnapshot(filepath.Join(snapshotDir, "scores.snap"), snapshotInterval))
+	}
+	if diskDir != "" {
+		opts = append(opts, cache.WithDiskTier(diskDir, diskBytes))
+	}
 	cache.NewGroup("scores", 2<<10, cache.GetterFunc(
 		func(key string) ([]byte, error) {
 			if value, exists := testDB[key]; exists {
@@ -28,8 +46,9 @@ func createScoresGroup() {
 				return []byte(value), nil
 			}
 			log.Printf("Load local key: %s failed\n", key)
-			return []byte(""), nil
+			return nil, fmt.Errorf("%s: %w", key, cache.ErrNotFound)
 		}),
+		opts...,
 	)
 }
 
@@ -37,8 +56,27 @@ func main() {
 	// 外部传参
 	var addr string            // 服务运行地址 ip:port
 	var peers []string         // 邻居节点，使用","分割
+	var peersFile string       // 邻居节点文件，JSON或YAML格式，修改后自动生效
 	var etcdServersIP []string // etcd服务地址，使用","分割
 	var etcdServiceName string
+	var callTimeout time.Duration // 节点间单次调用的超时时间
+	var evictionPolicy string     // 缓存淘汰策略
+	var metricsAddr string        // 指标HTTP服务地址，为空时不启动
+	var httpAddr string           // HTTP网关地址，为空时不启动
+	var respAddr string           // Redis协议前端地址，为空时不启动
+	var memcacheAddr string       // memcached协议前端地址，为空时不启动
+	var memcacheGroup string      // memcached协议中不带 Group 前缀的key所属的 Group
+	var peerTLS tlsutil.Config    // 节点间gRPC通信的证书
+	var etcdTLS tlsutil.Config    // 连接etcd的证书
+	var weight int                // 节点权重，与节点内存容量成正比
+	var placement string          // key在节点间的分布算法
+	var boundedLoad float64       // 有界负载的epsilon，为0时关闭
+	var replicas int              // 每个key保存的副本数
+	var handoffRate int64         // 节点变化时迁移缓存的速率
+	var snapshotDir string        // 快照文件目录，为空时不保存快照
+	var snapshotInterval time.Duration
+	var diskDir string  // 磁盘二级缓存目录，为空时不启用
+	var diskBytes int64 // 磁盘二级缓存的字节数上限
 	flag.Func("peers", "A list of peers separated by commas", func(s string) error {
 		peers = strings.Split(s, ",")
 		return nil
@@ -47,13 +85,38 @@ func main() {
 		etcdServersIP = strings.Split(s, ",")
 		return nil
 	})
+	flag.StringVar(&peersFile, "peers-file", "", "JSON or YAML file listing peers, reloaded on change")
 	flag.StringVar(&addr, "host", "", "FishCache node server host")
 	flag.StringVar(&etcdServiceName, "service", "", "service name")
+	flag.DurationVar(&callTimeout, "timeout", 10*time.Second, "timeout of a single call between peers")
+	flag.StringVar(&evictionPolicy, "eviction", string(eviction.PolicyLRU), "eviction policy: lru, lfu, arc, tinylfu or ring")
+	flag.IntVar(&weight, "weight", discovery.DefaultWeight, "node weight registered to etcd, proportional to its memory (-etcd only)")
+	flag.StringVar(&placement, "placement", string(cache.PlacementRing), "key placement: ring, rendezvous, jump (fixed -peers only) or maglev, must match across the cluster")
+	flag.Float64Var(&boundedLoad, "bounded-load", 0, "epsilon of consistent hashing with bounded loads, 0 disables it (ring placement only)")
+	flag.IntVar(&replicas, "replicas", 1, "number of nodes each key is stored on")
+	flag.Int64Var(&handoffRate, "handoff-rate", 8<<20, "bytes per second when handing off keys on membership change, 0 to disable")
+	flag.StringVar(&snapshotDir, "snapshot-dir", "", "directory of cache snapshots, restored on startup and saved on shutdown")
+	flag.DurationVar(&snapshotInterval, "snapshot-interval", 5*time.Minute, "interval of periodic snapshots, 0 to save only on shutdown")
+	flag.StringVar(&diskDir, "disk-dir", "", "directory of the disk tier holding entries evicted from memory, empty to disable")
+	flag.Int64Var(&diskBytes, "disk-bytes", 1<<30, "byte budget of the disk tier")
+	flag.StringVar(&peerTLS.CertFile, "tls-cert", "", "PEM certificate of this node, enables TLS between peers")
+	flag.StringVar(&peerTLS.KeyFile, "tls-key", "", "PEM private key of -tls-cert")
+	flag.StringVar(&peerTLS.CAFile, "tls-ca", "", "PEM CA verifying peer certificates, system roots if empty")
+	flag.BoolVar(&peerTLS.ClientAuth, "tls-client-auth", false, "require peers to present certificates signed by -tls-ca (mutual TLS)")
+	flag.StringVar(&etcdTLS.CertFile, "etcd-cert", "", "PEM client certificate for etcd")
+	flag.StringVar(&etcdTLS.KeyFile, "etcd-key", "", "PEM private key of -etcd-cert")
+	flag.StringVar(&etcdTLS.CAFile, "etcd-ca", "", "PEM CA verifying etcd, enables TLS to etcd")
+	flag.StringVar(&etcdTLS.ServerName, "etcd-server-name", "", "name in the etcd server certificate, required when -etcd lists IPs")
+	flag.StringVar(&httpAddr, "http", "", "serve the HTTP/JSON gateway at <addr>/v1/groups/{group}/keys/{key}, e.g. :8080")
+	flag.StringVar(&respAddr, "resp", "", "serve the Redis (RESP) protocol frontend at <addr>, e.g. :6379")
+	flag.StringVar(&memcacheAddr, "memcache", "", "serve the memcached text and binary protocol frontend at <addr>, e.g. :11211")
+	flag.StringVar(&memcacheGroup, "memcache-group", "scores", "group of memcached keys without a \"group:\" prefix")
+	flag.StringVar(&metricsAddr, "metrics", "", "serve Prometheus metrics at http://<addr>/metrics, e.g. :9100")
 	flag.Parse()
 
-	// 目前支持手动设置peers和etcd注册发现模式
-	if len(peers) == 0 && len(etcdServersIP) == 0 {
-		log.Errorf("请 手动设置邻居 或 传递etcdIP获取邻居\n")
+	// 目前支持手动设置peers、节点文件和etcd注册发现模式
+	if len(peers) == 0 && peersFile == "" && len(etcdServersIP) == 0 {
+		log.Errorf("请 手动设置邻居、指定邻居文件 或 传递etcdIP获取邻居\n")
 		return
 	}
 	// 设置节点的通信源IP端口
@@ -61,6 +124,22 @@ func main() {
 		log.Fatalf("FishCache node server host is empty")
 		return
 	}
+	if weight <= 0 {
+		log.Fatalf("node weight must be positive, got %d", weight)
+	}
+	if err := eviction.PolicyType(evictionPolicy).Validate(); err != nil {
+		log.Fatalf("invalid -eviction: %v", err)
+	}
+	// 静态节点列表和节点文件中的权重对所有节点一致，-weight 只能注册到etcd
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "weight" && len(etcdServersIP) == 0 {
+			log.Fatalf("-weight only takes effect with -etcd, set weights in -peers-file instead")
+		}
+	})
+	// Jump Hash 按节点名称顺序分配编号，节点动态变化时大部分key会换到其他节点
+	if cache.PlacementType(placement) == cache.PlacementJump && (peersFile != "" || len(etcdServersIP) != 0) {
+		log.Fatalf("placement jump requires a fixed -peers list, not -etcd or -peers-file")
+	}
 	// 服务名称，在etcd中key的prefix体现
 	if etcdServiceName == "" {
 		etcdServiceName = consistent.DefaultServiceName
@@ -70,45 +149,139 @@ func main() {
 	logInit()
 
 	// 缓存组初始化
-	createScoresGroup()
+	createScoresGroup(eviction.PolicyType(evictionPolicy), snapshotDir, snapshotInterval, diskDir, diskBytes)
+
+	// 服务注册与发现，优先使用etcd，其次是节点文件，最后是静态节点列表
+	var discoverer discovery.Discoverer
+	switch {
+	case len(etcdServersIP) != 0:
+		etcdConf := consistent.Etcd{
+			Address:     etcdServersIP,
+			Timeout:     5 * time.Second,
+			ServiceName: etcdServiceName,
+		}
+		if etcdTLS.Enabled() {
+			reloader, err := tlsutil.NewReloader(etcdTLS)
+			if err != nil {
+				log.Fatalf("load etcd tls certificates failed, %v", err)
+			}
+			etcdConf.TLS = reloader.ClientConfig()
+		}
+		etcdDiscoverer, err := etcd.New(etcdConf)
+		if err != nil {
+			log.Fatalf("create etcd discoverer failed, %v", err)
+		}
+		defer etcdDiscoverer.Close()
+		discoverer = etcdDiscoverer
+	case peersFile != "":
+		fileDiscoverer, err := file.New(peersFile, 0)
+		if err != nil {
+			log.Fatalf("create file discoverer failed, %v", err)
+		}
+		discoverer = fileDiscoverer
+	default:
+		discoverer = static.New(peers)
+	}
 
 	// RPC服务初始化
-	svr, err := cache.NewRPCServer(addr)
+	opts := []cache.ServerOption{cache.WithCallTimeout(callTimeout),
+		cache.WithWeight(weight),
+		cache.WithPlacement(cache.PlacementType(placement)),
+		cache.WithBoundedLoad(boundedLoad),
+		cache.WithReplicas(replicas),
+		cache.WithHandoffRate(handoffRate),
+	}
+	var reloader *tlsutil.Reloader
+	if peerTLS.Enabled() {
+		var err error
+		if reloader, err = tlsutil.NewReloader(peerTLS); err != nil {
+			log.Fatalf("load tls certificates failed, %v", err)
+		}
+		opts = append(opts, cache.WithTLS(reloader))
+	}
+	svr, err := cache.NewRPCServer(addr, discoverer, opts...)
 	if err != nil {
 		log.Fatalf("acquire grpc server instance failed, %v", err)
 	}
 
-	// 设置节点与缓存组的一致性
-	if len(peers) != 0 {
-		svr.SetPeers(peers)
+	// 指标服务
+	if metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", svr.MetricsHandler())
+		go func() {
+			log.Infof("serve metrics on %s/metrics", metricsAddr)
+			if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+				log.Errorf("metrics server stopped: %v", err)
+			}
+		}()
+	}
+
+	// HTTP网关，开启TLS时与gRPC使用相同的证书
+	if httpAddr != "" {
+		gateway := &http.Server{Addr: httpAddr, Handler: svr.HTTPHandler()}
+		go func() {
+			log.Infof("serve http gateway on %s", httpAddr)
+			var err error
+			if reloader != nil {
+				if gateway.TLSConfig, err = reloader.ServerConfig(); err == nil {
+					err = gateway.ListenAndServeTLS("", "")
+				}
+			} else {
+				err = gateway.ListenAndServe()
+			}
+			log.Errorf("http gateway stopped: %v", err)
+		}()
+	}
+
+	// Redis和memcached协议前端，开启TLS时与gRPC使用相同的证书
+	if respAddr != "" {
+		lis := listen(respAddr, reloader)
+		go func() {
+			log.Infof("serve resp frontend on %s", respAddr)
+			if err := svr.ServeRESP(lis); err != nil {
+				log.Errorf("resp frontend stopped: %v", err)
+			}
+		}()
+	}
+	if memcacheAddr != "" {
+		lis := listen(memcacheAddr, reloader)
+		go func() {
+			log.Infof("serve memcache frontend on %s", memcacheAddr)
+			if err := svr.ServeMemcache(lis, memcacheGroup); err != nil {
+				log.Errorf("memcache frontend stopped: %v", err)
+			}
+		}()
 	}
 
-	// 初始化服务器
+	// 初始化服务器，从discoverer获取邻居并监听变化
 	if err = svr.InitServer(); err != nil {
 		log.Fatalf("failed to initialize server: %v", err)
 		return
 	}
-	// 发起服务注册，并定义服务停止时行为
-	if len(etcdServersIP) != 0 {
-		// 定义consistent中配置信息
-		consistent.Conf = &consistent.Config{
-			Etcd: &consistent.Etcd{
-				Address:     etcdServersIP,
-				Timeout:     5 * time.Second,
-				ServiceName: etcdServiceName,
-			},
-		}
-		go func() {
-			defer func() {
-				if svr != nil {
-					if err = svr.StopServer(); err != nil {
-						log.Errorf("Failed to stop server: %v", err)
-					}
-				}
-			}()
-			svr.RegisterEtcd()
+	// 发起服务注册，并定义服务停止时行为；通过 fishctl drain 退出集群后继续作为转发节点运行
+	go func() {
+		defer func() {
+			if svr.Draining() {
+				return
+			}
+			if err := svr.StopServer(); err != nil {
+				log.Errorf("Failed to stop server: %v", err)
+			}
 		}()
-	}
+		if err := svr.Register(); err != nil && !svr.Draining() {
+			log.Errorf("%v", err)
+		}
+	}()
+	// 收到退出信号时停止服务器并保存快照
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		if err := svr.StopServer(); err != nil {
+			log.Errorf("Failed to stop server: %v", err)
+		}
+		os.Exit(0)
+	}()
 	// 运行服务
 	err = svr.RunServer()
 	if err != nil {
@@ -116,6 +289,28 @@ func main() {
 		return
 	}
 	// grpcurl -plaintext -d "{\"group\": \"scores\", \"key\": \"Tom\"}" 127.0.0.1:23333 fishcache.CacheService/Get
+	// grpcurl -plaintext -d "{\"group\": \"scores\", \"key\": \"Tom\", \"value\": \"NjQw\"}" 127.0.0.1:23333 fishcache.CacheService/Set
+	// curl http://127.0.0.1:8080/v1/groups/scores/keys/Tom
+	// redis-cli -p 6379 SET Tom 640 EX 60
+	// printf "get scores:Tom\r\n" | nc 127.0.0.1 11211
+	// go run ./cmd/fishctl -peers 127.0.0.1:23333 stats
+	// curl -X PUT --data-binary 640 "http://127.0.0.1:8080/v1/groups/scores/keys/Tom?ttl=1m"
+}
+
+// 监听TCP地址，reloader 不为nil时使用TLS
+func listen(addr string, reloader *tlsutil.Reloader) net.Listener {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("listen on %s failed, %v", addr, err)
+	}
+	if reloader == nil {
+		return lis
+	}
+	tlsConf, err := reloader.ServerConfig()
+	if err != nil {
+		log.Fatalf("load tls config for %s failed, %v", addr, err)
+	}
+	return tls.NewListener(lis, tlsConf)
 }
 
 func logInit() {